@@ -35,8 +35,10 @@ func handler(ctx context.Context, event json.RawMessage) error {
 		return fmt.Errorf("failed to delete spectator conversation: %w", err)
 	}
 
+	// Aborts are delivered at least once, the players may be in another match
+	// by the time a repeated one arrives
 	for _, playerId := range req.PlayerIds {
-		err = storageClient.DeleteUserMatch(ctx, playerId)
+		err = storageClient.DeleteUserMatchOfMatch(ctx, playerId, req.MatchId)
 		if err != nil {
 			return fmt.Errorf(
 				"failed to delete user match: [userId: %s] - %w",
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/yelaco/ludofy/internal/domains/dtos"
+	"github.com/yelaco/ludofy/internal/domains/entities"
+	"github.com/yelaco/ludofy/internal/matchmaking"
+)
+
+var matchmakingClient *matchmaking.Client
+
+func init() {
+	cfg, _ := config.LoadDefaultConfig(context.Background())
+	matchmakingClient = matchmaking.NewClient(cfg)
+}
+
+// handler runs on a schedule and seats bots against the players who waited
+// in the queue longer than BOT_FALLBACK_AFTER, so that they get a match
+// without polling the matchmaking endpoint again
+func handler(ctx context.Context, event events.CloudWatchEvent) error {
+	botFallbackAfter := matchmakingClient.BotFallbackAfter()
+	if botFallbackAfter <= 0 {
+		return nil
+	}
+
+	tickets, err := matchmakingClient.Storage().ScanQueuedMatchmakingTickets(ctx, time.Now().Add(-botFallbackAfter))
+	if err != nil {
+		return fmt.Errorf("failed to scan matchmaking tickets: %w", err)
+	}
+	if len(tickets) == 0 {
+		return nil
+	}
+
+	serverIp, err := matchmakingClient.GetServerIp(ctx)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, ticket := range tickets {
+		if err := fillWithBots(ctx, ticket, serverIp); err != nil {
+			errs = append(errs, fmt.Errorf("[userId: %s] - %w", ticket.UserId, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func fillWithBots(ctx context.Context, ticket entities.MatchmakingTicket, serverIp string) error {
+	players := append(matchmakingClient.Bots(), entities.Player{Id: ticket.UserId})
+
+	match, err := matchmakingClient.CreateMatch(ctx, players, ticket.GameMode, serverIp)
+	if err != nil {
+		// The ticket was taken by a match with other players meanwhile
+		var canceled *types.TransactionCanceledException
+		if errors.As(err, &canceled) {
+			log.Printf("ticket of %s already matched", ticket.UserId)
+			return nil
+		}
+		return fmt.Errorf("failed to create match: %w", err)
+	}
+	matchRespJson, err := json.Marshal(dtos.ActiveMatchResponseFromEntity(match))
+	if err != nil {
+		return fmt.Errorf("failed to marshal response: %w", err)
+	}
+	if err := matchmakingClient.NotifyQueueingUser(ctx, ticket.UserId, matchRespJson); err != nil {
+		return fmt.Errorf("failed to notify queueing user: %w", err)
+	}
+	return nil
+}
+
+func main() {
+	lambda.Start(handler)
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"sort"
@@ -39,13 +40,25 @@ func handler(ctx context.Context, event json.RawMessage) error {
 	if err != nil {
 		return fmt.Errorf("failed to delete active match: %w", err)
 	}
+	// Match ends are delivered at least once and an earlier delivery may have
+	// failed after putting the record, so every step below is idempotent and
+	// only the ratings are skipped once the record is marked as rated
+	rated := false
 	err = storageClient.PutMatchRecord(ctx, matchRecord)
 	if err != nil {
-		return fmt.Errorf("failed to put match record: %w", err)
+		if !errors.Is(err, storage.ErrMatchRecordAlreadyExisted) {
+			return fmt.Errorf("failed to put match record: %w", err)
+		}
+		existing, err := storageClient.GetMatchRecord(ctx, matchRecord.MatchId)
+		if err != nil {
+			return fmt.Errorf("failed to get match record: %w", err)
+		}
+		rated = existing.Rated
 	}
 
+	// The players may be in another match by now
 	for _, player := range matchRecord.Players {
-		err := storageClient.DeleteUserMatch(ctx, player.GetPlayerId())
+		err := storageClient.DeleteUserMatchOfMatch(ctx, player.GetPlayerId(), matchRecord.MatchId)
 		if err != nil {
 			return fmt.Errorf(
 				"failed to delete user match: [userId: %s] - %w",
@@ -60,13 +73,37 @@ func handler(ctx context.Context, event json.RawMessage) error {
 		return fmt.Errorf("failed to delete spectator conversation: %w", err)
 	}
 
+	// Matches against bots are unrated
+	if rated || len(matchRecordReq.Bots) > 0 {
+		return nil
+	}
+
+	userRatings, matchResults, err := rateMatch(ctx, matchRecordReq, matchRecord)
+	if err != nil {
+		return err
+	}
+	err = storageClient.TransactRateMatch(ctx, matchRecord.MatchId, userRatings, matchResults, 24*time.Hour)
+	if err != nil && !errors.Is(err, storage.ErrMatchRecordAlreadyRated) {
+		return fmt.Errorf("failed to rate match: %w", err)
+	}
+	return nil
+}
+
+// rateMatch computes the new ratings of the players of the match with the
+// rating algorithm, and their match results for glicko. They are written
+// together with the Rated flag of the match record
+func rateMatch(
+	ctx context.Context,
+	matchRecordReq server.MatchRecordRequest,
+	matchRecord entities.MatchRecord,
+) ([]entities.UserRating, []entities.MatchResult, error) {
 	switch ratingAlgorithm {
 	case "glicko":
 		userRatings := make([]entities.UserRating, 0, len(matchRecord.Players))
 		for _, player := range matchRecord.Players {
 			userRating, err := storageClient.GetUserRating(ctx, player.GetPlayerId())
 			if err != nil {
-				return fmt.Errorf(
+				return nil, nil, fmt.Errorf(
 					"failed to get user rating: [userId: %s] - %w",
 					player.GetPlayerId(),
 					err,
@@ -75,7 +112,7 @@ func handler(ctx context.Context, event json.RawMessage) error {
 			userRatings = append(userRatings, userRating)
 		}
 		if len(userRatings) != 2 {
-			return fmt.Errorf("expect 2 players for glicko ranking system")
+			return nil, nil, fmt.Errorf("expect 2 players for glicko ranking system")
 		}
 
 		newUserRatings := make([]entities.UserRating, 0, len(userRatings))
@@ -83,7 +120,7 @@ func handler(ctx context.Context, event json.RawMessage) error {
 			opponentRating := userRatings[1-i]
 			matchResults, _, err := storageClient.FetchMatchResults(ctx, opponentRating.UserId, nil, 100)
 			if err != nil {
-				return fmt.Errorf("failed to fetch match results: %w", err)
+				return nil, nil, fmt.Errorf("failed to fetch match results: %w", err)
 			}
 
 			opponentRatings := make([]entities.UserRating, 0, len(matchResults)+1)
@@ -107,19 +144,12 @@ func handler(ctx context.Context, event json.RawMessage) error {
 				Rating:       newRating,
 				RD:           newRD,
 			}
-			err = storageClient.PutUserRating(ctx, newUserRating)
-			if err != nil {
-				return fmt.Errorf(
-					"failed to put user rating: [userId: %s] - %w",
-					userRating.UserId,
-					err,
-				)
-			}
 			newUserRatings = append(newUserRatings, newUserRating)
 		}
 
+		matchResults := make([]entities.MatchResult, 0, len(newUserRatings))
 		for i, userRating := range newUserRatings {
-			playerMatchResult := entities.MatchResult{
+			matchResults = append(matchResults, entities.MatchResult{
 				UserId:         userRating.UserId,
 				MatchId:        matchRecordReq.MatchId,
 				OpponentId:     newUserRatings[1-i].UserId,
@@ -127,17 +157,14 @@ func handler(ctx context.Context, event json.RawMessage) error {
 				OpponentRD:     userRatings[1-i].Rating,
 				Result:         matchRecord.Players[i].GetResult(),
 				Timestamp:      matchRecordReq.EndedAt.Format(time.RFC3339Nano),
-			}
-			err = storageClient.PutMatchResult(ctx, playerMatchResult, 24*time.Hour)
-			if err != nil {
-				return fmt.Errorf(
-					"failed to put user match result: [userId: %s] - %w",
-					userRating.UserId,
-					err,
-				)
-			}
+			})
 		}
+		return newUserRatings, matchResults, nil
 	case "trueskill":
+		if len(matchRecordReq.Teams) > 0 {
+			userRatings, err := rateTeams(ctx, matchRecordReq.Teams)
+			return userRatings, nil, err
+		}
 		playerRecords := matchRecord.Players
 		sort.Slice(playerRecords, func(i, j int) bool {
 			return playerRecords[i].GetResult() > playerRecords[j].GetResult()
@@ -147,7 +174,7 @@ func handler(ctx context.Context, event json.RawMessage) error {
 		for _, player := range playerRecords {
 			userRating, err := storageClient.GetUserRating(ctx, player.GetPlayerId())
 			if err != nil {
-				return fmt.Errorf(
+				return nil, nil, fmt.Errorf(
 					"failed to get user rating: [userId: %s] - %w",
 					player.GetPlayerId(),
 					err,
@@ -164,23 +191,71 @@ func handler(ctx context.Context, event json.RawMessage) error {
 		draw := false
 		newRatings, _ := tsCfg.AdjustSkills(players, draw)
 
+		newUserRatings := make([]entities.UserRating, 0, len(newRatings))
 		for i, newRating := range newRatings {
-			err = storageClient.PutUserRating(ctx, entities.UserRating{
+			newUserRatings = append(newUserRatings, entities.UserRating{
 				UserId:       userRatings[i].UserId,
 				PartitionKey: "UserRatings",
 				Rating:       newRating.Mu(),
 				Sigma:        newRating.Sigma(),
 			})
+		}
+		return newUserRatings, nil, nil
+	}
+
+	return nil, nil, nil
+}
+
+// rateTeams computes the new ratings of the players by the placements of
+// their teams with TrueSkill
+func rateTeams(ctx context.Context, teamRecords []server.TeamRecord) ([]entities.UserRating, error) {
+	userRatings := make([][]entities.UserRating, 0, len(teamRecords))
+	teams := make([][]ts.Player, 0, len(teamRecords))
+	placements := make([]int, 0, len(teamRecords))
+	draw := false
+	for i, teamRecord := range teamRecords {
+		teamRatings := make([]entities.UserRating, 0, len(teamRecord.PlayerIds))
+		team := make([]ts.Player, 0, len(teamRecord.PlayerIds))
+		for _, playerId := range teamRecord.PlayerIds {
+			userRating, err := storageClient.GetUserRating(ctx, playerId)
 			if err != nil {
-				return fmt.Errorf(
-					"failed to put user rating: %w",
+				return nil, fmt.Errorf(
+					"failed to get user rating: [userId: %s] - %w",
+					playerId,
 					err,
 				)
 			}
+			teamRatings = append(teamRatings, userRating)
+			team = append(team, ts.NewPlayer(userRating.Rating, userRating.Sigma))
+		}
+		for _, other := range teamRecords[:i] {
+			draw = draw || other.Placement == teamRecord.Placement
 		}
+		userRatings = append(userRatings, teamRatings)
+		teams = append(teams, team)
+		placements = append(placements, teamRecord.Placement)
+	}
+	if len(teams) < 2 {
+		return nil, fmt.Errorf("expect at least 2 teams for trueskill ranking system")
 	}
 
-	return nil
+	tsCfg := ts.New(ts.DrawProbabilityZero())
+	if draw {
+		tsCfg = ts.New()
+	}
+	newRatings := ranking.AdjustTeamSkills(tsCfg, teams, placements)
+	var newUserRatings []entities.UserRating
+	for i, team := range newRatings {
+		for j, newRating := range team {
+			newUserRatings = append(newUserRatings, entities.UserRating{
+				UserId:       userRatings[i][j].UserId,
+				PartitionKey: "UserRatings",
+				Rating:       newRating.Mu(),
+				Sigma:        newRating.Sigma(),
+			})
+		}
+	}
+	return newUserRatings, nil
 }
 
 func main() {
@@ -7,60 +7,36 @@ import (
 	"fmt"
 	"net/http"
 	"os"
-	"strconv"
 	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
-	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/apigatewaymanagementapi"
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
-	"github.com/aws/aws-sdk-go-v2/service/ec2"
-	"github.com/aws/aws-sdk-go-v2/service/ecs"
 	"github.com/yelaco/ludofy/internal/aws/auth"
 	"github.com/yelaco/ludofy/internal/aws/compute"
 	"github.com/yelaco/ludofy/internal/aws/storage"
 	"github.com/yelaco/ludofy/internal/domains/dtos"
 	"github.com/yelaco/ludofy/internal/domains/entities"
-	"github.com/yelaco/ludofy/pkg/utils"
+	"github.com/yelaco/ludofy/internal/matchmaking"
 )
 
 var (
-	storageClient    *storage.Client
-	computeClient    *compute.Client
-	apigatewayClient *apigatewaymanagementapi.Client
+	matchmakingClient *matchmaking.Client
+	storageClient     *storage.Client
+	computeClient     *compute.Client
 
-	clusterName       = os.Getenv("SERVER_CLUSTER_NAME")
-	serviceName       = os.Getenv("SERVER_SERVICE_NAME")
-	region            = os.Getenv("AWS_REGION")
-	websocketApiId    = os.Getenv("WEBSOCKET_API_ID")
-	websocketApiStage = os.Getenv("WEBSOCKET_API_STAGE")
-	deploymentStage   = os.Getenv("DEPLOYMENT_STAGE")
+	deploymentStage = os.Getenv("DEPLOYMENT_STAGE")
 
 	ErrNoMatchFound       = errors.New("failed to matchmaking")
 	ErrInvalidGameMode    = errors.New("invalid game mode")
 	ErrServerNotAvailable = errors.New("server not available")
-
-	matchSize   = 2
-	apiEndpoint = fmt.Sprintf("https://%s.execute-api.%s.amazonaws.com/%s", websocketApiId, region, websocketApiStage)
 )
 
 func init() {
 	cfg, _ := config.LoadDefaultConfig(context.Background())
-	storageClient = storage.NewClient(dynamodb.NewFromConfig(cfg))
-	computeClient = compute.NewClient(
-		ecs.NewFromConfig(cfg),
-		ec2.NewFromConfig(cfg),
-		nil,
-	)
-	apigatewayClient = apigatewaymanagementapi.New(apigatewaymanagementapi.Options{
-		BaseEndpoint: aws.String(apiEndpoint),
-		Region:       region,
-		Credentials:  cfg.Credentials,
-	})
-	matchSizeStr := os.Getenv("MATCH_SIZE")
-	matchSize, _ = strconv.Atoi(matchSizeStr)
+	matchmakingClient = matchmaking.NewClient(cfg)
+	storageClient = matchmakingClient.Storage()
+	computeClient = matchmakingClient.Compute()
 }
 
 func handler(
@@ -73,7 +49,7 @@ func handler(
 	userId := auth.MustAuth(event.RequestContext.Authorizer)
 
 	// Start game server beforehand if none available
-	err := computeClient.CheckAndStartTask(ctx, clusterName, serviceName)
+	err := computeClient.CheckAndStartTask(ctx, matchmakingClient.ClusterName(), matchmakingClient.ServiceName())
 	if err != nil {
 		return events.APIGatewayProxyResponse{
 			StatusCode: http.StatusInternalServerError,
@@ -119,8 +95,8 @@ func handler(
 		for range 5 {
 			serverIp, err = computeClient.CheckAndGetNewServerIp(
 				ctx,
-				clusterName,
-				serviceName,
+				matchmakingClient.ClusterName(),
+				matchmakingClient.ServiceName(),
 				activeMatch.Server,
 			)
 			if err == nil {
@@ -142,6 +118,19 @@ func handler(
 		}, nil
 	}
 
+	// Keep the queue time of the player across matchmaking attempts
+	ticket.QueuedAt = time.Now()
+	queuedTicket, err := storageClient.GetMatchmakingTicket(ctx, userId)
+	if err != nil {
+		if !errors.Is(err, storage.ErrMatchmakingTicketNotFound) {
+			return events.APIGatewayProxyResponse{
+				StatusCode: http.StatusInternalServerError,
+			}, fmt.Errorf("failed to get matchmaking ticket: %w", err)
+		}
+	} else if queuedTicket.GameMode == ticket.GameMode && !queuedTicket.QueuedAt.IsZero() {
+		ticket.QueuedAt = queuedTicket.QueuedAt
+	}
+
 	// Attempt matchmaking
 	playerIds, err := findMatchingPlayers(ctx, ticket)
 	if err != nil {
@@ -149,9 +138,19 @@ func handler(
 			StatusCode: http.StatusInternalServerError,
 		}, fmt.Errorf("failed to find matching players: %w", err)
 	}
+	players := make([]entities.Player, 0, matchmakingClient.MatchSize())
+	for _, playerId := range playerIds {
+		players = append(players, entities.Player{Id: playerId})
+	}
+
+	// Fill the seats with bots once the player waited long enough
+	botFallbackAfter := matchmakingClient.BotFallbackAfter()
+	if len(players) == 0 && botFallbackAfter > 0 && time.Since(ticket.QueuedAt) >= botFallbackAfter {
+		players = append(players, matchmakingClient.Bots()...)
+	}
 
 	// If no match found, queue the player by caching the matchmaking ticket
-	if len(playerIds) == 0 {
+	if len(players) == 0 {
 		return events.APIGatewayProxyResponse{
 			StatusCode: http.StatusAccepted,
 			Body:       "Queued",
@@ -159,25 +158,18 @@ func handler(
 	}
 
 	// Retrieve ip address of an available server
-	var serverIp string
-	for range 5 {
-		serverIp, err = computeClient.GetServerIp(ctx, clusterName, serviceName)
-		if err == nil {
-			break
-		}
-		time.Sleep(5 * time.Second)
-	}
+	serverIp, err := matchmakingClient.GetServerIp(ctx)
 	if err != nil {
 		return events.APIGatewayProxyResponse{
 			StatusCode: http.StatusInternalServerError,
-		}, fmt.Errorf("failed to get server ip: %w", err)
+		}, err
 	}
 
 	// Try to create new match
-	playerIds = append(playerIds, userId)
-	match, err := createMatch(
+	players = append(players, entities.Player{Id: userId})
+	match, err := matchmakingClient.CreateMatch(
 		ctx,
-		playerIds,
+		players,
 		ticket.GameMode,
 		serverIp,
 	)
@@ -196,8 +188,11 @@ func handler(
 	}
 
 	// Notify the other players about the match
-	for _, playerId := range playerIds {
-		err = notifyQueueingUser(ctx, playerId, matchRespJson)
+	for _, player := range players {
+		if player.IsBot {
+			continue
+		}
+		err = matchmakingClient.NotifyQueueingUser(ctx, player.Id, matchRespJson)
 		if err != nil {
 			return events.APIGatewayProxyResponse{
 				StatusCode: http.StatusInternalServerError,
@@ -218,6 +213,7 @@ func findMatchingPlayers(
 	[]string,
 	error,
 ) {
+	matchSize := matchmakingClient.MatchSize()
 	tickets, err := storageClient.ScanMatchmakingTickets(ctx, ticket, matchSize-1)
 	if err != nil {
 		return nil, fmt.Errorf("failed to scan matchmaking tickets: %w", err)
@@ -237,73 +233,6 @@ func findMatchingPlayers(
 	return opponentIds, nil
 }
 
-func createMatch(
-	ctx context.Context,
-	playerIds []string,
-	gameMode string,
-	serverIp string,
-) (
-	entities.ActiveMatch,
-	error,
-) {
-	match := entities.ActiveMatch{
-		MatchId:        utils.GenerateUUID(),
-		ConversationId: utils.GenerateUUID(),
-		PartitionKey:   "ActiveMatches",
-		GameMode:       gameMode,
-		Server:         serverIp,
-		CreatedAt:      time.Now(),
-	}
-
-	for _, playerId := range playerIds {
-		match.Players = append(match.Players, entities.Player{
-			Id: playerId,
-		})
-	}
-
-	// Save match information
-	if err := storageClient.TransactCreateMatch(ctx, match); err != nil {
-		return entities.ActiveMatch{}, fmt.Errorf("failed to transact create match: %w", err)
-	}
-
-	// Create a conversation for spectators
-	err := storageClient.PutSpectatorConversation(
-		ctx,
-		entities.SpectatorConversation{
-			MatchId:        match.MatchId,
-			ConversationId: utils.GenerateUUID(),
-		},
-	)
-	if err != nil {
-		return entities.ActiveMatch{}, fmt.Errorf("failed to put spectator conversation: %w", err)
-	}
-
-	return match, nil
-}
-
-func notifyQueueingUser(ctx context.Context, userId string, data []byte) error {
-	connection, err := storageClient.GetConnectionByUserId(ctx, userId)
-	if err != nil {
-		if errors.Is(err, storage.ErrConnectionNotFound) {
-			return nil
-		}
-		return fmt.Errorf("failed to get connection: %w", err)
-	}
-
-	_, err = apigatewayClient.PostToConnection(
-		ctx,
-		&apigatewaymanagementapi.PostToConnectionInput{
-			ConnectionId: aws.String(connection.Id),
-			Data:         data,
-		},
-	)
-	if err != nil {
-		return fmt.Errorf("failed to post to connect: %w", err)
-	}
-
-	return nil
-}
-
 func main() {
 	lambda.Start(handler)
 }
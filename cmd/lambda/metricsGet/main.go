@@ -65,7 +65,7 @@ func handler(
 
 	serverMetricsList := make([]dtos.ServerMetricsResponse, 0, len(serverIps))
 	for _, serverIp := range serverIps {
-		status, err := computeClient.GetServerStatus(serverIp, 7202)
+		status, err := computeClient.GetServerStatus(ctx, serverIp)
 		if err != nil {
 			return events.APIGatewayProxyResponse{
 				StatusCode: http.StatusInternalServerError,
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"cmp"
+	"slices"
+
+	"github.com/notnil/chess"
+	"github.com/yelaco/ludofy/internal/domains/entities"
+	"github.com/yelaco/ludofy/pkg/server"
+)
+
+var pieceValues = map[chess.PieceType]int{
+	chess.Pawn:   1,
+	chess.Knight: 3,
+	chess.Bishop: 3,
+	chess.Rook:   5,
+	chess.Queen:  9,
+}
+
+// botAgent plays checkmates first, then the most valuable capture, then the
+// first move in UCI order, so the same position always gets the same move
+type botAgent struct {
+	color chess.Color
+}
+
+func newBotAgent(side Side) server.BotAgent {
+	color := chess.Black
+	if side == WHITE_SIDE {
+		color = chess.White
+	}
+	return &botAgent{color: color}
+}
+
+// Think method    answers the game states where it is the turn of the bot
+func (a *botAgent) Think(bot *server.BotPlayer, msg interface{}) (server.Move, bool) {
+	resp, ok := msg.(matchResponse)
+	if !ok || resp.Type != "gameState" || resp.GameState.Outcome != chess.NoOutcome.String() {
+		return nil, false
+	}
+	withFen, err := chess.FEN(resp.GameState.Fen)
+	if err != nil {
+		return nil, false
+	}
+	game := chess.NewGame(withFen, chess.UseNotation(chess.UCINotation{}))
+	if game.Position().Turn() != a.color {
+		return nil, false
+	}
+	best := a.bestMove(game)
+	if best == nil {
+		return nil, false
+	}
+	move := NewMove(bot.GetId())
+	move.Uci = chess.UCINotation{}.Encode(game.Position(), best)
+	move.CreatedAt = bot.Match().Now().Add(bot.ThinkTime())
+	return move, true
+}
+
+func (a *botAgent) bestMove(game *chess.Game) *chess.Move {
+	moves := game.ValidMoves()
+	slices.SortFunc(moves, func(x, y *chess.Move) int {
+		return cmp.Compare(x.String(), y.String())
+	})
+	var best *chess.Move
+	bestScore := -1
+	for _, move := range moves {
+		score := 0
+		if next := game.Position().Update(move); next.Status() == chess.Checkmate {
+			return move
+		}
+		if move.HasTag(chess.Capture) {
+			score = pieceValues[game.Position().Board().Piece(move.S2()).Type()]
+		}
+		if score > bestScore {
+			best, bestScore = move, score
+		}
+	}
+	return best
+}
+
+// newSeat creates the player of a seat, bots are played by a botAgent
+func newSeat(matchId string, player entities.Player, side Side, cfg MatchConfig) server.Player {
+	if player.IsBot {
+		return server.NewBotPlayer(player.Id, matchId, newBotAgent(side), cfg.BotThinkTime)
+	}
+	return server.NewDefaultPlayer(player.Id, matchId)
+}
+
+// seatOrder puts the humans first, they play white so the match starts when
+// they join instead of when the bot is loaded
+func seatOrder(players []entities.Player) []entities.Player {
+	ordered := slices.Clone(players)
+	slices.SortStableFunc(ordered, func(x, y entities.Player) int {
+		switch {
+		case !x.IsBot && y.IsBot:
+			return -1
+		case x.IsBot && !y.IsBot:
+			return 1
+		}
+		return 0
+	})
+	return ordered
+}
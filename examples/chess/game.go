@@ -63,15 +63,15 @@ func RestoreGame(gameState string) (*Game, error) {
 	}, nil
 }
 
-func (g *Game) OfferDraw(side chess.Color) bool {
+func (g *Game) OfferDraw(side chess.Color, now time.Time) bool {
 	if g.drawOffer != nil && g.drawOffer.Side != side &&
-		time.Now().Before(g.drawOffer.Timestamp.Add(20*time.Second)) {
+		now.Before(g.drawOffer.Timestamp.Add(20*time.Second)) {
 		g.Draw(chess.DrawOffer)
 		return true
 	}
 	g.drawOffer = &drawOffer{
 		Side:      side,
-		Timestamp: time.Now(),
+		Timestamp: now,
 	}
 	return false
 }
@@ -1,15 +1,32 @@
 package main
 
 import (
+	"os"
+
 	"github.com/yelaco/ludofy/pkg/logging"
 	"github.com/yelaco/ludofy/pkg/server"
+	"github.com/yelaco/ludofy/pkg/utils"
 	"go.uber.org/zap"
 )
 
 // Run server
 func main() {
-	serverHandler := NewServerHandler()
+	if len(os.Args) >= 3 && os.Args[1] == "replay" {
+		if err := replay(os.Args[2:]...); err != nil {
+			logging.Fatal("replay error", zap.Error(err))
+		}
+		return
+	}
+
+	serverHandler := NewServerHandler(utils.RealClock)
 	cfg := server.NewConfig("7202", serverHandler)
+	cfg.Clock = utils.RealClock
+	cfg.Router = NewRouter(serverHandler)
+	if err := server.RegisterMetrics(gamesEnded); err != nil {
+		logging.Fatal("failed to register metrics", zap.Error(err))
+	}
 	srv := server.NewFromConfig(cfg)
-	logging.Fatal("server runtime error", zap.Error(srv.Start()))
+	if err := srv.Start(); err != nil {
+		logging.Fatal("server runtime error", zap.Error(err))
+	}
 }
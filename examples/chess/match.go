@@ -10,6 +10,7 @@ import (
 	"github.com/notnil/chess"
 	"github.com/yelaco/ludofy/pkg/logging"
 	"github.com/yelaco/ludofy/pkg/server"
+	"github.com/yelaco/ludofy/pkg/utils"
 	"go.uber.org/zap"
 )
 
@@ -17,7 +18,8 @@ type Match struct {
 	server.Match
 	cfg   MatchConfig
 	game  *Game
-	timer *time.Timer
+	clock utils.Clock
+	timer utils.ClockTimer
 
 	StartedAt time.Time
 }
@@ -28,6 +30,9 @@ type MatchConfig struct {
 	CancelTimeout      time.Duration
 	DisconnectTimeout  time.Duration
 	MaxLagForgivenTime time.Duration
+	BotThinkTime       time.Duration
+	PauseBudget        time.Duration
+	MaxPauseDuration   time.Duration
 }
 
 type GameMode struct {
@@ -35,6 +40,8 @@ type GameMode struct {
 	Increment time.Duration
 }
 
+const clockTimer = "clock"
+
 var gameModes = []string{
 	"1+0", "1+1", "1+2", // Bullet
 	"2+1", "2+2", // Bullet
@@ -111,11 +118,9 @@ func (m *Match) setTimer(d time.Duration) {
 		)
 		return
 	}
-	m.timer = time.NewTimer(d)
-	go func() {
-		<-m.timer.C
-		m.End()
-	}()
+	m.timer = m.clock.AfterFunc(d, func() {
+		m.FireTimer(clockTimer)
+	})
 	logging.Info(
 		"clock set",
 		zap.String("match_id", m.GetId()),
@@ -152,13 +157,33 @@ func (m *Match) getCurrentTurnPlayer() *Player {
 }
 
 func (m *Match) calculateLagForgiven(moveCreatedAt time.Time) time.Duration {
-	lagTime := time.Since(moveCreatedAt)
+	lagTime := m.Now().Sub(moveCreatedAt)
 	if lagTime > m.cfg.MaxLagForgivenTime {
 		return m.cfg.MaxLagForgivenTime
 	}
 	return lagTime
 }
 
+// clockRemaining method    returns the time left on the clock of the current
+// turn
+func (m *Match) clockRemaining() time.Duration {
+	current := m.getCurrentTurnPlayer()
+	if current.TurnStartedAt.IsZero() {
+		return current.Clock
+	}
+	return max(current.Clock-m.Now().Sub(current.TurnStartedAt), 0)
+}
+
+// anyDisconnected method    returns true if a player is disconnected
+func (m *Match) anyDisconnected() bool {
+	for _, player := range m.GetPlayers() {
+		if player.GetStatus() == DISCONNECTED {
+			return true
+		}
+	}
+	return false
+}
+
 func (m *Match) checkTimeout() {
 	var players []*Player
 	for _, player := range m.GetPlayers() {
@@ -200,19 +225,10 @@ func (m *Match) checkTimeout() {
 }
 
 func (m *Match) notifyPlayers(resp gameStateResponse) {
-	for _, player := range m.GetPlayers() {
-		err := player.WriteJson(matchResponse{
-			Type:      "gameState",
-			GameState: resp,
-		})
-		if err != nil {
-			logging.Error(
-				"couldn't notify player",
-				zap.String("player_id", player.GetId()),
-				zap.Error(err),
-			)
-		}
-	}
+	m.Broadcast(matchResponse{
+		Type:      "gameState",
+		GameState: resp,
+	})
 }
 
 func (m *Match) sendDrawOfferNotification(sender *Player, status string) {
@@ -223,7 +239,7 @@ func (m *Match) sendDrawOfferNotification(sender *Player, status string) {
 		err := player.WriteJson(drawOfferResponse{
 			Type:      "drawOffer",
 			Status:    status,
-			CreatedAt: time.Now().Format(time.RFC3339),
+			CreatedAt: m.Now().Format(time.RFC3339),
 		})
 		if err != nil {
 			logging.Error("couldn't send draw offer", zap.Error(err))
@@ -241,6 +257,9 @@ func ConfigForGameMode(gameMode string) (MatchConfig, error) {
 		ClockIncrement:    gm.Increment,
 		CancelTimeout:     30 * time.Second,
 		DisconnectTimeout: 120 * time.Second,
+		BotThinkTime:      time.Second,
+		PauseBudget:       3 * time.Minute,
+		MaxPauseDuration:  time.Minute,
 	}, nil
 }
 
@@ -254,12 +273,26 @@ type MyMatchHandler struct {
 func (h *MyMatchHandler) OnPlayerJoin(playerInterface server.Player) (bool, error) {
 	match := h.GetMatch().(*Match)
 	player := playerInterface.(*Player)
-	if player.GetStatus() == INIT && player.Side == WHITE_SIDE {
-		match.StartedAt = time.Now()
+	// Matches restored from a snapshot have started already
+	if player.GetStatus() == INIT && player.Side == WHITE_SIDE && match.StartedAt.IsZero() {
+		match.StartedAt = match.Now()
 		player.TurnStartedAt = match.StartedAt
-		match.setTimer(match.cfg.MatchDuration)
+		// The clock starts when the match resumes
+		if !match.IsPaused() {
+			match.setTimer(match.cfg.MatchDuration)
+		}
 		return true, nil
 	}
+	// The disconnect timeout is over once every player is back
+	if player.GetStatus() == DISCONNECTED && !match.StartedAt.IsZero() &&
+		!match.IsEnded() && !match.IsPaused() {
+		for _, other := range match.GetPlayers() {
+			if other.GetId() != player.GetId() && other.GetStatus() == DISCONNECTED {
+				return false, nil
+			}
+		}
+		match.setTimer(match.clockRemaining())
+	}
 	return false, nil
 }
 
@@ -267,7 +300,8 @@ func (h *MyMatchHandler) OnPlayerLeave(playerInterface server.Player) error {
 	match := h.GetMatch().(*Match)
 	currentClock := match.getCurrentTurnPlayer().Clock
 
-	if !match.IsEnded() {
+	// Paused clocks are set again on resume
+	if !match.IsEnded() && !match.IsPaused() {
 		allDisconnected := true
 		for _, player := range match.GetPlayers() {
 			if player.GetStatus() != DISCONNECTED {
@@ -318,6 +352,39 @@ func (h *MyMatchHandler) OnPlayerSync(playerInterface server.Player) error {
 	return nil
 }
 
+func (h *MyMatchHandler) OnSpectatorJoin(spectator server.Spectator) error {
+	match := h.GetMatch().(*Match)
+
+	resp := matchResponse{
+		Type: "gameState",
+		GameState: gameStateResponse{
+			Outcome:      match.game.outcome().String(),
+			Method:       match.game.method(),
+			Fen:          match.game.FEN(),
+			PlayerStates: make([]playerStateResponse, 0, len(match.GetPlayers())),
+		},
+	}
+
+	for _, player := range match.GetPlayers() {
+		resp.GameState.PlayerStates = append(resp.GameState.PlayerStates, playerStateResponse{
+			Id:     player.GetId(),
+			Status: player.GetStatus(),
+			Clock:  player.(*Player).Clock.String(),
+		})
+	}
+
+	err := spectator.WriteJson(resp)
+	if err != nil {
+		return fmt.Errorf("couldn't sync spectator: %w", err)
+	}
+	return nil
+}
+
+// OnSpectatorBroadcast method    chess has no hidden information, spectators see every broadcast
+func (h *MyMatchHandler) OnSpectatorBroadcast(msg interface{}) (interface{}, bool) {
+	return msg, true
+}
+
 func (h *MyMatchHandler) HandleMove(
 	playerInterface server.Player,
 	moveInterface server.Move,
@@ -338,7 +405,7 @@ func (h *MyMatchHandler) HandleMove(
 	case RESIGN:
 		match.game.Resign(player.Color())
 	case OFFER_DRAW:
-		draw := match.game.OfferDraw(player.Color())
+		draw := match.game.OfferDraw(player.Color(), match.Now())
 		if !draw {
 			match.sendDrawOfferNotification(player, DRAW_PENDING)
 			return nil
@@ -372,7 +439,7 @@ func (h *MyMatchHandler) HandleMove(
 		}
 
 		// If making move, update clock
-		timeTaken := time.Since(player.TurnStartedAt)
+		timeTaken := match.Now().Sub(player.TurnStartedAt)
 		lagForgiven := match.calculateLagForgiven(move.CreatedAt)
 		player.UpdateClock(timeTaken, lagForgiven, match.cfg.ClockIncrement)
 
@@ -383,7 +450,7 @@ func (h *MyMatchHandler) HandleMove(
 		} else {
 			// else next turn
 			currentTurnPlayer := match.getCurrentTurnPlayer()
-			currentTurnPlayer.TurnStartedAt = time.Now()
+			currentTurnPlayer.TurnStartedAt = match.Now()
 			match.setTimer(currentTurnPlayer.Clock)
 			logging.Info(
 				"new turn",
@@ -408,9 +475,6 @@ func (h *MyMatchHandler) HandleMove(
 	}
 	match.notifyPlayers(gameStateResp)
 
-	// Save game state
-	match.Save()
-
 	// Aborted because both player had disconnected
 	if match.IsEnded() {
 		return nil
@@ -438,9 +502,11 @@ func (h *MyMatchHandler) OnMatchSave() error {
 
 func (h *MyMatchHandler) OnMatchEnd() error {
 	match := h.GetMatch().(*Match)
+	match.skipTimer()
+	match.checkTimeout()
 	for _, p := range match.GetPlayers() {
 		player := p.(*Player)
-		switch match.game.Outcome() {
+		switch match.game.outcome() {
 		case chess.WhiteWon:
 			if player.Side == WHITE_SIDE {
 				player.SetResult(1)
@@ -457,8 +523,75 @@ func (h *MyMatchHandler) OnMatchEnd() error {
 			player.SetResult(0.5)
 		}
 	}
-	match.skipTimer()
-	match.checkTimeout()
+	gamesEnded.WithLabelValues(match.game.method()).Inc()
+	return nil
+}
+
+// OnTimer method    ends the game when the clock of the current turn runs out
+func (h *MyMatchHandler) OnTimer(name string) error {
+	match := h.GetMatch().(*Match)
+	if name != clockTimer || match.IsPaused() {
+		return nil
+	}
+	if !match.StartedAt.IsZero() && !match.anyDisconnected() && match.clockRemaining() <= 0 {
+		match.game.OutOfTime(match.getCurrentTurnPlayer().Side)
+	}
+	match.End()
+	return nil
+}
+
+// OnPause method    stops the clock of the current turn
+func (h *MyMatchHandler) OnPause() error {
+	match := h.GetMatch().(*Match)
+	if match.timer != nil {
+		match.timer.Stop()
+	}
+	logging.Info("clock stopped", zap.String("match_id", match.GetId()))
+	return nil
+}
+
+// OnResume method    restarts the clock of the current turn without the time
+// spent paused, disconnected players still have to come back in time
+func (h *MyMatchHandler) OnResume(pausedFor time.Duration) error {
+	match := h.GetMatch().(*Match)
+	if match.IsEnded() {
+		return nil
+	}
+	if match.StartedAt.IsZero() {
+		match.setTimer(match.cfg.CancelTimeout)
+		return nil
+	}
+
+	current := match.getCurrentTurnPlayer()
+	if !current.TurnStartedAt.IsZero() {
+		current.TurnStartedAt = current.TurnStartedAt.Add(pausedFor)
+	}
+	remaining := match.clockRemaining()
+	allDisconnected := true
+	for _, player := range match.GetPlayers() {
+		if player.GetStatus() != DISCONNECTED {
+			allDisconnected = false
+		}
+	}
+	if match.anyDisconnected() && !allDisconnected {
+		remaining = min(remaining, match.cfg.DisconnectTimeout)
+	}
+	match.setTimer(remaining)
+
+	gameStateResp := gameStateResponse{
+		Outcome:      match.game.outcome().String(),
+		Method:       match.game.method(),
+		Fen:          match.game.FEN(),
+		PlayerStates: make([]playerStateResponse, 0, len(match.GetPlayers())),
+	}
+	for _, player := range match.GetPlayers() {
+		gameStateResp.PlayerStates = append(gameStateResp.PlayerStates, playerStateResponse{
+			Id:     player.GetId(),
+			Status: player.GetStatus(),
+			Clock:  player.(*Player).Clock.String(),
+		})
+	}
+	match.notifyPlayers(gameStateResp)
 	return nil
 }
 
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/yelaco/ludofy/pkg/server"
+	"github.com/yelaco/ludofy/pkg/server/servertest"
+	"github.com/yelaco/ludofy/pkg/utils"
+)
+
+// step is an input of a test match, a game action of the player, a player
+// leaving or the clock moving on
+type step struct {
+	playerId string
+	action   string
+	move     string
+	leave    bool
+	advance  time.Duration
+}
+
+func play(playerId, move string) step {
+	return step{playerId: playerId, action: "move", move: move}
+}
+
+func newTestMatch(t *testing.T, gameMode string) *servertest.Match {
+	t.Helper()
+	clock := utils.NewFakeClock(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	serverHandler := NewServerHandler(clock)
+	match, err := servertest.NewMatch(server.Config{
+		ServerHandler: serverHandler,
+		Router:        NewRouter(serverHandler),
+		Clock:         clock,
+	}, servertest.NewActiveMatch("m1", gameMode, "alice", "bob"))
+	if err != nil {
+		t.Fatalf("NewMatch: %v", err)
+	}
+	for _, playerId := range []string{"alice", "bob"} {
+		if _, err := match.Join(playerId); err != nil {
+			t.Fatalf("Join %s: %v", playerId, err)
+		}
+	}
+	return match
+}
+
+func TestMatchOutcomes(t *testing.T) {
+	tests := []struct {
+		name        string
+		gameMode    string
+		steps       []step
+		wantOutcome string
+		wantMethod  string
+		// wantResults are the results of alice, who plays white, and bob
+		wantResults [2]float64
+	}{
+		{
+			name: "checkmate",
+			steps: []step{
+				play("alice", "f2f3"),
+				play("bob", "e7e5"),
+				play("alice", "g2g4"),
+				play("bob", "d8h4"),
+			},
+			wantOutcome: "0-1",
+			wantMethod:  "Checkmate",
+			wantResults: [2]float64{0, 1},
+		},
+		{
+			name: "resign",
+			steps: []step{
+				play("alice", "e2e4"),
+				{playerId: "bob", action: "resign"},
+			},
+			wantOutcome: "1-0",
+			wantMethod:  "Resignation",
+			wantResults: [2]float64{1, 0},
+		},
+		{
+			name: "draw by agreement",
+			steps: []step{
+				play("alice", "e2e4"),
+				{playerId: "alice", action: "offerDraw"},
+				{advance: 10 * time.Second},
+				{playerId: "bob", action: "offerDraw"},
+			},
+			wantOutcome: "1/2-1/2",
+			wantMethod:  "DrawOffer",
+			wantResults: [2]float64{0.5, 0.5},
+		},
+		{
+			name:        "out of time",
+			gameMode:    "1+0",
+			steps:       []step{{advance: time.Minute}},
+			wantOutcome: "0-1",
+			wantMethod:  "OUT_OF_TIME",
+			wantResults: [2]float64{0, 1},
+		},
+		{
+			name: "disconnect timeout",
+			steps: []step{
+				play("alice", "e2e4"),
+				{playerId: "bob", leave: true},
+				{advance: 2 * time.Minute},
+			},
+			wantOutcome: "1-0",
+			wantMethod:  "DISCONNECT_TIMEOUT",
+			wantResults: [2]float64{1, 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gameMode := tt.gameMode
+			if gameMode == "" {
+				gameMode = "10+0"
+			}
+			match := newTestMatch(t, gameMode)
+			for _, step := range tt.steps {
+				if err := runStep(match, step); err != nil {
+					t.Fatalf("step %+v: %v", step, err)
+				}
+			}
+			if !match.Ended() {
+				t.Fatal("match didn't end")
+			}
+
+			game := match.Match().GetHandler().GetMatch().(*Match).game
+			if got := game.outcome().String(); got != tt.wantOutcome {
+				t.Errorf("outcome %s, want %s", got, tt.wantOutcome)
+			}
+			if got := game.method(); got != tt.wantMethod {
+				t.Errorf("method %s, want %s", got, tt.wantMethod)
+			}
+			results := map[string]float64{}
+			for _, record := range match.End.Players {
+				results[record["PlayerId"].(string)] = record["Result"].(float64)
+			}
+			if results["alice"] != tt.wantResults[0] || results["bob"] != tt.wantResults[1] {
+				t.Errorf("results %v, want alice %v and bob %v",
+					results, tt.wantResults[0], tt.wantResults[1])
+			}
+		})
+	}
+}
+
+func TestMatchKeepsPlaying(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "expired draw offer",
+			steps: []step{
+				play("alice", "e2e4"),
+				{playerId: "alice", action: "offerDraw"},
+				{advance: 21 * time.Second},
+				{playerId: "bob", action: "offerDraw"},
+			},
+		},
+		{
+			name: "declined draw offer",
+			steps: []step{
+				{playerId: "alice", action: "offerDraw"},
+				{playerId: "bob", action: "declineDraw"},
+				{playerId: "bob", action: "offerDraw"},
+			},
+		},
+		{
+			name: "reconnect before the disconnect timeout",
+			steps: []step{
+				play("alice", "e2e4"),
+				{playerId: "bob", leave: true},
+				{advance: time.Minute},
+				{playerId: "bob"},
+				{advance: 2 * time.Minute},
+			},
+		},
+		{
+			name: "illegal move",
+			steps: []step{
+				play("alice", "e2e5"),
+				play("bob", "e7e5"),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match := newTestMatch(t, "10+0")
+			for _, step := range tt.steps {
+				if err := runStep(match, step); err != nil {
+					t.Fatalf("step %+v: %v", step, err)
+				}
+			}
+			if match.Ended() {
+				t.Fatal("match ended")
+			}
+		})
+	}
+}
+
+// runStep feeds the step to the match, a step without action or move joins
+// the player again
+func runStep(match *servertest.Match, step step) error {
+	switch {
+	case step.advance > 0:
+		match.Advance(step.advance)
+		return nil
+	case step.leave:
+		return match.Leave(step.playerId)
+	case step.action == "":
+		_, err := match.Join(step.playerId)
+		return err
+	}
+	return match.Send(step.playerId, server.Message[GameData]{
+		Type:      "gameData",
+		Data:      GameData{Action: step.action, Move: step.move},
+		CreatedAt: match.Now(),
+	})
+}
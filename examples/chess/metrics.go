@@ -0,0 +1,13 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/yelaco/ludofy/pkg/server"
+)
+
+var gamesEnded = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: server.MetricsNamespace,
+	Subsystem: "chess",
+	Name:      "games_ended_total",
+	Help:      "Chess games ended by method.",
+}, []string{"method"})
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/yelaco/ludofy/pkg/server"
+	"github.com/yelaco/ludofy/pkg/utils"
+)
+
+// replay method    replays a match recording, given as all of its parts for
+// long matches, and prints the final game state
+func replay(paths ...string) error {
+	parts := make([]server.Recording, 0, len(paths))
+	for _, path := range paths {
+		part, err := readRecording(path)
+		if err != nil {
+			return err
+		}
+		parts = append(parts, part)
+	}
+	recording, err := server.JoinRecordings(parts...)
+	if err != nil {
+		return err
+	}
+	if len(recording.Events) == 0 {
+		return fmt.Errorf("empty recording")
+	}
+	clock := utils.NewFakeClock(recording.Events[0].At)
+	serverHandler := NewServerHandler(clock)
+	result, err := server.Replay(server.Config{
+		ServerHandler: serverHandler,
+		Router:        NewRouter(serverHandler),
+		Clock:         clock,
+	}, recording)
+	if err != nil {
+		return fmt.Errorf("failed to replay match: %w", err)
+	}
+
+	match := result.Match.GetHandler().GetMatch().(*Match)
+	fmt.Printf("outcome: %s (%s)\n", match.game.outcome(), match.game.method())
+	fmt.Printf("fen: %s\n", match.game.FEN())
+	for _, player := range match.GetPlayers() {
+		fmt.Printf("player %s: clock %s, result %v\n",
+			player.GetId(),
+			player.(*Player).Clock,
+			player.GetResult(),
+		)
+	}
+	fmt.Printf("saves: %d, ended: %t, aborted: %t\n",
+		len(result.Saves),
+		result.End != nil,
+		result.Aborted,
+	)
+	return nil
+}
+
+func readRecording(path string) (server.Recording, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return server.Recording{}, fmt.Errorf("failed to open recording: %w", err)
+	}
+	defer file.Close()
+	return server.ReadRecording(file)
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/yelaco/ludofy/internal/domains/dtos"
 	"github.com/yelaco/ludofy/internal/domains/entities"
 	"github.com/yelaco/ludofy/pkg/server"
+	"github.com/yelaco/ludofy/pkg/utils"
 )
 
 type Payload struct {
@@ -16,10 +17,31 @@ type Payload struct {
 	CreatedAt time.Time         `json:"createdAt"`
 }
 
+type GameData struct {
+	Action string `json:"action"`
+	Move   string `json:"move"`
+}
+
+func (d GameData) Validate() error {
+	switch d.Action {
+	case "abort", "resign", "offerDraw", "declineDraw":
+		return nil
+	case "move":
+		if d.Move == "" {
+			return fmt.Errorf("missing move")
+		}
+		return nil
+	default:
+		return fmt.Errorf("invalid game action: %s", d.Action)
+	}
+}
+
 /*
  * Implement ServerHandler interface
  */
-type MyServerHandler struct{}
+type MyServerHandler struct {
+	clock utils.Clock
+}
 
 func (h *MyServerHandler) OnMatchCreate(activeMatch entities.ActiveMatch) (server.Match, error) {
 	cfg, err := ConfigForGameMode(activeMatch.GameMode)
@@ -27,18 +49,26 @@ func (h *MyServerHandler) OnMatchCreate(activeMatch entities.ActiveMatch) (serve
 		return nil, fmt.Errorf("failed to get config: %w", err)
 	}
 	players := make(map[string]server.Player, len(activeMatch.Players))
-	for i, player := range activeMatch.Players {
+	for i, player := range seatOrder(activeMatch.Players) {
+		side := Side(i%2 == 0)
 		players[player.Id] = &Player{
-			Player: server.NewDefaultPlayer(player.Id, activeMatch.MatchId),
+			Player: newSeat(activeMatch.MatchId, player, side, cfg),
 			Clock:  cfg.MatchDuration,
-			Side:   i%2 == 0,
+			Side:   side,
 		}
 	}
 	match := Match{
 		Match: server.NewDefaultMatch(activeMatch.MatchId, players),
 		cfg:   cfg,
 		game:  NewGame(),
+		clock: h.clock,
 	}
+	match.SetSavePolicy(server.SavePolicy{EveryMoves: 1})
+	match.SetChatPolicy(server.ChatPolicy{Spectators: true})
+	match.SetPausePolicy(server.PausePolicy{
+		Budget:      cfg.PauseBudget,
+		MaxDuration: cfg.MaxPauseDuration,
+	})
 	match.setTimer(cfg.CancelTimeout)
 	matchHandler := NewMatchHandler(&match)
 	match.SetHandler(matchHandler)
@@ -54,11 +84,12 @@ func (h *MyServerHandler) OnMatchResume(
 		return nil, fmt.Errorf("failed to get config: %w", err)
 	}
 	players := make(map[string]server.Player, len(activeMatch.Players))
-	for i, player := range activeMatch.Players {
+	for i, player := range seatOrder(activeMatch.Players) {
+		side := Side(i%2 == 0)
 		players[player.Id] = &Player{
-			Player: server.NewDefaultPlayer(player.Id, activeMatch.MatchId),
+			Player: newSeat(activeMatch.MatchId, player, side, cfg),
 			Clock:  cfg.MatchDuration,
-			Side:   i%2 == 0,
+			Side:   side,
 		}
 	}
 	game, err := RestoreGame(currentState.GameState.(string))
@@ -69,13 +100,21 @@ func (h *MyServerHandler) OnMatchResume(
 		Match: server.NewDefaultMatch(activeMatch.MatchId, players),
 		cfg:   cfg,
 		game:  game,
+		clock: h.clock,
 	}
+	match.SetSavePolicy(server.SavePolicy{EveryMoves: 1})
+	match.SetChatPolicy(server.ChatPolicy{Spectators: true})
+	match.SetPausePolicy(server.PausePolicy{
+		Budget:      cfg.PauseBudget,
+		MaxDuration: cfg.MaxPauseDuration,
+	})
 	match.setTimer(cfg.CancelTimeout)
 	matchHandler := NewMatchHandler(&match)
 	match.SetHandler(matchHandler)
 	return match, nil
 }
 
+// OnHandleMessage method    receives the messages the router has no route for
 func (h *MyServerHandler) OnHandleMessage(
 	playerId string,
 	matchHandler server.MatchHandler,
@@ -85,32 +124,32 @@ func (h *MyServerHandler) OnHandleMessage(
 	if err := json.Unmarshal(message, &payload); err != nil {
 		return fmt.Errorf("failed to unmarshal message: %w", err)
 	}
-	if payload.CreatedAt.Sub(time.Now()) > 2*time.Second {
+	return fmt.Errorf("%w: %s", server.ErrUnknownMessageType, payload.Type)
+}
+
+func handleGameData(
+	playerId string,
+	matchHandler server.MatchHandler,
+	msg server.Message[GameData],
+) error {
+	if msg.CreatedAt.Sub(matchHandler.GetMatch().Now()) > 2*time.Second {
 		return fmt.Errorf("invalid timestamp")
 	}
-	switch payload.Type {
-	case "gameData":
-		move := NewMove(playerId)
-		action := payload.Data["action"]
-		switch action {
-		case "abort":
-			move.Control = ABORT
-		case "resign":
-			move.Control = RESIGN
-		case "offerDraw":
-			move.Control = OFFER_DRAW
-		case "declineDraw":
-			move.Control = DECLINE_DRAW
-		case "move":
-			move.Uci = payload.Data["move"]
-			move.CreatedAt = payload.CreatedAt
-		default:
-			return fmt.Errorf("invalid game action: %s", payload.Type)
-		}
-		matchHandler.GetMatch().ProcessMove(move)
-	default:
-		return fmt.Errorf("invalid payload type: %s", payload.Type)
+	move := NewMove(playerId)
+	switch msg.Data.Action {
+	case "abort":
+		move.Control = ABORT
+	case "resign":
+		move.Control = RESIGN
+	case "offerDraw":
+		move.Control = OFFER_DRAW
+	case "declineDraw":
+		move.Control = DECLINE_DRAW
+	case "move":
+		move.Uci = msg.Data.Move
+		move.CreatedAt = msg.CreatedAt
 	}
+	matchHandler.GetMatch().ProcessMove(move)
 	return nil
 }
 
@@ -128,7 +167,7 @@ func (h *MyServerHandler) OnHandleMatchEnd(
 		record.Players = append(record.Players, playerRecord)
 	}
 	record.StartedAt = match.StartedAt
-	record.EndedAt = time.Now()
+	record.EndedAt = match.Now()
 	return nil
 }
 
@@ -146,15 +185,26 @@ func (h *MyServerHandler) OnHandleMatchSave(
 			Status: player.GetStatus(),
 		})
 	}
-	matchState.Move = MoveRequest{
-		PlayerId:  lastMove.GetPlayerId(),
-		Uci:       lastMove.Uci,
-		Control:   lastMove.Control,
-		CreatedAt: lastMove.CreatedAt,
+	// Match can be saved before the first move, e.g. when the server drains
+	if lastMove != nil {
+		matchState.Move = MoveRequest{
+			PlayerId:  lastMove.GetPlayerId(),
+			Uci:       lastMove.Uci,
+			Control:   lastMove.Control,
+			CreatedAt: lastMove.CreatedAt,
+		}
 	}
 	return nil
 }
 
-func NewServerHandler() server.ServerHandler {
-	return &MyServerHandler{}
+// NewServerHandler creates the handler, match clocks run on the given clock
+func NewServerHandler(clock utils.Clock) server.ServerHandler {
+	return &MyServerHandler{clock: clock}
+}
+
+func NewRouter(serverHandler server.ServerHandler) *server.Router {
+	router := server.NewRouter()
+	server.Handle(router, "gameData", handleGameData)
+	router.SetFallback(serverHandler.OnHandleMessage)
+	return router
 }
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/yelaco/ludofy/internal/domains/entities"
+	"github.com/yelaco/ludofy/pkg/server"
+)
+
+// matchSnapshot is the state of a match handed over to another server
+type matchSnapshot struct {
+	Fen       string           `json:"fen"`
+	Moves     []moveSnapshot   `json:"moves"`
+	StartedAt time.Time        `json:"startedAt"`
+	Players   []playerSnapshot `json:"players"`
+}
+
+type moveSnapshot struct {
+	PlayerId  string    `json:"playerId"`
+	Uci       string    `json:"uci"`
+	Control   string    `json:"control"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type playerSnapshot struct {
+	Id            string        `json:"id"`
+	Clock         time.Duration `json:"clock"`
+	Side          Side          `json:"side"`
+	TurnStartedAt time.Time     `json:"turnStartedAt"`
+}
+
+// OnMatchSnapshot method    serializes the game with the clocks of the players
+func (h *MyMatchHandler) OnMatchSnapshot() ([]byte, error) {
+	match := h.GetMatch().(*Match)
+	snapshot := matchSnapshot{
+		Fen:       match.game.FEN(),
+		Moves:     make([]moveSnapshot, 0, len(match.game.moves)),
+		StartedAt: match.StartedAt,
+		Players:   make([]playerSnapshot, 0, len(match.GetPlayers())),
+	}
+	for _, move := range match.game.moves {
+		snapshot.Moves = append(snapshot.Moves, moveSnapshot{
+			PlayerId:  move.GetPlayerId(),
+			Uci:       move.Uci,
+			Control:   move.Control,
+			CreatedAt: move.CreatedAt,
+		})
+	}
+	for _, p := range match.GetPlayers() {
+		player := p.(*Player)
+		snapshot.Players = append(snapshot.Players, playerSnapshot{
+			Id:            player.GetId(),
+			Clock:         player.Clock,
+			Side:          player.Side,
+			TurnStartedAt: player.TurnStartedAt,
+		})
+	}
+	return json.Marshal(snapshot)
+}
+
+// OnMatchRestore method    restores a match handed over by another server,
+// the clock of the current turn keeps running from where it was
+func (h *MyServerHandler) OnMatchRestore(
+	activeMatch entities.ActiveMatch,
+	data []byte,
+) (server.Match, error) {
+	var snapshot matchSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal snapshot: %w", err)
+	}
+	cfg, err := ConfigForGameMode(activeMatch.GameMode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get config: %w", err)
+	}
+	seats := make(map[string]entities.Player, len(activeMatch.Players))
+	for _, player := range activeMatch.Players {
+		seats[player.Id] = player
+	}
+	players := make(map[string]server.Player, len(snapshot.Players))
+	for _, player := range snapshot.Players {
+		seat, exist := seats[player.Id]
+		if !exist {
+			seat = entities.Player{Id: player.Id}
+		}
+		players[player.Id] = &Player{
+			Player:        newSeat(activeMatch.MatchId, seat, player.Side, cfg),
+			Clock:         player.Clock,
+			Side:          player.Side,
+			TurnStartedAt: player.TurnStartedAt,
+		}
+	}
+	game, err := RestoreGame(snapshot.Fen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to restore game: %w", err)
+	}
+	for _, move := range snapshot.Moves {
+		restored := NewMove(move.PlayerId)
+		restored.Uci = move.Uci
+		restored.Control = move.Control
+		restored.CreatedAt = move.CreatedAt
+		game.moves = append(game.moves, restored)
+	}
+	match := Match{
+		Match:     server.NewDefaultMatch(activeMatch.MatchId, players),
+		cfg:       cfg,
+		game:      game,
+		clock:     h.clock,
+		StartedAt: snapshot.StartedAt,
+	}
+	match.SetSavePolicy(server.SavePolicy{EveryMoves: 1})
+	match.SetChatPolicy(server.ChatPolicy{Spectators: true})
+	match.SetPausePolicy(server.PausePolicy{
+		Budget:      cfg.PauseBudget,
+		MaxDuration: cfg.MaxPauseDuration,
+	})
+	if match.StartedAt.IsZero() {
+		match.setTimer(cfg.CancelTimeout)
+	} else {
+		current := match.getCurrentTurnPlayer()
+		match.setTimer(max(current.Clock-h.clock.Since(current.TurnStartedAt), 0))
+	}
+	matchHandler := NewMatchHandler(&match)
+	match.SetHandler(matchHandler)
+	return match, nil
+}
@@ -1,7 +1,11 @@
 package compute
 
 import (
+	"crypto/tls"
 	"net/http"
+	"os"
+	"strconv"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
@@ -9,6 +13,15 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/ecs"
 )
 
+const (
+	// statusTimeout bounds the status requests to the game servers, all of
+	// them share it when the servers are polled together
+	statusTimeout = 3 * time.Second
+	// defaultServerPort is the port of the game servers when SERVER_PORT
+	// isn't set
+	defaultServerPort = 7202
+)
+
 type Client struct {
 	ecs        *ecs.Client
 	ec2        *ec2.Client
@@ -20,20 +33,52 @@ type Client struct {
 type config struct {
 	ClusterName *string
 	TaskArn     *string
+	// ServerPort is the port of the game servers, which serve their status
+	// too
+	ServerPort int
+	// ServerScheme is http, or https for game servers with a certificate
+	ServerScheme string
+	// ServerTls verifies the certificates of the game servers and presents
+	// the client certificate their status endpoints require, nil for http
+	ServerTls *tls.Config
 }
 
 func NewClient(ecsClient *ecs.Client, ec2Client *ec2.Client, cloudwatchClient *cloudwatch.Client) *Client {
+	cfg := loadConfig()
 	return &Client{
 		ecs:        ecsClient,
 		ec2:        ec2Client,
 		cloudwatch: cloudwatchClient,
-		http:       new(http.Client),
-		cfg:        loadConfig(),
+		http:       newHttpClient(cfg),
+		cfg:        cfg,
+	}
+}
+
+func newHttpClient(cfg config) *http.Client {
+	client := &http.Client{Timeout: statusTimeout}
+	if cfg.ServerTls != nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = cfg.ServerTls
+		client.Transport = transport
 	}
+	return client
 }
 
 func loadConfig() config {
-	var cfg config
+	cfg := config{
+		ServerPort:   defaultServerPort,
+		ServerScheme: "http",
+		ServerTls:    loadServerTls(),
+	}
+	if port, err := strconv.Atoi(os.Getenv("SERVER_PORT")); err == nil && port > 0 {
+		cfg.ServerPort = port
+	}
+	if cfg.ServerTls != nil {
+		cfg.ServerScheme = "https"
+	}
+	if scheme := os.Getenv("SERVER_SCHEME"); scheme != "" {
+		cfg.ServerScheme = scheme
+	}
 	taskMetadata, err := getTaskMetadata()
 	if err == nil {
 		cfg.ClusterName = aws.String(taskMetadata.ClusterName)
@@ -1,10 +1,15 @@
 package compute
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"io"
 	"net/http"
 	"os"
+
+	"github.com/yelaco/ludofy/pkg/logging"
+	"go.uber.org/zap"
 )
 
 func getTaskMetadata() (TaskMetadata, error) {
@@ -27,3 +32,45 @@ func getTaskMetadata() (TaskMetadata, error) {
 
 	return metadata, nil
 }
+
+// loadServerTls returns the TLS config to reach game servers which serve
+// https, nil when none of SERVER_TLS_CA_FILE, SERVER_TLS_CERT_FILE and
+// SERVER_TLS_KEY_FILE is set. SERVER_TLS_CA_FILE verifies the server
+// certificates, the system roots when empty, and SERVER_TLS_CERT_FILE with
+// SERVER_TLS_KEY_FILE is the client certificate for servers started with
+// TLS_CLIENT_CA_FILE. Servers are reached by ip, SERVER_TLS_SERVER_NAME is
+// the name their certificate is checked against
+func loadServerTls() *tls.Config {
+	caFile := os.Getenv("SERVER_TLS_CA_FILE")
+	certFile := os.Getenv("SERVER_TLS_CERT_FILE")
+	keyFile := os.Getenv("SERVER_TLS_KEY_FILE")
+	if caFile == "" && certFile == "" && keyFile == "" {
+		return nil
+	}
+	if (certFile == "") != (keyFile == "") {
+		logging.Fatal("SERVER_TLS_CERT_FILE and SERVER_TLS_KEY_FILE must be set together")
+	}
+
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: os.Getenv("SERVER_TLS_SERVER_NAME"),
+	}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			logging.Fatal("failed to read server CA", zap.Error(err))
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			logging.Fatal("no certificate found in server CA", zap.String("file", caFile))
+		}
+	}
+	if certFile != "" {
+		certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			logging.Fatal("failed to load client certificate", zap.Error(err))
+		}
+		cfg.Certificates = []tls.Certificate{certificate}
+	}
+	return cfg
+}
@@ -5,89 +5,126 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"slices"
 	"sort"
+	"sync"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
 	"github.com/yelaco/ludofy/internal/domains/dtos"
 	"github.com/yelaco/ludofy/pkg/logging"
+	"go.uber.org/zap"
 )
 
-var ErrNoServerRunning = fmt.Errorf("no server available")
+var (
+	ErrNoServerRunning   = fmt.Errorf("no server available")
+	ErrNoServerAvailable = fmt.Errorf("every server is full")
+)
 
 type TaskMetadata struct {
 	TaskArn     string `json:"TaskARN"`
 	ClusterName string `json:"Cluster"`
 }
 
+// GetServerIp returns the ip of the server new matches should go to, servers
+// with headroom first. Servers which reached their soft limit come next, then
+// the ones which didn't report their status, the oldest first
 func (client *Client) GetServerIp(
 	ctx context.Context,
 	clusterName,
 	serviceName string,
 ) (string, error) {
-	// List tasks in the cluster
-	listTasksOutput, err := client.ecs.ListTasks(ctx, &ecs.ListTasksInput{
-		Cluster:       &clusterName,
-		ServiceName:   &serviceName,
-		DesiredStatus: "RUNNING",
-	})
-	if err != nil || len(listTasksOutput.TaskArns) == 0 {
-		return "", fmt.Errorf("no running tasks found or error occurred: %v", err)
+	serverIps, err := client.GetServerIps(ctx, clusterName, serviceName)
+	if err != nil {
+		return "", err
 	}
+	return client.pickServerIp(ctx, serverIps)
+}
 
-	describeTasksOutput, err := client.ecs.DescribeTasks(
-		ctx,
-		&ecs.DescribeTasksInput{
-			Cluster: aws.String(clusterName),
-			Tasks:   listTasksOutput.TaskArns,
-		},
-	)
+// CheckAndGetNewServerIp returns the target server if it is still running,
+// otherwise the server picked for new matches
+func (client *Client) CheckAndGetNewServerIp(
+	ctx context.Context,
+	clusterName,
+	serviceName,
+	targetPublicIp string,
+) (string, error) {
+	serverIps, err := client.GetServerIps(ctx, clusterName, serviceName)
 	if err != nil {
-		return "", fmt.Errorf("failed to describe ECS tasks: %w", err)
+		return "", err
 	}
+	if targetPublicIp != "" && slices.Contains(serverIps, targetPublicIp) {
+		return targetPublicIp, nil
+	}
+	return client.pickServerIp(ctx, serverIps)
+}
 
-	sort.Slice(describeTasksOutput.Tasks, func(i, j int) bool {
-		return describeTasksOutput.Tasks[i].StartedAt.Before(*describeTasksOutput.Tasks[j].StartedAt)
-	})
-
-	var eniId string
-	for _, detail := range describeTasksOutput.Tasks[0].Attachments[0].Details {
-		if *detail.Name == "networkInterfaceId" {
-			eniId = *detail.Value
-			break
+// pickServerIp ranks the servers by their status, ErrNoServerAvailable when
+// every server is full
+func (client *Client) pickServerIp(ctx context.Context, serverIps []string) (string, error) {
+	statuses, errs := client.getServerStatuses(ctx, serverIps)
+	var softLimited, unknown []string
+	for i, serverIp := range serverIps {
+		status, err := statuses[i], errs[i]
+		if err != nil {
+			logging.Info("failed to get server status",
+				zap.String("server_ip", serverIp),
+				zap.Error(err),
+			)
+			unknown = append(unknown, serverIp)
+			continue
+		}
+		switch {
+		case status.CanAccept && !status.SoftLimit:
+			return serverIp, nil
+		case status.CanAccept:
+			softLimited = append(softLimited, serverIp)
 		}
 	}
-
-	if eniId == "" {
-		return "", fmt.Errorf("ENI ID not found in task details")
+	if len(softLimited) > 0 {
+		return softLimited[0], nil
 	}
-
-	// Get the public IP from EC2
-	eniResp, err := client.ec2.DescribeNetworkInterfaces(
-		ctx,
-		&ec2.DescribeNetworkInterfacesInput{
-			NetworkInterfaceIds: []string{eniId},
-		},
-	)
-	if err != nil {
-		return "", fmt.Errorf("failed to describe network interface: %w", err)
+	if len(unknown) > 0 {
+		return unknown[0], nil
 	}
+	return "", ErrNoServerAvailable
+}
 
-	if len(eniResp.NetworkInterfaces) == 0 ||
-		eniResp.NetworkInterfaces[0].Association == nil {
-		return "", fmt.Errorf("no public IP found for ENI")
+// GetMigrationTargetIp returns the ip of the server the matches of this
+// server should be handed over to, ranked like GetServerIp without this server
+func (client *Client) GetMigrationTargetIp(
+	ctx context.Context,
+	serviceName string,
+) (string, error) {
+	if client.cfg.ClusterName == nil || client.cfg.TaskArn == nil {
+		return "", fmt.Errorf("missing task metadata")
+	}
+	serverIps, err := client.getServerIps(ctx, *client.cfg.ClusterName, serviceName, *client.cfg.TaskArn)
+	if err != nil {
+		return "", err
 	}
+	return client.pickServerIp(ctx, serverIps)
+}
 
-	return *eniResp.NetworkInterfaces[0].Association.PublicIp, nil
+// GetServerIps returns the ips of the running servers, the oldest first
+func (client *Client) GetServerIps(
+	ctx context.Context,
+	clusterName,
+	serviceName string,
+) ([]string, error) {
+	return client.getServerIps(ctx, clusterName, serviceName, "")
 }
 
-func (client *Client) CheckAndGetNewServerIp(
+// getServerIps returns the ips of the running servers but the task with the
+// skipped arn, the oldest first
+func (client *Client) getServerIps(
 	ctx context.Context,
 	clusterName,
 	serviceName,
-	targetPublicIp string,
-) (string, error) {
+	skippedTaskArn string,
+) ([]string, error) {
 	// List tasks in the cluster
 	listTasksOutput, err := client.ecs.ListTasks(ctx, &ecs.ListTasksInput{
 		Cluster:       &clusterName,
@@ -95,7 +132,7 @@ func (client *Client) CheckAndGetNewServerIp(
 		DesiredStatus: "RUNNING",
 	})
 	if err != nil || len(listTasksOutput.TaskArns) == 0 {
-		return "", fmt.Errorf("no running tasks found or error occurred: %v", err)
+		return nil, ErrNoServerRunning
 	}
 
 	describeTasksOutput, err := client.ecs.DescribeTasks(
@@ -106,79 +143,57 @@ func (client *Client) CheckAndGetNewServerIp(
 		},
 	)
 	if err != nil {
-		return "", fmt.Errorf("failed to describe ECS tasks: %w", err)
+		return nil, fmt.Errorf("failed to describe ECS tasks: %w", err)
 	}
 
-	sort.Slice(describeTasksOutput.Tasks, func(i, j int) bool {
-		return describeTasksOutput.Tasks[i].StartedAt.Before(*describeTasksOutput.Tasks[j].StartedAt)
+	tasks := slices.DeleteFunc(describeTasksOutput.Tasks, func(task types.Task) bool {
+		return skippedTaskArn != "" && aws.ToString(task.TaskArn) == skippedTaskArn
 	})
-
-	var newServerIp *string
-	for i, task := range describeTasksOutput.Tasks {
-		for _, attachment := range task.Attachments {
-			for _, detail := range attachment.Details {
-				if *detail.Name == "networkInterfaceId" {
-					eniID := *detail.Value
-
-					eniOutput, err := client.ec2.DescribeNetworkInterfaces(
-						ctx,
-						&ec2.DescribeNetworkInterfacesInput{
-							NetworkInterfaceIds: []string{eniID},
-						},
-					)
-					if err != nil {
-						return "", fmt.Errorf("failed to describe ENI: %w", err)
-					}
-
-					for _, eni := range eniOutput.NetworkInterfaces {
-						if eni.Association != nil && eni.Association.PublicIp != nil {
-							if *eni.Association.PublicIp == targetPublicIp {
-								return targetPublicIp, nil
-							}
-							if i == 0 {
-								newServerIp = eni.Association.PublicIp
-							}
-						}
-					}
-				}
-			}
+	sort.Slice(tasks, func(i, j int) bool {
+		if tasks[i].StartedAt == nil || tasks[j].StartedAt == nil {
+			return tasks[j].StartedAt == nil && tasks[i].StartedAt != nil
 		}
+		return tasks[i].StartedAt.Before(*tasks[j].StartedAt)
+	})
+
+	serverIps, err := client.taskIps(ctx, tasks)
+	if err != nil {
+		return nil, err
 	}
-	if newServerIp == nil {
-		return "", ErrNoServerRunning
+	if len(serverIps) == 0 {
+		return nil, ErrNoServerRunning
 	}
 
-	return *newServerIp, nil
+	return serverIps, nil
 }
 
-func (client *Client) GetServerIps(
-	ctx context.Context,
-	clusterName,
-	serviceName string,
-) ([]string, error) {
-	// List tasks in the cluster
-	listTasksOutput, err := client.ecs.ListTasks(ctx, &ecs.ListTasksInput{
-		Cluster:       &clusterName,
-		ServiceName:   &serviceName,
-		DesiredStatus: "RUNNING",
+// GetTaskIp returns the public ip of the task of this server, the address
+// other servers hand matches over to
+func (client *Client) GetTaskIp(ctx context.Context) (string, error) {
+	if client.cfg.ClusterName == nil || client.cfg.TaskArn == nil {
+		return "", fmt.Errorf("missing task metadata")
+	}
+	describeTasksOutput, err := client.ecs.DescribeTasks(ctx, &ecs.DescribeTasksInput{
+		Cluster: client.cfg.ClusterName,
+		Tasks:   []string{*client.cfg.TaskArn},
 	})
-	if err != nil || len(listTasksOutput.TaskArns) == 0 {
-		return nil, ErrNoServerRunning
+	if err != nil {
+		return "", fmt.Errorf("failed to describe ECS task: %w", err)
 	}
-
-	describeTasksOutput, err := client.ecs.DescribeTasks(
-		ctx,
-		&ecs.DescribeTasksInput{
-			Cluster: aws.String(clusterName),
-			Tasks:   listTasksOutput.TaskArns,
-		},
-	)
+	taskIps, err := client.taskIps(ctx, describeTasksOutput.Tasks)
 	if err != nil {
-		return nil, fmt.Errorf("failed to describe ECS tasks: %w", err)
+		return "", err
+	}
+	if len(taskIps) == 0 {
+		return "", fmt.Errorf("task has no public ip")
 	}
+	return taskIps[0], nil
+}
 
-	serverIps := make([]string, 0, len(listTasksOutput.TaskArns))
-	for _, task := range describeTasksOutput.Tasks {
+// taskIps returns the public ips of the network interfaces of the tasks
+func (client *Client) taskIps(ctx context.Context, tasks []types.Task) ([]string, error) {
+	serverIps := make([]string, 0, len(tasks))
+	for _, task := range tasks {
 		for _, attachment := range task.Attachments {
 			for _, detail := range attachment.Details {
 				if *detail.Name == "networkInterfaceId" {
@@ -203,7 +218,6 @@ func (client *Client) GetServerIps(
 			}
 		}
 	}
-
 	return serverIps, nil
 }
 
@@ -257,10 +271,37 @@ func (client *Client) UpdateServerProtection(
 	return nil
 }
 
-func (client *Client) GetServerStatus(ip string, port int) (dtos.ServerMetricsResponse, error) {
-	req, err := http.NewRequest(
+// getServerStatuses polls the status of the servers concurrently, the polls
+// share a single statusTimeout deadline. The statuses and errors are in the
+// order of the ips
+func (client *Client) getServerStatuses(
+	ctx context.Context,
+	serverIps []string,
+) ([]dtos.ServerMetricsResponse, []error) {
+	ctx, cancel := context.WithTimeout(ctx, statusTimeout)
+	defer cancel()
+
+	statuses := make([]dtos.ServerMetricsResponse, len(serverIps))
+	errs := make([]error, len(serverIps))
+	var wg sync.WaitGroup
+	for i, serverIp := range serverIps {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			statuses[i], errs[i] = client.GetServerStatus(ctx, serverIp)
+		}()
+	}
+	wg.Wait()
+	return statuses, errs
+}
+
+// GetServerStatus returns the status of the server at the ip, with the
+// scheme, port and TLS config of the client config
+func (client *Client) GetServerStatus(ctx context.Context, ip string) (dtos.ServerMetricsResponse, error) {
+	req, err := http.NewRequestWithContext(
+		ctx,
 		http.MethodGet,
-		fmt.Sprintf("http://%s:%d/status", ip, port),
+		fmt.Sprintf("%s://%s:%d/status", client.cfg.ServerScheme, ip, client.cfg.ServerPort),
 		nil,
 	)
 	if err != nil {
@@ -271,6 +312,7 @@ func (client *Client) GetServerStatus(ip string, port int) (dtos.ServerMetricsRe
 	if err != nil {
 		return dtos.ServerMetricsResponse{}, fmt.Errorf("failed to send request: %w", err)
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
 		return dtos.ServerMetricsResponse{}, fmt.Errorf("unknown status code: %d", resp.StatusCode)
 	}
@@ -2,15 +2,23 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strconv"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/yelaco/ludofy/internal/domains/entities"
 )
 
-var ErrMatchRecordNotFound = fmt.Errorf("match record not found")
+var (
+	ErrMatchRecordNotFound       = fmt.Errorf("match record not found")
+	ErrMatchRecordAlreadyExisted = fmt.Errorf("match record already existed")
+	ErrMatchRecordAlreadyRated   = fmt.Errorf("match record already rated")
+)
 
 func (client *Client) GetMatchRecord(
 	ctx context.Context,
@@ -62,11 +70,93 @@ func (client *Client) PutMatchRecord(
 		return fmt.Errorf("failed to marshal match record map: %w", err)
 	}
 	_, err = client.dynamodb.PutItem(ctx, &dynamodb.PutItemInput{
-		TableName: client.cfg.MatchRecordsTableName,
-		Item:      av,
+		TableName:           client.cfg.MatchRecordsTableName,
+		ConditionExpression: aws.String("attribute_not_exists(MatchId)"),
+		Item:                av,
 	})
 	if err != nil {
+		var condCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &condCheckFailed) {
+			return fmt.Errorf(
+				"%w [matchId: %s]",
+				ErrMatchRecordAlreadyExisted,
+				matchRecord.MatchId,
+			)
+		}
 		return err
 	}
 	return nil
 }
+
+// TransactRateMatch writes the new ratings of the players and their match
+// results and sets the Rated flag of the match record in one transaction, so
+// a retried delivery never rates the players twice
+func (client *Client) TransactRateMatch(
+	ctx context.Context,
+	matchId string,
+	userRatings []entities.UserRating,
+	matchResults []entities.MatchResult,
+	resultTtl time.Duration,
+) error {
+	transactItems := make([]types.TransactWriteItem, 0, len(userRatings)+len(matchResults)+1)
+	for _, userRating := range userRatings {
+		av, err := attributevalue.MarshalMap(userRating)
+		if err != nil {
+			return fmt.Errorf("failed to marshal user rating map: %w", err)
+		}
+		transactItems = append(transactItems, types.TransactWriteItem{
+			Put: &types.Put{
+				TableName: client.cfg.UserRatingsTableName,
+				Item:      av,
+			},
+		})
+	}
+	for _, matchResult := range matchResults {
+		av, err := attributevalue.MarshalMap(matchResult)
+		if err != nil {
+			return fmt.Errorf("failed to marshal match result map: %w", err)
+		}
+		av["TTL"] = &types.AttributeValueMemberN{
+			Value: strconv.FormatInt(time.Now().Add(resultTtl).Unix(), 10),
+		}
+		transactItems = append(transactItems, types.TransactWriteItem{
+			Put: &types.Put{
+				TableName: client.cfg.MatchResultsTableName,
+				Item:      av,
+			},
+		})
+	}
+	// The flag is the last item, its condition tells a rated match apart
+	transactItems = append(transactItems, types.TransactWriteItem{
+		Update: &types.Update{
+			TableName: client.cfg.MatchRecordsTableName,
+			Key: map[string]types.AttributeValue{
+				"MatchId": &types.AttributeValueMemberS{
+					Value: matchId,
+				},
+			},
+			UpdateExpression:    aws.String("SET Rated = :rated"),
+			ConditionExpression: aws.String("attribute_exists(MatchId) AND attribute_not_exists(Rated)"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":rated": &types.AttributeValueMemberBOOL{Value: true},
+			},
+		},
+	})
+
+	_, err := client.dynamodb.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: transactItems,
+	})
+	if err != nil {
+		var canceled *types.TransactionCanceledException
+		if errors.As(err, &canceled) && len(canceled.CancellationReasons) == len(transactItems) &&
+			aws.ToString(canceled.CancellationReasons[len(transactItems)-1].Code) == "ConditionalCheckFailed" {
+			return fmt.Errorf(
+				"%w [matchId: %s]",
+				ErrMatchRecordAlreadyRated,
+				matchId,
+			)
+		}
+		return fmt.Errorf("failed to transact write items: %w", err)
+	}
+	return nil
+}
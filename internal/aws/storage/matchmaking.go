@@ -31,7 +31,11 @@ func (client *Client) CheckForActiveMatch(
 
 func (client *Client) TransactCreateMatch(ctx context.Context, match entities.ActiveMatch) error {
 	transactItems := make([]types.TransactWriteItem, 0, len(match.Players)*2+1)
+	// Bots have neither a matchmaking ticket nor a user match
 	for _, player := range match.Players {
+		if player.IsBot {
+			continue
+		}
 		transactItems = append(transactItems, types.TransactWriteItem{
 			Delete: &types.Delete{
 				TableName: client.cfg.MatchmakingTicketsTableName,
@@ -53,6 +57,9 @@ func (client *Client) TransactCreateMatch(ctx context.Context, match entities.Ac
 		},
 	})
 	for _, player := range match.Players {
+		if player.IsBot {
+			continue
+		}
 		userMatch := entities.UserMatch{
 			UserId:  player.Id,
 			MatchId: match.MatchId,
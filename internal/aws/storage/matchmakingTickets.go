@@ -2,7 +2,9 @@ package storage
 
 import (
 	"context"
+	"fmt"
 	"strconv"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
@@ -11,6 +13,38 @@ import (
 	"github.com/yelaco/ludofy/internal/domains/entities"
 )
 
+var ErrMatchmakingTicketNotFound = fmt.Errorf("matchmaking ticket not found")
+
+func (client *Client) GetMatchmakingTicket(
+	ctx context.Context,
+	userId string,
+) (
+	entities.MatchmakingTicket,
+	error,
+) {
+	output, err := client.dynamodb.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: client.cfg.MatchmakingTicketsTableName,
+		Key: map[string]types.AttributeValue{
+			"UserId": &types.AttributeValueMemberS{Value: userId},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return entities.MatchmakingTicket{}, err
+	}
+	if output.Item == nil {
+		return entities.MatchmakingTicket{}, ErrMatchmakingTicketNotFound
+	}
+
+	var ticket entities.MatchmakingTicket
+	err = attributevalue.UnmarshalMap(output.Item, &ticket)
+	if err != nil {
+		return entities.MatchmakingTicket{}, fmt.Errorf("failed to unmarshal matchmaking ticket map")
+	}
+
+	return ticket, nil
+}
+
 func (client *Client) ScanMatchmakingTickets(
 	ctx context.Context,
 	ticket entities.MatchmakingTicket,
@@ -58,6 +92,41 @@ func (client *Client) ScanMatchmakingTickets(
 	return tickets, nil
 }
 
+// ScanQueuedMatchmakingTickets returns the tickets queued before the given
+// time, across every game mode
+func (client *Client) ScanQueuedMatchmakingTickets(
+	ctx context.Context,
+	queuedBefore time.Time,
+) (
+	[]entities.MatchmakingTicket,
+	error,
+) {
+	paginator := dynamodb.NewScanPaginator(client.dynamodb, &dynamodb.ScanInput{
+		TableName:      client.cfg.MatchmakingTicketsTableName,
+		ConsistentRead: aws.Bool(true),
+	})
+
+	var tickets []entities.MatchmakingTicket
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		var page []entities.MatchmakingTicket
+		err = attributevalue.UnmarshalListOfMaps(output.Items, &page)
+		if err != nil {
+			return nil, err
+		}
+		for _, ticket := range page {
+			if !ticket.QueuedAt.IsZero() && ticket.QueuedAt.Before(queuedBefore) {
+				tickets = append(tickets, ticket)
+			}
+		}
+	}
+
+	return tickets, nil
+}
+
 func (client *Client) PutMatchmakingTickets(
 	ctx context.Context,
 	ticket entities.MatchmakingTicket,
@@ -94,3 +94,30 @@ func (client *Client) DeleteUserMatch(
 	}
 	return nil
 }
+
+// DeleteUserMatchOfMatch deletes the user match only if it still points to the
+// match, so a late or repeated delivery doesn't remove the user from a newer one
+func (client *Client) DeleteUserMatchOfMatch(
+	ctx context.Context,
+	userId string,
+	matchId string,
+) error {
+	_, err := client.dynamodb.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: client.cfg.UserMatchesTableName,
+		Key: map[string]types.AttributeValue{
+			"UserId": &types.AttributeValueMemberS{Value: userId},
+		},
+		ConditionExpression: aws.String("MatchId = :matchId"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":matchId": &types.AttributeValueMemberS{Value: matchId},
+		},
+	})
+	if err != nil {
+		var condCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &condCheckFailed) {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
@@ -17,7 +17,9 @@ type ActiveMatchResponse struct {
 }
 
 type PlayerResponse struct {
-	Id string
+	Id    string
+	IsBot bool   `json:",omitempty"`
+	Team  string `json:",omitempty"`
 }
 
 type ActiveMatchListResponse struct {
@@ -41,7 +43,9 @@ func ActiveMatchResponseFromEntity(activeMatch entities.ActiveMatch) ActiveMatch
 	}
 	for _, player := range activeMatch.Players {
 		resp.Players = append(resp.Players, PlayerResponse{
-			Id: player.Id,
+			Id:    player.Id,
+			IsBot: player.IsBot,
+			Team:  player.Team,
 		})
 	}
 	return resp
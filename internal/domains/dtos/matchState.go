@@ -17,6 +17,7 @@ type MatchStateRequest struct {
 	PlayerStates []PlayerStateRequest `json:"playerStates"`
 	GameState    interface{}          `json:"gameState"`
 	Move         MoveRequest          `json:"move"`
+	Pause        *entities.PauseState `json:"pause,omitempty"`
 	Timestamp    time.Time            `json:"timestamp"`
 }
 
@@ -47,6 +48,7 @@ type MatchStateResponse struct {
 	PlayerStates []PlayerStateResponse `json:"players"`
 	GameState    any                   `json:"game"`
 	Move         MoveResponse          `json:"move"`
+	Pause        *entities.PauseState  `json:"pause,omitempty"`
 	Timestamp    time.Time             `json:"timestamp"`
 }
 
@@ -70,6 +72,7 @@ func NewMatchStateAppSyncRequest(req MatchStateRequest) MatchStateAppSyncRequest
 		"playerStates": string(playerStatesJson),
 		"gameState":    nil,
 		"move":         string(moveJson),
+		"pause":        nil,
 		"timestamp":    req.Timestamp,
 	}
 
@@ -78,6 +81,11 @@ func NewMatchStateAppSyncRequest(req MatchStateRequest) MatchStateAppSyncRequest
 		input["gameState"] = string(gameStateJson)
 	}
 
+	if req.Pause != nil {
+		pauseJson, _ := json.Marshal(req.Pause)
+		input["pause"] = string(pauseJson)
+	}
+
 	return MatchStateAppSyncRequest{
 		Query: updateMatchStateMutation,
 		Variables: map[string]interface{}{
@@ -93,6 +101,7 @@ func MatchStateRequestToEntity(req MatchStateRequest) entities.MatchState {
 		PlayerStates: make([]entities.PlayerStateInterface, 0, len(req.PlayerStates)),
 		GameState:    req.GameState,
 		Move:         req.Move,
+		Pause:        req.Pause,
 		Timestamp:    req.Timestamp,
 	}
 	for _, playerState := range req.PlayerStates {
@@ -108,6 +117,7 @@ func MatchStateResponseFromEntitiy(matchState entities.MatchState) MatchStateRes
 		GameState:    matchState.GameState,
 		PlayerStates: make([]PlayerStateResponse, 0, len(matchState.PlayerStates)),
 		Move:         matchState.Move,
+		Pause:        matchState.Pause,
 		Timestamp:    matchState.Timestamp,
 	}
 	for _, playerState := range matchState.PlayerStates {
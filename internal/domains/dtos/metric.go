@@ -12,6 +12,7 @@ type ServerMetricsResponse struct {
 	ActiveMatches int32 `json:"activeMatches"`
 	CanAccept     bool  `json:"canAccept"`
 	MaxMatches    int32 `json:"maxMatches"`
+	SoftLimit     bool  `json:"softLimit"`
 }
 
 type BackendMetricsResponse struct {
@@ -14,5 +14,7 @@ type ActiveMatch struct {
 }
 
 type Player struct {
-	Id string `dynamodbav:"Id"`
+	Id    string `dynamodbav:"Id"`
+	IsBot bool   `dynamodbav:"IsBot,omitempty"`
+	Team  string `dynamodbav:"Team,omitempty"`
 }
@@ -8,6 +8,22 @@ type MatchRecord struct {
 	StartedAt time.Time               `dynamodbav:"StartedAt"`
 	EndedAt   time.Time               `dynamodbav:"EndedAt"`
 	Result    interface{}             `dynamodbav:"Result"`
+	Chat      []ChatLine              `dynamodbav:"Chat,omitempty"`
+	Bots      []string                `dynamodbav:"Bots,omitempty"`
+	Teams     []TeamRecord            `dynamodbav:"Teams,omitempty"`
+	Rated     bool                    `dynamodbav:"Rated,omitempty"`
+}
+
+type TeamRecord struct {
+	Team      string   `dynamodbav:"Team"`
+	PlayerIds []string `dynamodbav:"PlayerIds"`
+	Placement int      `dynamodbav:"Placement"`
+}
+
+type ChatLine struct {
+	PlayerId  string    `dynamodbav:"PlayerId"`
+	Text      string    `dynamodbav:"Text"`
+	CreatedAt time.Time `dynamodbav:"CreatedAt"`
 }
 
 type PlayerRecordInterface interface {
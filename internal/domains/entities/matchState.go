@@ -8,9 +8,20 @@ type MatchState struct {
 	PlayerStates []PlayerStateInterface `dynamodbav:"PlayerStates"`
 	GameState    interface{}            `dynamodbav:"GameState"`
 	Move         MoveInterface          `dynamodbav:"Move"`
+	Pause        *PauseState            `dynamodbav:"Pause"`
 	Timestamp    time.Time              `dynamodbav:"Timestamp"`
 }
 
+// PauseState is the pause of a match and the pause time used by each player.
+// It is stored as published, with the keys of its JSON
+type PauseState struct {
+	Paused   bool                     `json:"paused" dynamodbav:"paused"`
+	PausedBy string                   `json:"pausedBy,omitempty" dynamodbav:"pausedBy,omitempty"`
+	PausedAt time.Time                `json:"pausedAt,omitzero" dynamodbav:"pausedAt,omitempty"`
+	ResumeAt time.Time                `json:"resumeAt,omitzero" dynamodbav:"resumeAt,omitempty"`
+	Used     map[string]time.Duration `json:"used,omitempty" dynamodbav:"used,omitempty"`
+}
+
 type (
 	PlayeState map[string]interface{}
 	Move       map[string]interface{}
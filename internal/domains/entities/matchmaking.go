@@ -2,15 +2,17 @@ package entities
 
 import (
 	"fmt"
+	"time"
 )
 
 type MatchmakingTicket struct {
-	UserId     string  `dynamodbav:"UserId"`
-	IsRanked   bool    `dynamodbav:"IsRanked"`
-	UserRating float64 `dynamodbav:"UserRating"`
-	MinRating  float64 `dynamodbav:"MinRating"`
-	MaxRating  float64 `dynamodbav:"MaxRating"`
-	GameMode   string  `dynamodbav:"GameMode"`
+	UserId     string    `dynamodbav:"UserId"`
+	IsRanked   bool      `dynamodbav:"IsRanked"`
+	UserRating float64   `dynamodbav:"UserRating"`
+	MinRating  float64   `dynamodbav:"MinRating"`
+	MaxRating  float64   `dynamodbav:"MaxRating"`
+	GameMode   string    `dynamodbav:"GameMode"`
+	QueuedAt   time.Time `dynamodbav:"QueuedAt"`
 }
 
 func (t *MatchmakingTicket) Validate() error {
@@ -0,0 +1,101 @@
+package matchmaking
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/apigatewaymanagementapi"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/yelaco/ludofy/internal/aws/compute"
+	"github.com/yelaco/ludofy/internal/aws/storage"
+)
+
+// Client creates matches for the matchmaking lambdas and tells the queued
+// players about them
+type Client struct {
+	storage    *storage.Client
+	compute    *compute.Client
+	apigateway *apigatewaymanagementapi.Client
+	cfg        config
+}
+
+type config struct {
+	ClusterName string
+	ServiceName string
+	// MatchSize is the number of players of a match
+	MatchSize int
+	// TeamSize splits the players of a match into teams in queue order, zero
+	// for matches without teams
+	TeamSize int
+	// BotFallbackAfter is how long a ticket waits in the queue before bots
+	// fill the other seats, zero disables bot opponents
+	BotFallbackAfter time.Duration
+}
+
+// NewClient creates the clients of the matchmaking lambdas, the settings are
+// read from the environment
+func NewClient(awsCfg aws.Config) *Client {
+	apiEndpoint := fmt.Sprintf(
+		"https://%s.execute-api.%s.amazonaws.com/%s",
+		os.Getenv("WEBSOCKET_API_ID"),
+		os.Getenv("AWS_REGION"),
+		os.Getenv("WEBSOCKET_API_STAGE"),
+	)
+	return &Client{
+		storage: storage.NewClient(dynamodb.NewFromConfig(awsCfg)),
+		compute: compute.NewClient(
+			ecs.NewFromConfig(awsCfg),
+			ec2.NewFromConfig(awsCfg),
+			nil,
+		),
+		apigateway: apigatewaymanagementapi.New(apigatewaymanagementapi.Options{
+			BaseEndpoint: aws.String(apiEndpoint),
+			Region:       os.Getenv("AWS_REGION"),
+			Credentials:  awsCfg.Credentials,
+		}),
+		cfg: loadConfig(),
+	}
+}
+
+func loadConfig() config {
+	cfg := config{
+		ClusterName: os.Getenv("SERVER_CLUSTER_NAME"),
+		ServiceName: os.Getenv("SERVER_SERVICE_NAME"),
+		MatchSize:   2,
+	}
+	if matchSize, err := strconv.Atoi(os.Getenv("MATCH_SIZE")); err == nil {
+		cfg.MatchSize = matchSize
+	}
+	cfg.TeamSize, _ = strconv.Atoi(os.Getenv("TEAM_SIZE"))
+	cfg.BotFallbackAfter, _ = time.ParseDuration(os.Getenv("BOT_FALLBACK_AFTER"))
+	return cfg
+}
+
+func (c *Client) Storage() *storage.Client {
+	return c.storage
+}
+
+func (c *Client) Compute() *compute.Client {
+	return c.compute
+}
+
+func (c *Client) ClusterName() string {
+	return c.cfg.ClusterName
+}
+
+func (c *Client) ServiceName() string {
+	return c.cfg.ServiceName
+}
+
+func (c *Client) MatchSize() int {
+	return c.cfg.MatchSize
+}
+
+func (c *Client) BotFallbackAfter() time.Duration {
+	return c.cfg.BotFallbackAfter
+}
@@ -0,0 +1,119 @@
+package matchmaking
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/apigatewaymanagementapi"
+	"github.com/yelaco/ludofy/internal/aws/storage"
+	"github.com/yelaco/ludofy/internal/domains/entities"
+	"github.com/yelaco/ludofy/pkg/utils"
+)
+
+// GetServerIp returns the ip of the server new matches should go to,
+// retrying while no server is up yet
+func (c *Client) GetServerIp(ctx context.Context) (string, error) {
+	var serverIp string
+	var err error
+	for range 5 {
+		serverIp, err = c.compute.GetServerIp(ctx, c.cfg.ClusterName, c.cfg.ServiceName)
+		if err == nil {
+			return serverIp, nil
+		}
+		time.Sleep(5 * time.Second)
+	}
+	return "", fmt.Errorf("failed to get server ip: %w", err)
+}
+
+// Bots returns the bot players which fill the seats of a match the player
+// waited too long for
+func (c *Client) Bots() []entities.Player {
+	bots := make([]entities.Player, 0, c.cfg.MatchSize-1)
+	for range c.cfg.MatchSize - 1 {
+		bots = append(bots, entities.Player{
+			Id:    "bot-" + utils.GenerateUUID(),
+			IsBot: true,
+		})
+	}
+	return bots
+}
+
+// CreateMatch saves a new match of the players on the server, with the
+// conversation of its spectators. The players are put into teams in order
+func (c *Client) CreateMatch(
+	ctx context.Context,
+	players []entities.Player,
+	gameMode string,
+	serverIp string,
+) (
+	entities.ActiveMatch,
+	error,
+) {
+	match := entities.ActiveMatch{
+		MatchId:        utils.GenerateUUID(),
+		ConversationId: utils.GenerateUUID(),
+		PartitionKey:   "ActiveMatches",
+		Players:        c.assignTeams(players),
+		GameMode:       gameMode,
+		Server:         serverIp,
+		CreatedAt:      time.Now(),
+	}
+
+	// Save match information
+	if err := c.storage.TransactCreateMatch(ctx, match); err != nil {
+		return entities.ActiveMatch{}, fmt.Errorf("failed to transact create match: %w", err)
+	}
+
+	// Create a conversation for spectators
+	err := c.storage.PutSpectatorConversation(
+		ctx,
+		entities.SpectatorConversation{
+			MatchId:        match.MatchId,
+			ConversationId: utils.GenerateUUID(),
+		},
+	)
+	if err != nil {
+		return entities.ActiveMatch{}, fmt.Errorf("failed to put spectator conversation: %w", err)
+	}
+
+	return match, nil
+}
+
+// assignTeams fills the teams one after another when matches have teams
+func (c *Client) assignTeams(players []entities.Player) []entities.Player {
+	if c.cfg.TeamSize <= 0 {
+		return players
+	}
+	for i := range players {
+		players[i].Team = fmt.Sprintf("team-%d", i/c.cfg.TeamSize+1)
+	}
+	return players
+}
+
+// NotifyQueueingUser sends the data to the websocket connection of the user,
+// users who aren't connected are skipped
+func (c *Client) NotifyQueueingUser(ctx context.Context, userId string, data []byte) error {
+	connection, err := c.storage.GetConnectionByUserId(ctx, userId)
+	if err != nil {
+		if errors.Is(err, storage.ErrConnectionNotFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+
+	_, err = c.apigateway.PostToConnection(
+		ctx,
+		&apigatewaymanagementapi.PostToConnectionInput{
+			ConnectionId: aws.String(connection.Id),
+			Data:         data,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to post to connect: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,66 @@
+package ranking
+
+import (
+	"math"
+	"slices"
+
+	ts "github.com/mafredri/go-trueskill"
+)
+
+// AdjustTeamSkills rates every team as a single player whose skill is the sum
+// of the skills of its members. Placements start at 1 for the winners, teams
+// with the same placement drew. This is an approximation of the TrueSkill team
+// model, which go-trueskill doesn't implement: the performance variance beta²
+// and the dynamics tau² are added once per team rather than once per member,
+// so teams of several players get larger updates than the full model would
+// give them. Teams of one player are rated exactly like AdjustSkills. The
+// change of the skill of a team is split between its members in proportion
+// to their variance
+func AdjustTeamSkills(cfg ts.Config, teams [][]ts.Player, placements []int) [][]ts.Player {
+	if len(teams) < 2 || len(teams) != len(placements) {
+		panic("Mismatch between teams and placements")
+	}
+
+	order := make([]int, len(teams))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		return placements[a] - placements[b]
+	})
+
+	teamSkills := make([]ts.Player, len(teams))
+	for i, team := range teams {
+		var mu, variance float64
+		for _, player := range team {
+			mu += player.Mu()
+			variance += player.Sigma() * player.Sigma()
+		}
+		teamSkills[i] = ts.NewPlayer(mu, math.Sqrt(variance))
+	}
+
+	ordered := make([]ts.Player, 0, len(teams))
+	draws := make([]bool, 0, len(teams)-1)
+	for k, i := range order {
+		ordered = append(ordered, teamSkills[i])
+		if k > 0 {
+			draws = append(draws, placements[i] == placements[order[k-1]])
+		}
+	}
+	newTeamSkills, _ := cfg.AdjustSkillsWithDraws(ordered, draws)
+
+	newSkills := make([][]ts.Player, len(teams))
+	for k, i := range order {
+		teamVariance := teamSkills[i].Sigma() * teamSkills[i].Sigma()
+		muDelta := newTeamSkills[k].Mu() - teamSkills[i].Mu()
+		shrink := 1 - newTeamSkills[k].Sigma()*newTeamSkills[k].Sigma()/teamVariance
+		for _, player := range teams[i] {
+			variance := player.Sigma() * player.Sigma()
+			newSkills[i] = append(newSkills[i], ts.NewPlayer(
+				player.Mu()+muDelta*variance/teamVariance,
+				math.Sqrt(variance*(1-shrink*variance/teamVariance)),
+			))
+		}
+	}
+	return newSkills
+}
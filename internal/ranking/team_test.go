@@ -0,0 +1,112 @@
+package ranking
+
+import (
+	"math"
+	"testing"
+
+	ts "github.com/mafredri/go-trueskill"
+)
+
+func TestAdjustTeamSkills(t *testing.T) {
+	cfg := ts.New()
+	strong := ts.NewPlayer(30, 4)
+	weak := ts.NewPlayer(20, 6)
+	fresh := cfg.NewPlayer()
+
+	tests := []struct {
+		name       string
+		teams      [][]ts.Player
+		placements []int
+		// check compares the new skills of the players with their old ones
+		check func(t *testing.T, teams, newSkills [][]ts.Player)
+	}{
+		{
+			name:       "1v1 is rated like AdjustSkills",
+			teams:      [][]ts.Player{{weak}, {strong}},
+			placements: []int{1, 2},
+			check: func(t *testing.T, teams, newSkills [][]ts.Player) {
+				want, _ := cfg.AdjustSkills([]ts.Player{weak, strong}, false)
+				for i := range teams {
+					assertSkill(t, newSkills[i][0], want[i])
+				}
+			},
+		},
+		{
+			name:       "1v1 draw is rated like AdjustSkills",
+			teams:      [][]ts.Player{{strong}, {weak}},
+			placements: []int{1, 1},
+			check: func(t *testing.T, teams, newSkills [][]ts.Player) {
+				want, _ := cfg.AdjustSkills([]ts.Player{strong, weak}, true)
+				for i := range teams {
+					assertSkill(t, newSkills[i][0], want[i])
+				}
+			},
+		},
+		{
+			name:       "2v2 win",
+			teams:      [][]ts.Player{{weak, fresh}, {strong, fresh}},
+			placements: []int{2, 1},
+			check: func(t *testing.T, teams, newSkills [][]ts.Player) {
+				for j, player := range teams[1] {
+					if newSkills[1][j].Mu() <= player.Mu() {
+						t.Errorf("winner %d mu %f, want above %f", j, newSkills[1][j].Mu(), player.Mu())
+					}
+				}
+				for j, player := range teams[0] {
+					if newSkills[0][j].Mu() >= player.Mu() {
+						t.Errorf("loser %d mu %f, want below %f", j, newSkills[0][j].Mu(), player.Mu())
+					}
+				}
+				// the uncertain member moves more than the known one
+				winnerGain := newSkills[1][1].Mu() - fresh.Mu()
+				if winnerGain <= newSkills[1][0].Mu()-strong.Mu() {
+					t.Errorf("fresh winner gained %f, want more than the strong one", winnerGain)
+				}
+				for i, team := range teams {
+					for j, player := range team {
+						if newSkills[i][j].Sigma() >= player.Sigma() {
+							t.Errorf("player %d of team %d sigma %f, want below %f",
+								j, i, newSkills[i][j].Sigma(), player.Sigma())
+						}
+					}
+				}
+			},
+		},
+		{
+			name:       "2v2 draw",
+			teams:      [][]ts.Player{{strong, strong}, {weak, weak}},
+			placements: []int{1, 1},
+			check: func(t *testing.T, teams, newSkills [][]ts.Player) {
+				for j := range teams[0] {
+					if newSkills[0][j].Mu() >= strong.Mu() {
+						t.Errorf("stronger team member %d mu %f, want below %f", j, newSkills[0][j].Mu(), strong.Mu())
+					}
+					if newSkills[1][j].Mu() <= weak.Mu() {
+						t.Errorf("weaker team member %d mu %f, want above %f", j, newSkills[1][j].Mu(), weak.Mu())
+					}
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newSkills := AdjustTeamSkills(cfg, tt.teams, tt.placements)
+			if len(newSkills) != len(tt.teams) {
+				t.Fatalf("got %d teams, want %d", len(newSkills), len(tt.teams))
+			}
+			for i := range tt.teams {
+				if len(newSkills[i]) != len(tt.teams[i]) {
+					t.Fatalf("team %d has %d players, want %d", i, len(newSkills[i]), len(tt.teams[i]))
+				}
+			}
+			tt.check(t, tt.teams, newSkills)
+		})
+	}
+}
+
+func assertSkill(t *testing.T, got, want ts.Player) {
+	t.Helper()
+	if math.Abs(got.Mu()-want.Mu()) > 1e-9 || math.Abs(got.Sigma()-want.Sigma()) > 1e-9 {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,249 @@
+package server
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/yelaco/ludofy/pkg/logging"
+	"go.uber.org/zap"
+)
+
+type adminPlayerResponse struct {
+	Id     string `json:"id"`
+	Status string `json:"status"`
+	Rtt    string `json:"rtt"`
+}
+
+type adminMatchResponse struct {
+	MatchId  string                `json:"matchId"`
+	State    string                `json:"state"`
+	LoadedAt time.Time             `json:"loadedAt"`
+	Age      string                `json:"age"`
+	Players  []adminPlayerResponse `json:"players"`
+	Dump     interface{}           `json:"dump,omitempty"`
+}
+
+type adminProtectionRequest struct {
+	Enabled bool `json:"enabled"`
+}
+
+type adminProtectionResponse struct {
+	Enabled   bool   `json:"enabled"`
+	Remaining string `json:"remaining"`
+}
+
+type adminErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// newAdminServer method    creates the admin listener, every request must
+// carry the admin token as a bearer token and a client certificate when a
+// client CA is configured
+func (s *DefaultServer) newAdminServer() *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /admin/matches", s.handleAdminListMatches)
+	mux.HandleFunc("GET /admin/matches/{matchId}", s.handleAdminGetMatch)
+	mux.HandleFunc("POST /admin/matches/{matchId}/end", s.handleAdminEndMatch)
+	mux.HandleFunc("POST /admin/matches/{matchId}/abort", s.handleAdminAbortMatch)
+	mux.HandleFunc("POST /admin/matches/{matchId}/players/{playerId}/kick", s.handleAdminKickPlayer)
+	mux.HandleFunc("GET /admin/protection", s.handleAdminGetProtection)
+	mux.HandleFunc("PUT /admin/protection", s.handleAdminSetProtection)
+	return &http.Server{
+		Addr:      "0.0.0.0:" + s.cfg.adminPort,
+		Handler:   s.adminAuth(mux),
+		TLSConfig: s.cfg.tls.serverConfig(tls.RequireAndVerifyClientCert),
+	}
+}
+
+func (s *DefaultServer) adminAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.cfg.adminToken)) != 1 {
+			writeAdminJson(w, http.StatusUnauthorized, adminErrorResponse{Error: "invalid admin token"})
+			return
+		}
+		logging.Info("admin request",
+			zap.String("method", r.Method),
+			zap.String("path", r.URL.Path),
+		)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *DefaultServer) handleAdminListMatches(w http.ResponseWriter, r *http.Request) {
+	matches := []adminMatchResponse{}
+	s.matches.Range(func(key, value any) bool {
+		if match, ok := value.(Match); ok {
+			matches = append(matches, newAdminMatchResponse(match))
+		}
+		return true
+	})
+	writeAdminJson(w, http.StatusOK, matches)
+}
+
+func (s *DefaultServer) handleAdminGetMatch(w http.ResponseWriter, r *http.Request) {
+	match, err := s.getMatch(r.PathValue("matchId"))
+	if err != nil {
+		writeAdminError(w, err)
+		return
+	}
+	resp := newAdminMatchResponse(match)
+	resp.Dump, err = dumpMatch(match)
+	if err != nil {
+		writeAdminError(w, err)
+		return
+	}
+	writeAdminJson(w, http.StatusOK, resp)
+}
+
+func (s *DefaultServer) handleAdminEndMatch(w http.ResponseWriter, r *http.Request) {
+	s.handleAdminStopMatch(w, r, "end", Match.End)
+}
+
+func (s *DefaultServer) handleAdminAbortMatch(w http.ResponseWriter, r *http.Request) {
+	s.handleAdminStopMatch(w, r, "abort", Match.Abort)
+}
+
+// handleAdminStopMatch method    ends or aborts the match on its goroutine
+func (s *DefaultServer) handleAdminStopMatch(
+	w http.ResponseWriter,
+	r *http.Request,
+	action string,
+	stop func(Match),
+) {
+	match, err := s.getMatch(r.PathValue("matchId"))
+	if err != nil {
+		writeAdminError(w, err)
+		return
+	}
+	stopped := false
+	match.exec(func() {
+		if match.IsEnded() {
+			return
+		}
+		stop(match)
+		stopped = true
+	})
+	if !stopped {
+		writeAdminError(w, ErrMatchEnded)
+		return
+	}
+	logging.Info("match stopped by admin",
+		zap.String("match_id", match.GetId()),
+		zap.String("action", action),
+	)
+	writeAdminJson(w, http.StatusOK, newAdminMatchResponse(match))
+}
+
+func (s *DefaultServer) handleAdminKickPlayer(w http.ResponseWriter, r *http.Request) {
+	match, err := s.getMatch(r.PathValue("matchId"))
+	if err != nil {
+		writeAdminError(w, err)
+		return
+	}
+	player, exist := match.GetPlayerWithId(r.PathValue("playerId"))
+	if !exist {
+		writeAdminError(w, ErrPlayerNotFound)
+		return
+	}
+	if !player.closeConn(websocket.ClosePolicyViolation, "kicked by admin") {
+		writeAdminJson(w, http.StatusConflict, adminErrorResponse{Error: "player not connected"})
+		return
+	}
+	logging.Info("player kicked by admin",
+		zap.String("match_id", match.GetId()),
+		zap.String("player_id", player.GetId()),
+	)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *DefaultServer) handleAdminGetProtection(w http.ResponseWriter, r *http.Request) {
+	writeAdminJson(w, http.StatusOK, s.protectionResponse())
+}
+
+// handleAdminSetProtection method    toggles the task protection, the
+// protection timer still changes it when it expires or is reset
+func (s *DefaultServer) handleAdminSetProtection(w http.ResponseWriter, r *http.Request) {
+	var req adminProtectionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeAdminJson(w, http.StatusBadRequest, adminErrorResponse{Error: err.Error()})
+		return
+	}
+	if err := s.setProtection(req.Enabled); err != nil {
+		writeAdminError(w, err)
+		return
+	}
+	writeAdminJson(w, http.StatusOK, s.protectionResponse())
+}
+
+func (s *DefaultServer) protectionResponse() adminProtectionResponse {
+	return adminProtectionResponse{
+		Enabled:   s.protected.Load(),
+		Remaining: s.protectionRemaining().String(),
+	}
+}
+
+func newAdminMatchResponse(match Match) adminMatchResponse {
+	resp := adminMatchResponse{
+		MatchId:  match.GetId(),
+		State:    matchStatus(match),
+		LoadedAt: match.getLoadedAt(),
+		Age:      match.Now().Sub(match.getLoadedAt()).Round(time.Second).String(),
+		Players:  make([]adminPlayerResponse, 0, len(match.GetPlayers())),
+	}
+	for _, player := range match.GetPlayers() {
+		resp.Players = append(resp.Players, adminPlayerResponse{
+			Id:     player.GetId(),
+			Status: player.GetStatus(),
+			Rtt:    player.GetRtt().String(),
+		})
+	}
+	return resp
+}
+
+// dumpMatch returns the state of the match from its DumpHandler, falling back
+// to its SnapshotHandler. It runs on the match goroutine unless it stopped
+func dumpMatch(match Match) (interface{}, error) {
+	var dump func() (interface{}, error)
+	switch handler := match.GetHandler().(type) {
+	case DumpHandler:
+		dump = handler.OnMatchDump
+	case SnapshotHandler:
+		dump = func() (interface{}, error) {
+			data, err := handler.OnMatchSnapshot()
+			return json.RawMessage(data), err
+		}
+	default:
+		return nil, nil
+	}
+	var state interface{}
+	var err error
+	fn := func() { state, err = dump() }
+	if !match.exec(fn) {
+		fn()
+	}
+	return state, err
+}
+
+func writeAdminError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, ErrMatchNotFound), errors.Is(err, ErrPlayerNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, ErrMatchEnded):
+		status = http.StatusConflict
+	}
+	writeAdminJson(w, status, adminErrorResponse{Error: err.Error()})
+}
+
+func writeAdminJson(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// adminRequest serves the request with the admin server, authenticated
+// with token, and decodes the response into v when not nil
+func adminRequest(t *testing.T, srv *testServer, method, path, token, body string, v any) int {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	srv.newAdminServer().Handler.ServeHTTP(rec, req)
+	if v != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+			t.Fatalf("%s %s: unmarshal %s: %v", method, path, rec.Body.Bytes(), err)
+		}
+	}
+	return rec.Code
+}
+
+func newAdminServer(t *testing.T) *testServer {
+	t.Helper()
+	srv := newTestServer(t, func(cfg *Config) {
+		cfg.adminToken = "secret"
+	})
+	srv.putActiveMatch("m1", "a", "b")
+	match, err := srv.loadMatch("m1")
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	match.ProcessMove(testMove{playerId: "a", n: 2})
+	return srv
+}
+
+func TestAdminAuth(t *testing.T) {
+	srv := newAdminServer(t)
+	for _, token := range []string{"", "wrong"} {
+		if code := adminRequest(t, srv, "GET", "/admin/matches", token, "", nil); code != http.StatusUnauthorized {
+			t.Fatalf("status %d with token %q, want 401", code, token)
+		}
+	}
+}
+
+func TestAdminMatches(t *testing.T) {
+	srv := newAdminServer(t)
+
+	var matches []adminMatchResponse
+	if code := adminRequest(t, srv, "GET", "/admin/matches", "secret", "", &matches); code != http.StatusOK {
+		t.Fatalf("list status %d", code)
+	}
+	if len(matches) != 1 || matches[0].MatchId != "m1" || matches[0].State != "waiting" || len(matches[0].Players) != 2 {
+		t.Fatalf("matches %+v", matches)
+	}
+
+	var match adminMatchResponse
+	if code := adminRequest(t, srv, "GET", "/admin/matches/m1", "secret", "", &match); code != http.StatusOK {
+		t.Fatalf("get status %d", code)
+	}
+	if match.Dump != 2.0 {
+		t.Fatalf("dump %v, want the snapshot of the match", match.Dump)
+	}
+	if code := adminRequest(t, srv, "GET", "/admin/matches/m2", "secret", "", nil); code != http.StatusNotFound {
+		t.Fatalf("unknown match status %d, want 404", code)
+	}
+}
+
+func TestAdminAbortMatch(t *testing.T) {
+	srv := newAdminServer(t)
+
+	var match adminMatchResponse
+	if code := adminRequest(t, srv, "POST", "/admin/matches/m1/abort", "secret", "", &match); code != http.StatusOK {
+		t.Fatalf("abort status %d", code)
+	}
+	if match.State != "ended" {
+		t.Fatalf("state %q, want ended", match.State)
+	}
+	if _, err := srv.getMatch("m1"); err == nil {
+		t.Fatal("aborted match still on the server")
+	}
+	eventually(t, func() bool {
+		srv.sink.mu.Lock()
+		defer srv.sink.mu.Unlock()
+		return len(srv.sink.aborts) == 1
+	}, "abort not published")
+	if code := adminRequest(t, srv, "POST", "/admin/matches/m1/end", "secret", "", nil); code != http.StatusNotFound {
+		t.Fatalf("end of the aborted match status %d, want 404", code)
+	}
+}
+
+func TestAdminKickPlayer(t *testing.T) {
+	srv := newAdminServer(t)
+	path := "/admin/matches/m1/players/a/kick"
+	if code := adminRequest(t, srv, "POST", path, "secret", "", nil); code != http.StatusConflict {
+		t.Fatalf("kick of a disconnected player status %d, want 409", code)
+	}
+
+	match, _ := srv.getMatch("m1")
+	player, _ := match.GetPlayerWithId("a")
+	conn, client := newTestConn(t)
+	player.setConn(conn)
+	if code := adminRequest(t, srv, "POST", path, "secret", "", nil); code != http.StatusNoContent {
+		t.Fatalf("kick status %d, want 204", code)
+	}
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	if _, _, err := client.ReadMessage(); !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+		t.Fatalf("read error %v, want a policy violation close", err)
+	}
+	if code := adminRequest(t, srv, "POST", "/admin/matches/m1/players/c/kick", "secret", "", nil); code != http.StatusNotFound {
+		t.Fatalf("kick of an unknown player status %d, want 404", code)
+	}
+}
+
+func TestAdminProtection(t *testing.T) {
+	srv := newAdminServer(t)
+
+	var protection adminProtectionResponse
+	code := adminRequest(t, srv, "PUT", "/admin/protection", "secret", `{"enabled":true}`, &protection)
+	if code != http.StatusOK || !protection.Enabled {
+		t.Fatalf("status %d, protection %+v, want enabled", code, protection)
+	}
+	code = adminRequest(t, srv, "PUT", "/admin/protection", "secret", `{"enabled":false}`, &protection)
+	if code != http.StatusOK || protection.Enabled {
+		t.Fatalf("status %d, protection %+v, want disabled", code, protection)
+	}
+	if code := adminRequest(t, srv, "PUT", "/admin/protection", "secret", `{`, nil); code != http.StatusBadRequest {
+		t.Fatalf("malformed request status %d, want 400", code)
+	}
+}
@@ -0,0 +1,212 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/yelaco/ludofy/internal/domains/dtos"
+	"github.com/yelaco/ludofy/pkg/logging"
+	"github.com/yelaco/ludofy/pkg/utils"
+	"go.uber.org/zap"
+)
+
+// maxSaveBackoff caps the delay between retries of a failed save
+const maxSaveBackoff = 10 * time.Second
+
+// closedCh is done right away, for the matches without saves
+var closedCh = func() chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}()
+
+// SavePolicy declares when a match saves its state, on top of the saves the
+// game requests with Save. A final save always runs before End or Abort
+type SavePolicy struct {
+	// EveryMoves saves after every N handled moves, 0 disables it
+	EveryMoves int
+	// Interval saves periodically, 0 disables it
+	Interval time.Duration
+	// OnDisconnect saves when a player disconnects
+	OnDisconnect bool
+}
+
+// SetSavePolicy method    sets when the match saves its state. Must be set
+// before the match starts
+func (m *DefaultMatch) SetSavePolicy(policy SavePolicy) {
+	m.savePolicy = policy
+}
+
+// startAutosave method    starts the interval saves of the save policy
+func (m *DefaultMatch) startAutosave() {
+	interval := m.savePolicy.Interval
+	if interval <= 0 {
+		return
+	}
+	m.saveTimer = m.Clock().AfterFunc(interval, func() {
+		if m.IsEnded() {
+			return
+		}
+		m.requestSave()
+		m.saveTimer.Reset(interval)
+	})
+}
+
+func (m *DefaultMatch) stopAutosave() {
+	if m.saveTimer != nil {
+		m.saveTimer.Stop()
+	}
+}
+
+// countMoves method    saves once the moves since the last save reach the
+// save policy
+func (m *DefaultMatch) countMoves(n int) {
+	every := m.savePolicy.EveryMoves
+	if every <= 0 || n == 0 {
+		return
+	}
+	if m.movesSinceSave.Add(int64(n)) >= int64(every) {
+		m.Save()
+	}
+}
+
+// requestSave method    asks the match goroutine to save, requests made
+// while one is pending are coalesced. Driven matches save synchronously
+func (m *DefaultMatch) requestSave() {
+	if m.driven.Load() {
+		m.Save()
+		return
+	}
+	select {
+	case m.saveCh <- struct{}{}:
+	default:
+	}
+}
+
+// matchSaver publishes the saved states of a match in the background. Only the
+// latest pending state is kept, a failed publish is retried with backoff
+// unless a newer state supersedes it
+type matchSaver struct {
+	matchId    string
+	sink       MatchSink
+	clock      utils.Clock
+	maxRetries int
+	backoff    time.Duration
+
+	pending *dtos.MatchStateRequest
+	running bool
+	idle    chan struct{}
+	mu      sync.Mutex
+}
+
+func (s *matchSaver) enqueue(req dtos.MatchStateRequest) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pending != nil {
+		logging.Info("pending save coalesced", zap.String("match_id", s.matchId))
+	}
+	s.pending = &req
+	if s.running {
+		return
+	}
+	s.running = true
+	s.idle = make(chan struct{})
+	go s.run()
+}
+
+func (s *matchSaver) run() {
+	for {
+		s.mu.Lock()
+		req := s.pending
+		if req == nil {
+			s.running = false
+			close(s.idle)
+			s.mu.Unlock()
+			return
+		}
+		s.pending = nil
+		s.mu.Unlock()
+
+		s.publish(*req)
+	}
+}
+
+func (s *matchSaver) publish(req dtos.MatchStateRequest) {
+	backoff := s.backoff
+	for attempt := 0; ; attempt++ {
+		err := s.sink.PublishMatchSave(context.Background(), req)
+		if err == nil {
+			return
+		}
+		backendFailures.WithLabelValues("save").Inc()
+		logging.Error("failed to save match",
+			zap.String("match_id", s.matchId),
+			zap.Int("attempt", attempt+1),
+			zap.Error(err),
+		)
+		if attempt >= s.maxRetries {
+			logging.Error("match save dropped", zap.String("match_id", s.matchId))
+			return
+		}
+		if s.superseded() {
+			logging.Info("failed save superseded", zap.String("match_id", s.matchId))
+			return
+		}
+		timer := s.clock.NewTimer(backoff)
+		<-timer.C()
+		backoff = min(2*backoff, maxSaveBackoff)
+	}
+}
+
+func (s *matchSaver) superseded() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pending != nil
+}
+
+// done method    returns a channel closed once the pending and in flight saves
+// are published or dropped
+func (s *matchSaver) done() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.running {
+		return closedCh
+	}
+	return s.idle
+}
+
+// flush method    waits until the pending and in flight saves are published
+// or dropped
+func (s *matchSaver) flush() {
+	<-s.done()
+}
+
+// saverFor method    returns the saver of the match
+func (s *DefaultServer) saverFor(matchId string) *matchSaver {
+	value, _ := s.savers.LoadOrStore(matchId, &matchSaver{
+		matchId:    matchId,
+		sink:       s.sink,
+		clock:      s.cfg.clock(),
+		maxRetries: s.cfg.saveMaxRetries,
+		backoff:    s.cfg.saveRetryBackoff,
+	})
+	return value.(*matchSaver)
+}
+
+// savesDone method    returns a channel closed once the saves of the match
+// are published or dropped
+func (s *DefaultServer) savesDone(matchId string) <-chan struct{} {
+	if value, ok := s.savers.Load(matchId); ok {
+		return value.(*matchSaver).done()
+	}
+	return closedCh
+}
+
+// flushAllSaves method    waits for the saves of every match to be published
+func (s *DefaultServer) flushAllSaves() {
+	s.savers.Range(func(key, value any) bool {
+		value.(*matchSaver).flush()
+		return true
+	})
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/yelaco/ludofy/internal/domains/dtos"
+	"github.com/yelaco/ludofy/pkg/utils"
+)
+
+func newTestSaver(sink MatchSink, maxRetries int) *matchSaver {
+	return &matchSaver{
+		matchId:    "m1",
+		sink:       sink,
+		clock:      utils.RealClock,
+		maxRetries: maxRetries,
+		backoff:    time.Millisecond,
+	}
+}
+
+func TestMatchSaverRetry(t *testing.T) {
+	sink := &testSink{failSaves: 2}
+	saver := newTestSaver(sink, 3)
+
+	saver.enqueue(dtos.MatchStateRequest{Id: "s1"})
+	saver.flush()
+	if sink.saveAttempts != 3 || sink.saveCount() != 1 {
+		t.Fatalf("%d attempts and %d saves, want the save published on the third attempt", sink.saveAttempts, sink.saveCount())
+	}
+}
+
+func TestMatchSaverDrop(t *testing.T) {
+	sink := &testSink{failSaves: 10}
+	saver := newTestSaver(sink, 2)
+
+	saver.enqueue(dtos.MatchStateRequest{Id: "s1"})
+	saver.flush()
+	if sink.saveAttempts != 3 || sink.saveCount() != 0 {
+		t.Fatalf("%d attempts and %d saves, want the save dropped after 2 retries", sink.saveAttempts, sink.saveCount())
+	}
+}
+
+func TestMatchSaverCoalesce(t *testing.T) {
+	sink := &testSink{saveGate: make(chan struct{})}
+	saver := newTestSaver(sink, 0)
+
+	saver.enqueue(dtos.MatchStateRequest{Id: "s1"})
+	eventually(t, func() bool { return !saver.superseded() }, "first save not taken")
+	saver.enqueue(dtos.MatchStateRequest{Id: "s2"})
+	saver.enqueue(dtos.MatchStateRequest{Id: "s3"})
+	close(sink.saveGate)
+	saver.flush()
+
+	if len(sink.saves) != 2 || sink.saves[0].Id != "s1" || sink.saves[1].Id != "s3" {
+		t.Fatalf("saves %+v, want s1 then only the latest pending s3", sink.saves)
+	}
+}
+
+func TestMatchEndAfterFinalSave(t *testing.T) {
+	srv := newTestServer(t, nil)
+	srv.sink.saveGate = make(chan struct{})
+	srv.putActiveMatch("m1", "a", "b")
+	match, err := srv.loadMatch("m1")
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	srv.HandleMatchSave(match)
+	ended := make(chan struct{})
+	go func() {
+		srv.HandleMatchEnd(match)
+		close(ended)
+	}()
+	select {
+	case <-ended:
+	case <-time.After(time.Second):
+		t.Fatal("match end waited for the pending save")
+	}
+	if srv.sink.endCount() != 0 {
+		t.Fatal("match end published before the final save")
+	}
+
+	close(srv.sink.saveGate)
+	eventually(t, func() bool { return srv.sink.endCount() == 1 }, "match end not published after the final save")
+	if srv.sink.saveCount() != 1 {
+		t.Fatalf("%d saves, want the final save", srv.sink.saveCount())
+	}
+}
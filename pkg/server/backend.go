@@ -0,0 +1,53 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/yelaco/ludofy/internal/domains/dtos"
+	"github.com/yelaco/ludofy/internal/domains/entities"
+)
+
+// MatchStore loads active matches and their latest saved state
+type MatchStore interface {
+	GetActiveMatch(ctx context.Context, matchId string) (entities.ActiveMatch, error)
+	// GetLatestMatchState returns nil when the match has never been saved
+	GetLatestMatchState(ctx context.Context, matchId string) (*entities.MatchState, error)
+	UpdateActiveMatch(ctx context.Context, matchId string, update ActiveMatchUpdate) error
+}
+
+// ActiveMatchUpdate holds the active match fields to update, nil fields are
+// left unchanged
+type ActiveMatchUpdate struct {
+	Server    *string
+	StartedAt *time.Time
+}
+
+// MatchSink publishes match lifecycle events to the rest of the backend
+type MatchSink interface {
+	PublishMatchSave(ctx context.Context, matchState dtos.MatchStateRequest) error
+	PublishMatchEnd(ctx context.Context, record MatchRecordRequest) error
+	PublishMatchAbort(ctx context.Context, req dtos.MatchAbortRequest) error
+}
+
+// SnapshotStore keeps the snapshots of matches handed over to another server
+// until the target server restores them
+type SnapshotStore interface {
+	PutMatchSnapshot(ctx context.Context, snapshot MatchSnapshot) error
+	// GetMatchSnapshot returns nil when the match has no snapshot
+	GetMatchSnapshot(ctx context.Context, matchId string) (*MatchSnapshot, error)
+	DeleteMatchSnapshot(ctx context.Context, matchId string) error
+}
+
+// MigrationTargetPicker picks the server the matches of a draining server are
+// handed over to
+type MigrationTargetPicker interface {
+	// PickMigrationTarget returns the address of another server which can take
+	// the matches
+	PickMigrationTarget(ctx context.Context) (string, error)
+}
+
+// ProtectionController toggles scale-in protection of the running task
+type ProtectionController interface {
+	UpdateServerProtection(ctx context.Context, enabled bool) error
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/yelaco/ludofy/pkg/utils"
+)
+
+// BotAgent plays the seat of a BotPlayer in process. It receives every
+// message written to the bot and decides the move to play in response
+type BotAgent interface {
+	// Think returns the move to play after the think time of the bot, or
+	// false to wait for the next message. A newer move replaces the one still
+	// pending. Agents must be deterministic for recorded matches to replay
+	Think(bot *BotPlayer, msg interface{}) (Move, bool)
+}
+
+// BotPlayer is a Player without a connection, played by a BotAgent. Bots
+// join as soon as their match is loaded and are always connected
+type BotPlayer struct {
+	*DefaultPlayer
+
+	agent     BotAgent
+	thinkTime time.Duration
+	match     Match
+	pending   utils.ClockTimer
+	botMu     *sync.Mutex
+}
+
+// NewBotPlayer creates a bot which plays the moves of the agent after
+// thinkTime on the clock of the match
+func NewBotPlayer(playerId, matchId string, agent BotAgent, thinkTime time.Duration) Player {
+	return &BotPlayer{
+		DefaultPlayer: NewDefaultPlayer(playerId, matchId).(*DefaultPlayer),
+		agent:         agent,
+		thinkTime:     thinkTime,
+		botMu:         new(sync.Mutex),
+	}
+}
+
+func (b *BotPlayer) IsBot() bool {
+	return true
+}
+
+// Match method    returns the match the bot plays, nil until it is loaded
+func (b *BotPlayer) Match() Match {
+	return b.match
+}
+
+// ThinkTime method    returns how long the bot waits before playing a move
+func (b *BotPlayer) ThinkTime() time.Duration {
+	return b.thinkTime
+}
+
+func (b *BotPlayer) attach(match Match) {
+	b.DefaultPlayer.attach(match)
+	b.botMu.Lock()
+	defer b.botMu.Unlock()
+	b.match = match
+}
+
+// setConn method    keeps the bot connected, it has no connection to lose
+func (b *BotPlayer) setConn(conn *websocket.Conn) {
+	b.setStatus(CONNECTED)
+}
+
+func (b *BotPlayer) resume(conn *websocket.Conn, lastSeq uint64) bool {
+	return false
+}
+
+// Write method    passes the view of the message to the agent and schedules
+// the move it decides on, moves are processed like the ones of connected
+// players
+func (b *BotPlayer) Write(msg interface{}) error {
+	msg, visible := b.project(msg)
+	if !visible {
+		return nil
+	}
+	return b.writeView(msg)
+}
+
+// writeView method    passes a message already projected for the bot to the agent
+func (b *BotPlayer) writeView(msg interface{}) error {
+	b.botMu.Lock()
+	defer b.botMu.Unlock()
+	if b.match == nil {
+		return nil
+	}
+	move, ok := b.agent.Think(b, msg)
+	if !ok {
+		return nil
+	}
+	if b.pending != nil {
+		b.pending.Stop()
+	}
+	match := b.match
+	b.pending = match.Clock().AfterFunc(b.thinkTime, func() {
+		match.ProcessMove(move)
+	})
+	return nil
+}
+
+func (b *BotPlayer) WriteJson(msg interface{}) error {
+	return b.Write(msg)
+}
+
+func (b *BotPlayer) WriteControl(messageType int, data []byte, deadline time.Time) error {
+	return nil
+}
+
+func (b *BotPlayer) closeConn(code int, reason string) bool {
+	return false
+}
+
+// joinBots method    attaches the bots of the match and joins them, they have
+// no connection to wait for
+func (s *DefaultServer) joinBots(match Match) {
+	for playerId, player := range match.GetPlayers() {
+		player.attach(match)
+		if player.IsBot() {
+			match.playerJoin(playerId, nil, nil)
+		}
+	}
+}
+
+// matchBots returns the ids of the bots playing the match
+func matchBots(match Match) []string {
+	var bots []string
+	for playerId, player := range match.GetPlayers() {
+		if player.IsBot() {
+			bots = append(bots, playerId)
+		}
+	}
+	return bots
+}
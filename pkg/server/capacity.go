@@ -0,0 +1,56 @@
+package server
+
+import (
+	"context"
+
+	"github.com/yelaco/ludofy/pkg/logging"
+	"go.uber.org/zap"
+)
+
+// CloseServerFull is the close code of the connections to a match the server
+// has no room for. The server of the match is cleared, clients resolve a new
+// one by restoring the match and connect to it
+const CloseServerFull = 4503
+
+// atCapacity method    reports whether the server hosts MAX_MATCHES matches
+// and refuses new ones
+func (s *DefaultServer) atCapacity() bool {
+	return s.cfg.maxMatches > 0 && s.totalMatches.Load() >= s.cfg.maxMatches
+}
+
+// atSoftLimit method    reports whether the server hosts SOFT_MAX_MATCHES
+// matches, it still accepts new ones but matchmaking prefers servers with
+// more headroom
+func (s *DefaultServer) atSoftLimit() bool {
+	return s.cfg.softMaxMatches > 0 && s.totalMatches.Load() >= s.cfg.softMaxMatches
+}
+
+// rejectMatch method    clears the server of a match refused for capacity, so
+// the next restore of the match resolves another server
+func (s *DefaultServer) rejectMatch(ctx context.Context, matchId string) {
+	matchEvents.WithLabelValues("reject").Inc()
+	logging.Info("match rejected, server at capacity",
+		zap.String("match_id", matchId),
+		zap.Int32("max_matches", s.cfg.maxMatches),
+	)
+	noServer := ""
+	err := s.store.UpdateActiveMatch(ctx, matchId, ActiveMatchUpdate{
+		Server: &noServer,
+	})
+	if err != nil {
+		backendFailures.WithLabelValues("reject").Inc()
+		logging.Error("failed to clear match server",
+			zap.String("match_id", matchId),
+			zap.Error(err),
+		)
+	}
+}
+
+// softMaxMatches returns the soft limit of the server, 80% of the maximum
+// number of matches unless SOFT_MAX_MATCHES is set
+func softMaxMatches(maxMatches, softMax int32) int32 {
+	if softMax > 0 {
+		return min(softMax, maxMatches)
+	}
+	return maxMatches * 4 / 5
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestLoadMatchAtCapacity(t *testing.T) {
+	srv := newTestServer(t, func(cfg *Config) {
+		cfg.maxMatches = 1
+	})
+	srv.putActiveMatch("m1", "a", "b")
+	srv.putActiveMatch("m2", "c", "d")
+	server := "here"
+	srv.store.UpdateActiveMatch(context.Background(), "m2", ActiveMatchUpdate{Server: &server})
+
+	if _, err := srv.loadMatch("m1"); err != nil {
+		t.Fatalf("load m1: %v", err)
+	}
+	if _, err := srv.loadMatch("m2"); !errors.Is(err, ErrServerFull) {
+		t.Fatalf("load m2 error %v, want %v", err, ErrServerFull)
+	}
+	activeMatch, _ := srv.store.GetActiveMatch(context.Background(), "m2")
+	if activeMatch.Server != "" {
+		t.Fatalf("server of the rejected match %q, want it cleared", activeMatch.Server)
+	}
+	if srv.handler.created != 1 {
+		t.Fatalf("created %d matches, want only m1", srv.handler.created)
+	}
+
+	// matches already hosted still load at capacity
+	if _, err := srv.loadMatch("m1"); err != nil {
+		t.Fatalf("reload m1: %v", err)
+	}
+
+	srv.removeMatch("m1")
+	if _, err := srv.loadMatch("m2"); err != nil {
+		t.Fatalf("load m2 once m1 is gone: %v", err)
+	}
+}
+
+func TestSoftMaxMatches(t *testing.T) {
+	tests := []struct {
+		maxMatches, softMax, want int32
+	}{
+		{maxMatches: 100, softMax: 0, want: 80},
+		{maxMatches: 100, softMax: 50, want: 50},
+		{maxMatches: 100, softMax: 200, want: 100},
+		{maxMatches: 0, softMax: 0, want: 0},
+	}
+	for _, tt := range tests {
+		if got := softMaxMatches(tt.maxMatches, tt.softMax); got != tt.want {
+			t.Errorf("softMaxMatches(%d, %d) = %d, want %d", tt.maxMatches, tt.softMax, got, tt.want)
+		}
+	}
+}
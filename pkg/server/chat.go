@@ -0,0 +1,254 @@
+package server
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/yelaco/ludofy/pkg/logging"
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultChatMaxLength is the maximum number of characters of a chat
+	// message when the chat policy doesn't set one
+	defaultChatMaxLength = 500
+	// defaultChatMaxLogBytes is the maximum size of the chat kept in the
+	// match record when the chat policy doesn't set one, well under the
+	// 400 KB item limit of DynamoDB
+	defaultChatMaxLogBytes = 64 << 10
+)
+
+// ChatPolicy enables the built-in chat of a match. Players send
+// {"type":"chat","data":{"text":"..."}} to talk and
+// {"type":"chatMute","data":{"playerId":"...","muted":true}} to stop receiving
+// the messages of another player
+type ChatPolicy struct {
+	// Spectators receive the chat of the players too
+	Spectators bool
+	// MaxLength is the maximum number of characters of a message, 500 when 0
+	MaxLength int
+	// MaxLogBytes is the maximum size in bytes of the chat kept in the match
+	// record, the oldest lines are dropped first. 64 KB when 0
+	MaxLogBytes int
+}
+
+func (p ChatPolicy) maxLength() int {
+	if p.MaxLength <= 0 {
+		return defaultChatMaxLength
+	}
+	return p.MaxLength
+}
+
+func (p *ChatPolicy) maxLogBytes() int {
+	if p == nil || p.MaxLogBytes <= 0 {
+		return defaultChatMaxLogBytes
+	}
+	return p.MaxLogBytes
+}
+
+// ChatLine is a relayed chat message, kept in the match record
+type ChatLine struct {
+	PlayerId  string    `json:"playerId"`
+	Text      string    `json:"text"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// size is the number of bytes the line takes in the match record, roughly
+func (l ChatLine) size() int {
+	return len(l.PlayerId) + len(l.Text) + len(time.RFC3339Nano)
+}
+
+type chatRequest struct {
+	Text string `json:"text"`
+}
+
+type chatMuteRequest struct {
+	PlayerId string `json:"playerId"`
+	Muted    bool   `json:"muted"`
+}
+
+type chatResponse struct {
+	Type string `json:"type"`
+	ChatLine
+}
+
+type chatMuteResponse struct {
+	Type     string `json:"type"`
+	PlayerId string `json:"playerId"`
+	Muted    bool   `json:"muted"`
+}
+
+// SetChatPolicy method    enables the built-in chat of the match. Must be set
+// before the match starts
+func (m *DefaultMatch) SetChatPolicy(policy ChatPolicy) {
+	m.chatPolicy = &policy
+}
+
+// handleChat method    handles the chat messages of the player, false if the
+// message isn't one or the chat is disabled
+func (m *DefaultMatch) handleChat(playerId string, message []byte) bool {
+	if m.chatPolicy == nil {
+		return false
+	}
+	var envelope struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(message, &envelope); err != nil {
+		return false
+	}
+	player, exist := m.Players[playerId]
+	if !exist {
+		return false
+	}
+	switch envelope.Type {
+	case "chat":
+		m.exec(func() {
+			if !m.IsEnded() {
+				m.recordMessage(playerId)
+				m.relayChat(player, message)
+			}
+		})
+	case "chatMute":
+		m.muteChat(player, message)
+	default:
+		return false
+	}
+	return true
+}
+
+// relayChat method    passes the message through the ChatHandler of the match
+// and relays it to the players which didn't mute the sender. Runs on the
+// match goroutine
+func (m *DefaultMatch) relayChat(player Player, message []byte) {
+	var msg Message[chatRequest]
+	if err := json.Unmarshal(message, &msg); err != nil {
+		m.rejectChat(player, ErrStatusMalformedPayload)
+		return
+	}
+	text := strings.TrimSpace(msg.Data.Text)
+	if text == "" || utf8.RuneCountInString(text) > m.chatPolicy.maxLength() {
+		m.rejectChat(player, ErrStatusInvalidPayload)
+		return
+	}
+	if handler, ok := m.handler.(ChatHandler); ok {
+		var allowed bool
+		text, allowed = handler.OnChat(player, text)
+		if !allowed {
+			m.rejectChat(player, ErrStatusChatRejected)
+			return
+		}
+	}
+
+	line := ChatLine{
+		PlayerId:  player.GetId(),
+		Text:      text,
+		CreatedAt: m.Now(),
+	}
+	recipients := make([]Player, 0, len(m.Players))
+	m.chatMu.Lock()
+	m.appendChatLog(line)
+	for id, recipient := range m.Players {
+		if _, muted := m.chatMutes[id][line.PlayerId]; !muted {
+			recipients = append(recipients, recipient)
+		}
+	}
+	m.chatMu.Unlock()
+
+	resp := chatResponse{
+		Type:     "chat",
+		ChatLine: line,
+	}
+	for _, recipient := range recipients {
+		if err := recipient.WriteJson(resp); err != nil {
+			logging.Error("couldn't relay chat to player",
+				zap.String("player_id", recipient.GetId()),
+				zap.Error(err),
+			)
+		}
+	}
+	if m.chatPolicy.Spectators {
+		m.broadcastToSpectators(resp)
+	}
+}
+
+// muteChat method    adds or removes a player from the mute list of the player
+func (m *DefaultMatch) muteChat(player Player, message []byte) {
+	var msg Message[chatMuteRequest]
+	if err := json.Unmarshal(message, &msg); err != nil {
+		m.rejectChat(player, ErrStatusMalformedPayload)
+		return
+	}
+	target := msg.Data.PlayerId
+	if _, exist := m.Players[target]; !exist || target == player.GetId() {
+		m.rejectChat(player, ErrStatusInvalidPlayerId)
+		return
+	}
+
+	m.chatMu.Lock()
+	mutes, exist := m.chatMutes[player.GetId()]
+	if !exist {
+		mutes = make(map[string]struct{})
+		m.chatMutes[player.GetId()] = mutes
+	}
+	if msg.Data.Muted {
+		mutes[target] = struct{}{}
+	} else {
+		delete(mutes, target)
+	}
+	m.chatMu.Unlock()
+
+	player.WriteJson(chatMuteResponse{
+		Type:     "chatMute",
+		PlayerId: target,
+		Muted:    msg.Data.Muted,
+	})
+}
+
+func (m *DefaultMatch) rejectChat(player Player, status string) {
+	logging.Info("chat message rejected",
+		zap.String("match_id", m.GetId()),
+		zap.String("player_id", player.GetId()),
+		zap.String("status", status),
+	)
+	player.WriteJson(errorResponse{
+		Type:  "error",
+		Error: status,
+	})
+}
+
+// getChatLog method    returns the chat lines relayed so far
+func (m *DefaultMatch) getChatLog() []ChatLine {
+	m.chatMu.Lock()
+	defer m.chatMu.Unlock()
+	return append([]ChatLine(nil), m.chatLog...)
+}
+
+// setChatLog method    restores the chat of a match handed over by another
+// server
+func (m *DefaultMatch) setChatLog(lines []ChatLine) {
+	m.chatMu.Lock()
+	defer m.chatMu.Unlock()
+	m.chatLog = nil
+	m.chatLogBytes = 0
+	for _, line := range lines {
+		m.appendChatLog(line)
+	}
+}
+
+// appendChatLog method    keeps the line in the chat log, dropping the oldest
+// lines past the MaxLogBytes of the chat policy. chatMu must be held
+func (m *DefaultMatch) appendChatLog(line ChatLine) {
+	m.chatLog = append(m.chatLog, line)
+	m.chatLogBytes += line.size()
+	limit := m.chatPolicy.maxLogBytes()
+	dropped := 0
+	for m.chatLogBytes > limit && dropped < len(m.chatLog) {
+		m.chatLogBytes -= m.chatLog[dropped].size()
+		dropped++
+	}
+	if dropped > 0 {
+		m.chatLog = append([]ChatLine(nil), m.chatLog[dropped:]...)
+	}
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// censorHandler drops the chat messages mentioning secrets and shouts the others
+type censorHandler struct {
+	*testMatchHandler
+}
+
+func (h *censorHandler) OnChat(player Player, text string) (string, bool) {
+	if strings.Contains(text, "secret") {
+		return "", false
+	}
+	return strings.ToUpper(text), true
+}
+
+func newChatDriver(t *testing.T, policy ChatPolicy, censor bool) *testDriver {
+	t.Helper()
+	return newTestDriver(t, Config{ServerHandler: &testServerHandler{setup: func(match *DefaultMatch) {
+		match.SetChatPolicy(policy)
+		if censor {
+			match.SetHandler(&censorHandler{match.GetHandler().(*testMatchHandler)})
+		}
+	}}}, "a", "b")
+}
+
+func chatTexts(d *testDriver, playerId string) []string {
+	texts := []string{}
+	for _, msg := range d.ofType(playerId, "chat") {
+		texts = append(texts, msg["text"].(string))
+	}
+	return texts
+}
+
+func TestChatRelayAndMute(t *testing.T) {
+	d := newChatDriver(t, ChatPolicy{MaxLength: 5}, false)
+
+	d.send(t, "a", `{"type":"chat","data":{"text":" hi "}}`)
+	d.send(t, "b", `{"type":"chatMute","data":{"playerId":"a","muted":true}}`)
+	d.send(t, "a", `{"type":"chat","data":{"text":"yo"}}`)
+	if got := chatTexts(d, "a"); !reflect.DeepEqual(got, []string{"hi", "yo"}) {
+		t.Fatalf("a got %v", got)
+	}
+	if got := chatTexts(d, "b"); !reflect.DeepEqual(got, []string{"hi"}) {
+		t.Fatalf("b got %v, want nothing once a is muted", got)
+	}
+	if len(d.ofType("b", "chatMute")) != 1 {
+		t.Fatal("mute not confirmed")
+	}
+
+	d.send(t, "a", `{"type":"chat","data":{"text":"too long"}}`)
+	d.send(t, "a", `{"type":"chat","data":{"text":"  "}}`)
+	d.send(t, "b", `{"type":"chatMute","data":{"playerId":"b","muted":true}}`)
+	if got := d.errors("a"); !reflect.DeepEqual(got, []string{ErrStatusInvalidPayload, ErrStatusInvalidPayload}) {
+		t.Fatalf("a errors %v", got)
+	}
+	if got := d.errors("b"); !reflect.DeepEqual(got, []string{ErrStatusInvalidPlayerId}) {
+		t.Fatalf("b errors %v, want self mute refused", got)
+	}
+
+	if d.total() != 0 {
+		t.Fatal("chat messages reached the match handler")
+	}
+	d.Match().End()
+	if len(d.End.Chat) != 2 {
+		t.Fatalf("record chat %v, want the relayed lines", d.End.Chat)
+	}
+}
+
+func TestChatHandler(t *testing.T) {
+	d := newChatDriver(t, ChatPolicy{}, true)
+
+	d.send(t, "a", `{"type":"chat","data":{"text":"gg"}}`)
+	d.send(t, "a", `{"type":"chat","data":{"text":"my secret"}}`)
+	if got := chatTexts(d, "b"); !reflect.DeepEqual(got, []string{"GG"}) {
+		t.Fatalf("b got %v, want the rewritten message only", got)
+	}
+	if got := d.errors("a"); !reflect.DeepEqual(got, []string{ErrStatusChatRejected}) {
+		t.Fatalf("a errors %v", got)
+	}
+}
+
+func TestChatLogLimit(t *testing.T) {
+	line := ChatLine{PlayerId: "a", Text: "hello"}
+	d := newChatDriver(t, ChatPolicy{MaxLogBytes: 2 * line.size()}, false)
+
+	for _, text := range []string{"one", "two", "three"} {
+		d.send(t, "a", `{"type":"chat","data":{"text":"`+text+`"}}`)
+	}
+	var texts []string
+	for _, line := range d.Match().getChatLog() {
+		texts = append(texts, line.Text)
+	}
+	if !reflect.DeepEqual(texts, []string{"two", "three"}) {
+		t.Fatalf("chat log %v, want the oldest line dropped", texts)
+	}
+}
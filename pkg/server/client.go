@@ -1,13 +1,236 @@
 package server
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
 	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
 	"github.com/yelaco/ludofy/internal/aws/compute"
 	"github.com/yelaco/ludofy/internal/aws/storage"
+	"github.com/yelaco/ludofy/internal/domains/dtos"
+	"github.com/yelaco/ludofy/internal/domains/entities"
+	"github.com/yelaco/ludofy/pkg/logging"
+	"go.uber.org/zap"
 )
 
-var (
+// awsMatchStore is the default MatchStore backed by DynamoDB
+type awsMatchStore struct {
 	storageClient *storage.Client
-	computeClient *compute.Client
-	lambdaClient  *lambda.Client
-)
+}
+
+func newAwsMatchStore(cfg Config) MatchStore {
+	return &awsMatchStore{
+		storageClient: storage.NewClient(
+			dynamodb.NewFromConfig(cfg.awsCfg),
+		),
+	}
+}
+
+func (s *awsMatchStore) GetActiveMatch(
+	ctx context.Context,
+	matchId string,
+) (entities.ActiveMatch, error) {
+	return s.storageClient.GetActiveMatch(ctx, matchId)
+}
+
+func (s *awsMatchStore) GetLatestMatchState(
+	ctx context.Context,
+	matchId string,
+) (*entities.MatchState, error) {
+	matchStates, _, err := s.storageClient.FetchMatchStates(
+		ctx,
+		matchId,
+		nil,
+		1,
+		false,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(matchStates) == 0 {
+		return nil, nil
+	}
+	return &matchStates[0], nil
+}
+
+func (s *awsMatchStore) UpdateActiveMatch(
+	ctx context.Context,
+	matchId string,
+	update ActiveMatchUpdate,
+) error {
+	return s.storageClient.UpdateActiveMatch(
+		ctx,
+		matchId,
+		storage.ActiveMatchUpdateOptions{
+			Server:    update.Server,
+			StartedAt: update.StartedAt,
+		},
+	)
+}
+
+// awsMatchSink is the default MatchSink which saves match states through
+// AppSync and invokes the end game and abort game Lambda functions
+type awsMatchSink struct {
+	lambdaClient *lambda.Client
+	httpClient   *http.Client
+	cfg          Config
+}
+
+func newAwsMatchSink(cfg Config) MatchSink {
+	return &awsMatchSink{
+		lambdaClient: lambda.NewFromConfig(cfg.awsCfg),
+		httpClient:   new(http.Client),
+		cfg:          cfg,
+	}
+}
+
+func (s *awsMatchSink) PublishMatchSave(
+	ctx context.Context,
+	matchState dtos.MatchStateRequest,
+) error {
+	matchStateAppSyncReq := dtos.NewMatchStateAppSyncRequest(matchState)
+	payload, err := json.Marshal(matchStateAppSyncReq)
+	if err != nil {
+		return fmt.Errorf("failed to marshal match state: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(
+		ctx,
+		"POST",
+		s.cfg.appSyncHttpUrl,
+		bytes.NewReader(payload),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// Sign the request
+	signer := v4.NewSigner()
+	credentials, err := s.cfg.appsyncCfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve credentials: %w", err)
+	}
+	err = signer.SignHTTP(
+		ctx,
+		credentials,
+		req,
+		sha256Hash(payload),
+		"appsync",
+		s.cfg.awsCfg.Region,
+		time.Now(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to sign request: %w", err)
+	}
+
+	response, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		body, err := io.ReadAll(response.Body)
+		if err != nil {
+			return fmt.Errorf("failed to read response body: %w", err)
+		}
+		return fmt.Errorf("200 expected: %s", string(body))
+	}
+	return nil
+}
+
+func (s *awsMatchSink) PublishMatchEnd(
+	ctx context.Context,
+	record MatchRecordRequest,
+) error {
+	payload, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal match record request: %w", err)
+	}
+	return s.invoke(ctx, s.cfg.endGameFunctionArn, payload)
+}
+
+func (s *awsMatchSink) PublishMatchAbort(
+	ctx context.Context,
+	req dtos.MatchAbortRequest,
+) error {
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to marshal match abort request: %w", err)
+	}
+	return s.invoke(ctx, s.cfg.abortGameFunctionArn, payload)
+}
+
+// invoke method    runs the function and waits for it, so an error of the
+// function fails the publish and the event is retried from the spool
+func (s *awsMatchSink) invoke(ctx context.Context, functionArn string, payload []byte) error {
+	output, err := s.lambdaClient.Invoke(ctx, &lambda.InvokeInput{
+		FunctionName:   aws.String(functionArn),
+		Payload:        payload,
+		InvocationType: types.InvocationTypeRequestResponse,
+	})
+	if err != nil {
+		return err
+	}
+	if output.FunctionError != nil {
+		return fmt.Errorf("function error %s: %s", *output.FunctionError, string(output.Payload))
+	}
+	return nil
+}
+
+func newAwsProtectionController(cfg Config) ProtectionController {
+	return compute.NewClient(
+		ecs.NewFromConfig(cfg.awsCfg),
+		nil,
+		nil,
+	)
+}
+
+type awsMigrationTargetPicker struct {
+	compute     *compute.Client
+	serviceName string
+}
+
+// newAwsMigrationTargetPicker picks the server with the most headroom among
+// the other tasks of the service
+func newAwsMigrationTargetPicker(cfg Config, serviceName string) MigrationTargetPicker {
+	return &awsMigrationTargetPicker{
+		compute: compute.NewClient(
+			ecs.NewFromConfig(cfg.awsCfg),
+			ec2.NewFromConfig(cfg.awsCfg),
+			nil,
+		),
+		serviceName: serviceName,
+	}
+}
+
+func (p *awsMigrationTargetPicker) PickMigrationTarget(ctx context.Context) (string, error) {
+	return p.compute.GetMigrationTargetIp(ctx, p.serviceName)
+}
+
+// awsServerAddress returns the public ip of the task, which is what the
+// migration targets of other servers are
+func awsServerAddress(cfg Config) string {
+	client := compute.NewClient(
+		ecs.NewFromConfig(cfg.awsCfg),
+		ec2.NewFromConfig(cfg.awsCfg),
+		nil,
+	)
+	address, err := client.GetTaskIp(context.Background())
+	if err != nil {
+		logging.Fatal("failed to get server address, set SERVER_ADDRESS", zap.Error(err))
+	}
+	return address
+}
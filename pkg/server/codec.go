@@ -0,0 +1,244 @@
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Websocket subprotocols selecting the wire codec of a connection, clients
+// which don't request any of them use json
+const (
+	SubprotocolJson     = "json"
+	SubprotocolMsgpack  = "msgpack"
+	SubprotocolProtobuf = "protobuf"
+)
+
+// codec encodes the messages of a connection. Inbound messages are converted
+// to JSON so handlers work the same whatever the codec
+type codec interface {
+	messageType() int
+	// encode marshals the message, stamping it with seq when seq is not 0
+	encode(msg interface{}, seq uint64) ([]byte, error)
+	toJson(data []byte) ([]byte, error)
+	fromJson(data []byte) ([]byte, error)
+}
+
+var codecs = map[string]codec{
+	SubprotocolJson:     jsonCodec{},
+	SubprotocolMsgpack:  msgpackCodec{},
+	SubprotocolProtobuf: structpbCodec{},
+}
+
+// codecOf returns the codec negotiated by the connection
+func codecOf(conn *websocket.Conn) codec {
+	if conn != nil {
+		if c, exist := codecs[conn.Subprotocol()]; exist {
+			return c
+		}
+	}
+	return jsonCodec{}
+}
+
+// transcode converts a message encoded by a codec to another one
+func transcode(data []byte, from, to codec) ([]byte, error) {
+	if from == to {
+		return data, nil
+	}
+	jsonData, err := from.toJson(data)
+	if err != nil {
+		return nil, err
+	}
+	return to.fromJson(jsonData)
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) messageType() int {
+	return websocket.TextMessage
+}
+
+func (jsonCodec) encode(msg interface{}, seq uint64) ([]byte, error) {
+	if seq == 0 {
+		return json.Marshal(msg)
+	}
+	return stampSequence(msg, seq)
+}
+
+func (jsonCodec) toJson(data []byte) ([]byte, error) {
+	return data, nil
+}
+
+func (jsonCodec) fromJson(data []byte) ([]byte, error) {
+	return data, nil
+}
+
+// msgpackCodec encodes structs by their json tags
+type msgpackCodec struct{}
+
+func (msgpackCodec) messageType() int {
+	return websocket.BinaryMessage
+}
+
+func (msgpackCodec) encode(msg interface{}, seq uint64) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	enc.UseCompactInts(true)
+	if err := enc.Encode(msg); err != nil {
+		return nil, fmt.Errorf("failed to marshal message: %w", err)
+	}
+	if seq == 0 {
+		return buf.Bytes(), nil
+	}
+	return stampMsgpack(buf.Bytes(), seq)
+}
+
+func (msgpackCodec) toJson(data []byte) ([]byte, error) {
+	var v interface{}
+	if err := msgpack.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+func (c msgpackCodec) fromJson(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return c.encode(jsonNumbers(v), 0)
+}
+
+// stampMsgpack adds the sequence number as first key of msgpack maps. Maps
+// which already have a seqField key can't be stamped
+func stampMsgpack(data []byte, seq uint64) ([]byte, error) {
+	if len(data) == 0 {
+		return data, nil
+	}
+	var header, body []byte
+	switch b := data[0]; {
+	case b >= 0x80 && b < 0x8f: // fixmap
+		header = []byte{b + 1}
+		body = data[1:]
+	case b == 0x8f:
+		header = []byte{0xde, 0, 16}
+		body = data[1:]
+	case b == 0xde && len(data) >= 3 && binary.BigEndian.Uint16(data[1:]) < 0xffff: // map16
+		header = binary.BigEndian.AppendUint16([]byte{0xde}, binary.BigEndian.Uint16(data[1:])+1)
+		body = data[3:]
+	case b == 0xdf && len(data) >= 5: // map32
+		header = binary.BigEndian.AppendUint32([]byte{0xdf}, binary.BigEndian.Uint32(data[1:])+1)
+		body = data[5:]
+	default:
+		return data, nil
+	}
+	hasSeq, err := msgpackHasKey(data, seqField)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read message: %w", err)
+	}
+	if hasSeq {
+		return nil, ErrSeqFieldReserved
+	}
+	stamped := make([]byte, 0, len(header)+len(seqField)+10+len(body))
+	stamped = append(stamped, header...)
+	stamped = append(stamped, 0xa0|byte(len(seqField))) // fixstr
+	stamped = append(stamped, seqField...)
+	stamped = append(stamped, 0xcf) // uint64
+	stamped = binary.BigEndian.AppendUint64(stamped, seq)
+	return append(stamped, body...), nil
+}
+
+// msgpackHasKey reports whether the msgpack map has the key at its top level
+func msgpackHasKey(data []byte, key string) (bool, error) {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	n, err := dec.DecodeMapLen()
+	if err != nil {
+		return false, err
+	}
+	for i := 0; i < n; i++ {
+		k, err := dec.DecodeInterface()
+		if err != nil {
+			return false, err
+		}
+		if k == key {
+			return true, nil
+		}
+		if err := dec.Skip(); err != nil {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+// jsonNumbers converts the numbers decoded with UseNumber to integers when possible
+func jsonNumbers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for key, value := range v {
+			v[key] = jsonNumbers(value)
+		}
+	case []interface{}:
+		for i, value := range v {
+			v[i] = jsonNumbers(value)
+		}
+	}
+	return v
+}
+
+// structpbCodec is the codec of the protobuf subprotocol. Every message is
+// sent as a google.protobuf.Value holding its JSON form, proto messages
+// included through their protojson mapping, so clients decode a single type
+// and messages are stamped like JSON ones. Typed proto messages of the game
+// are not sent as themselves
+type structpbCodec struct{}
+
+func (structpbCodec) messageType() int {
+	return websocket.BinaryMessage
+}
+
+func (c structpbCodec) encode(msg interface{}, seq uint64) ([]byte, error) {
+	if m, ok := msg.(proto.Message); ok {
+		data, err := protojson.Marshal(m)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal message: %w", err)
+		}
+		msg = json.RawMessage(data)
+	}
+	data, err := jsonCodec{}.encode(msg, seq)
+	if err != nil {
+		return nil, err
+	}
+	return c.fromJson(data)
+}
+
+func (structpbCodec) toJson(data []byte) ([]byte, error) {
+	var v structpb.Value
+	if err := proto.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return protojson.Marshal(&v)
+}
+
+func (structpbCodec) fromJson(data []byte) ([]byte, error) {
+	var v structpb.Value
+	if err := protojson.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return proto.Marshal(&v)
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+type codecMessage struct {
+	Type  string   `json:"type"`
+	Count int      `json:"count"`
+	Moves []string `json:"moves"`
+}
+
+func decodeJson(t *testing.T, c codec, data []byte) map[string]interface{} {
+	t.Helper()
+	jsonData, err := c.toJson(data)
+	if err != nil {
+		t.Fatalf("toJson: %v", err)
+	}
+	var v map[string]interface{}
+	if err := json.Unmarshal(jsonData, &v); err != nil {
+		t.Fatalf("unmarshal %s: %v", jsonData, err)
+	}
+	return v
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	msg := codecMessage{Type: "gameState", Count: 3, Moves: []string{"e4", "e5"}}
+	want := map[string]interface{}{
+		"type":  "gameState",
+		"count": 3.0,
+		"moves": []interface{}{"e4", "e5"},
+	}
+	tests := []struct {
+		name  string
+		codec codec
+		seq   uint64
+	}{
+		{name: "msgpack", codec: msgpackCodec{}},
+		{name: "msgpack stamped", codec: msgpackCodec{}, seq: 7},
+		{name: "protobuf", codec: structpbCodec{}},
+		{name: "protobuf stamped", codec: structpbCodec{}, seq: 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := tt.codec.encode(msg, tt.seq)
+			if err != nil {
+				t.Fatalf("encode: %v", err)
+			}
+			got := decodeJson(t, tt.codec, data)
+			decoded := decodeJson(t, tt.codec, data)
+			if tt.seq != 0 {
+				if got[seqField] != float64(tt.seq) {
+					t.Fatalf("seq %v, want %d", got[seqField], tt.seq)
+				}
+				delete(got, seqField)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("decoded %v, want %v", got, want)
+			}
+
+			jsonData, err := tt.codec.toJson(data)
+			if err != nil {
+				t.Fatalf("toJson: %v", err)
+			}
+			encoded, err := tt.codec.fromJson(jsonData)
+			if err != nil {
+				t.Fatalf("fromJson: %v", err)
+			}
+			if again := decodeJson(t, tt.codec, encoded); !reflect.DeepEqual(again, decoded) {
+				t.Fatalf("fromJson decoded %v, want %v", again, decoded)
+			}
+		})
+	}
+}
+
+func TestStructpbCodecProtoMessage(t *testing.T) {
+	msg, err := structpb.NewStruct(map[string]interface{}{"type": "gameState", "count": 3})
+	if err != nil {
+		t.Fatalf("NewStruct: %v", err)
+	}
+	data, err := structpbCodec{}.encode(msg, 4)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	got := decodeJson(t, structpbCodec{}, data)
+	want := map[string]interface{}{seqField: 4.0, "type": "gameState", "count": 3.0}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("decoded %v, want %v", got, want)
+	}
+}
+
+func TestTranscode(t *testing.T) {
+	data, err := msgpackCodec{}.encode(codecMessage{Type: "gameState", Count: 1}, 2)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	transcoded, err := transcode(data, msgpackCodec{}, structpbCodec{})
+	if err != nil {
+		t.Fatalf("transcode: %v", err)
+	}
+	got := decodeJson(t, structpbCodec{}, transcoded)
+	if got[seqField] != 2.0 || got["type"] != "gameState" || got["count"] != 1.0 {
+		t.Fatalf("transcoded %v", got)
+	}
+}
+
+func TestStampReservedSeq(t *testing.T) {
+	msg := map[string]interface{}{"type": "gameState", seqField: 1}
+	for name, c := range codecs {
+		t.Run(name, func(t *testing.T) {
+			if _, err := c.encode(map[string]interface{}{"type": "move", "seq": 1}, 2); err != nil {
+				t.Fatalf("encode of a game seq field: %v", err)
+			}
+			if _, err := c.encode(msg, 2); !errors.Is(err, ErrSeqFieldReserved) {
+				t.Fatalf("encode error %v, want ErrSeqFieldReserved", err)
+			}
+			if _, err := c.encode(msg, 0); err != nil {
+				t.Fatalf("unstamped encode: %v", err)
+			}
+		})
+	}
+}
@@ -4,50 +4,136 @@ import (
 	"context"
 	"crypto/rsa"
 	"fmt"
+	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/spf13/viper"
 	awsAuth "github.com/yelaco/ludofy/internal/aws/auth"
 	"github.com/yelaco/ludofy/pkg/logging"
-	"github.com/spf13/viper"
+	"github.com/yelaco/ludofy/pkg/utils"
 	"go.uber.org/zap"
 )
 
 type Config struct {
 	Port          string
 	ServerHandler ServerHandler
+	// Router dispatches typed messages, OnHandleMessage is used when nil
+	Router *Router
+
+	// Backends default to the AWS implementations when left nil
+	MatchStore           MatchStore
+	MatchSink            MatchSink
+	ProtectionController ProtectionController
+	// RecordingSink saves the inputs of every match for replay, nil disables recording
+	RecordingSink RecordingSink
+	// SnapshotStore hands matches over to other servers, nil disables migration
+	SnapshotStore SnapshotStore
+	// MigrationTargetPicker picks the server to hand matches over to when the
+	// server drains, nil disables migration
+	MigrationTargetPicker MigrationTargetPicker
+	// Address is this server as other servers pick it for migration, only
+	// snapshots targeting it are restored here. Required with a SnapshotStore
+	Address string
+	// Clock drives match timers and server protection, the wall clock when nil
+	Clock utils.Clock
 
+	mode                 string
 	cognitoUserPoolId    string
 	appSyncHttpUrl       string
 	appSyncAccessRoleArn string
 	abortGameFunctionArn string
 	endGameFunctionArn   string
 	maxMatches           int32
+	softMaxMatches       int32
+	maxSpectators        int
+	outboxSize           int
 	protectionTimeout    time.Duration
+	shutdownGracePeriod  time.Duration
+	pingInterval         time.Duration
+	readTimeout          time.Duration
+	rateLimit            rateLimitConfig
+	saveMaxRetries       int
+	saveRetryBackoff     time.Duration
+	spoolDir             string
+	spoolOwner           string
+	spoolRetryBackoff    time.Duration
+	spoolMaxAge          time.Duration
+	recordingMaxBytes    int
+	adminPort            string
+	adminToken           string
+	allowedOrigins       []string
+	tls                  tlsConfig
 
 	awsCfg            aws.Config
 	appsyncCfg        aws.Config
 	cognitoPublicKeys map[string]*rsa.PublicKey
+
+	localDataDir     string
+	localTokenSecret []byte
+	localApiAddr     string
 }
 
 func NewConfig(port string, serverHandler ServerHandler) Config {
 	viper.AutomaticEnv()
+	viper.SetDefault("MAX_MATCHES", 100)
+	viper.SetDefault("PLAYER_OUTBOX_SIZE", 128)
+	viper.SetDefault("SHUTDOWN_GRACE_PERIOD", "30s")
+	viper.SetDefault("PING_INTERVAL", "10s")
+	viper.SetDefault("READ_TIMEOUT", "30s")
+	viper.SetDefault("SAVE_MAX_RETRIES", 5)
+	viper.SetDefault("SAVE_RETRY_BACKOFF", "500ms")
+	viper.SetDefault("SPOOL_RETRY_BACKOFF", "1s")
+	viper.SetDefault("SPOOL_MAX_AGE", "24h")
+	// Recordings are flushed in parts of about this size
+	viper.SetDefault("RECORDING_MAX_BYTES", 4<<20)
+	if viper.GetString("ADMIN_PORT") != "" && viper.GetString("ADMIN_TOKEN") == "" {
+		logging.Fatal("ADMIN_TOKEN is required when ADMIN_PORT is set")
+	}
+	if viper.GetString("LUDOFY_MODE") == ModeLocal {
+		return newLocalConfig(port, serverHandler)
+	}
 	protectionTimeout, err := time.ParseDuration(viper.GetString("SERVER_PROTECTION_TIMEOUT"))
 	if err != nil {
 		logging.Fatal("fatal error config file", zap.Error(err))
 	}
+	// The default spool is lost with the task, deployments set SPOOL_DIR to
+	// a mounted volume like the EFS one of the compute stack
+	viper.SetDefault("SPOOL_DIR", filepath.Join(os.TempDir(), "ludofy-spool"))
 	cfg := Config{
 		Port:                 port,
 		ServerHandler:        serverHandler,
+		mode:                 viper.GetString("LUDOFY_MODE"),
 		cognitoUserPoolId:    viper.GetString("COGNITO_USER_POOL_ID"),
 		appSyncHttpUrl:       viper.GetString("APPSYNC_HTTP_URL"),
 		appSyncAccessRoleArn: viper.GetString("APPSYNC_ACCESS_ROLE_ARN"),
 		abortGameFunctionArn: viper.GetString("ABORT_GAME_FUNCTION_ARN"),
 		endGameFunctionArn:   viper.GetString("END_GAME_FUNCTION_ARN"),
 		maxMatches:           viper.GetInt32("MAX_MATCHES"),
+		softMaxMatches:       softMaxMatches(viper.GetInt32("MAX_MATCHES"), viper.GetInt32("SOFT_MAX_MATCHES")),
+		maxSpectators:        viper.GetInt("MAX_SPECTATORS"),
+		outboxSize:           viper.GetInt("PLAYER_OUTBOX_SIZE"),
+		shutdownGracePeriod:  viper.GetDuration("SHUTDOWN_GRACE_PERIOD"),
+		pingInterval:         viper.GetDuration("PING_INTERVAL"),
+		readTimeout:          viper.GetDuration("READ_TIMEOUT"),
+		rateLimit:            newRateLimitConfig(),
+		saveMaxRetries:       viper.GetInt("SAVE_MAX_RETRIES"),
+		saveRetryBackoff:     viper.GetDuration("SAVE_RETRY_BACKOFF"),
+		spoolDir:             viper.GetString("SPOOL_DIR"),
+		spoolOwner:           spoolOwner(),
+		spoolRetryBackoff:    viper.GetDuration("SPOOL_RETRY_BACKOFF"),
+		spoolMaxAge:          viper.GetDuration("SPOOL_MAX_AGE"),
+		recordingMaxBytes:    viper.GetInt("RECORDING_MAX_BYTES"),
+		adminPort:            viper.GetString("ADMIN_PORT"),
+		adminToken:           viper.GetString("ADMIN_TOKEN"),
+		allowedOrigins:       allowedOrigins(),
+		tls:                  newTlsConfig(),
 		protectionTimeout:    protectionTimeout,
 	}
 	cfg.awsCfg, err = config.LoadDefaultConfig(context.TODO())
@@ -68,6 +154,30 @@ func NewConfig(port string, serverHandler ServerHandler) Config {
 	if err != nil {
 		panic(err)
 	}
+	if secretId := viper.GetString("TLS_CERT_SECRET_ID"); secretId != "" {
+		if err := cfg.tls.loadSecretCertificate(cfg.awsCfg, secretId); err != nil {
+			panic(err)
+		}
+	}
+	if cfg.tls.clientCAs != nil && !cfg.tls.enabled() {
+		logging.Fatal("TLS_CLIENT_CA_FILE requires a TLS certificate")
+	}
+	if bucket := viper.GetString("RECORDING_BUCKET"); bucket != "" {
+		cfg.RecordingSink = NewS3RecordingSink(s3.NewFromConfig(cfg.awsCfg), bucket, "recordings/")
+	}
+	cfg.Address = viper.GetString("SERVER_ADDRESS")
+	if bucket := viper.GetString("SNAPSHOT_BUCKET"); bucket != "" {
+		cfg.SnapshotStore = NewS3SnapshotStore(s3.NewFromConfig(cfg.awsCfg), bucket, "snapshots/")
+		cfg.MigrationTargetPicker = newAwsMigrationTargetPicker(cfg, viper.GetString("SERVER_SERVICE_NAME"))
+		// Snapshots are only restored on the server they target, SERVER_ADDRESS
+		// must match the targets other servers pick for this one
+		if cfg.Address == "" {
+			cfg.Address = awsServerAddress(cfg)
+		}
+	}
+	if target := viper.GetString("MIGRATION_TARGET"); target != "" {
+		cfg.MigrationTargetPicker = StaticMigrationTarget(target)
+	}
 	return cfg
 }
 
@@ -89,3 +199,97 @@ func (c *Config) loadAwsConfig() error {
 	c.appsyncCfg = assumedCfg
 	return nil
 }
+
+// spoolOwner names the own directory of the server in the spool, SPOOL_OWNER
+// or else the hostname, which is unique per task and kept by a local server
+// across restarts
+func spoolOwner() string {
+	if owner := viper.GetString("SPOOL_OWNER"); owner != "" {
+		return owner
+	}
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		return utils.GenerateUUID()
+	}
+	return hostname
+}
+
+// newLocalConfig creates a config which runs fully offline with in-memory
+// matches, HS256 dev tokens and match events written to disk
+func newLocalConfig(port string, serverHandler ServerHandler) Config {
+	viper.SetDefault("SERVER_PROTECTION_TIMEOUT", "10m")
+	viper.SetDefault("MAX_SPECTATORS", 20)
+	viper.SetDefault("LOCAL_DATA_DIR", "data")
+	viper.SetDefault("SPOOL_DIR", filepath.Join(viper.GetString("LOCAL_DATA_DIR"), "spool"))
+	// Local servers are handed matches as MIGRATION_TARGET names them
+	viper.SetDefault("SERVER_ADDRESS", "localhost:"+port)
+	viper.SetDefault("LOCAL_API_ADDR", "127.0.0.1:7203")
+	protectionTimeout, err := time.ParseDuration(viper.GetString("SERVER_PROTECTION_TIMEOUT"))
+	if err != nil {
+		logging.Fatal("fatal error config file", zap.Error(err))
+	}
+	tokenSecret := viper.GetString("LOCAL_TOKEN_SECRET")
+	if tokenSecret == "" {
+		logging.Fatal("LOCAL_TOKEN_SECRET is required in local mode")
+	}
+	store := NewMemoryMatchStore()
+	cfg := Config{
+		Port:                 port,
+		ServerHandler:        serverHandler,
+		MatchStore:           store,
+		MatchSink:            newLocalMatchSink(viper.GetString("LOCAL_DATA_DIR"), store),
+		ProtectionController: noopProtectionController{},
+		mode:                 ModeLocal,
+		maxMatches:           viper.GetInt32("MAX_MATCHES"),
+		softMaxMatches:       softMaxMatches(viper.GetInt32("MAX_MATCHES"), viper.GetInt32("SOFT_MAX_MATCHES")),
+		maxSpectators:        viper.GetInt("MAX_SPECTATORS"),
+		outboxSize:           viper.GetInt("PLAYER_OUTBOX_SIZE"),
+		shutdownGracePeriod:  viper.GetDuration("SHUTDOWN_GRACE_PERIOD"),
+		pingInterval:         viper.GetDuration("PING_INTERVAL"),
+		readTimeout:          viper.GetDuration("READ_TIMEOUT"),
+		rateLimit:            newRateLimitConfig(),
+		saveMaxRetries:       viper.GetInt("SAVE_MAX_RETRIES"),
+		saveRetryBackoff:     viper.GetDuration("SAVE_RETRY_BACKOFF"),
+		spoolDir:             viper.GetString("SPOOL_DIR"),
+		spoolOwner:           spoolOwner(),
+		spoolRetryBackoff:    viper.GetDuration("SPOOL_RETRY_BACKOFF"),
+		spoolMaxAge:          viper.GetDuration("SPOOL_MAX_AGE"),
+		recordingMaxBytes:    viper.GetInt("RECORDING_MAX_BYTES"),
+		adminPort:            viper.GetString("ADMIN_PORT"),
+		adminToken:           viper.GetString("ADMIN_TOKEN"),
+		allowedOrigins:       allowedOrigins(),
+		tls:                  newTlsConfig(),
+		protectionTimeout:    protectionTimeout,
+		localDataDir:         viper.GetString("LOCAL_DATA_DIR"),
+		localTokenSecret:     []byte(tokenSecret),
+		localApiAddr:         viper.GetString("LOCAL_API_ADDR"),
+	}
+	if viper.GetBool("RECORD_MATCHES") {
+		cfg.RecordingSink = NewFileRecordingSink(cfg.localDataDir)
+	}
+	cfg.SnapshotStore = NewFileSnapshotStore(cfg.localDataDir)
+	cfg.Address = viper.GetString("SERVER_ADDRESS")
+	if target := viper.GetString("MIGRATION_TARGET"); target != "" {
+		cfg.MigrationTargetPicker = StaticMigrationTarget(target)
+	}
+	if cfg.tls.clientCAs != nil && !cfg.tls.enabled() {
+		logging.Fatal("TLS_CLIENT_CA_FILE requires a TLS certificate")
+	}
+	logging.Info("local mode enabled", zap.String("data_dir", cfg.localDataDir))
+	return cfg
+}
+
+func (c *Config) validateToken(token string) (*jwt.Token, error) {
+	if c.mode == ModeLocal {
+		return validateLocalToken(token, c.localTokenSecret)
+	}
+	return awsAuth.ValidateJwt(token, c.cognitoPublicKeys)
+}
+
+// clock method    returns the clock of the config, the wall clock when unset
+func (c Config) clock() utils.Clock {
+	if c.Clock == nil {
+		return utils.RealClock
+	}
+	return c.Clock
+}
@@ -0,0 +1,216 @@
+package server
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/yelaco/ludofy/internal/domains/dtos"
+	"github.com/yelaco/ludofy/internal/domains/entities"
+	"github.com/yelaco/ludofy/pkg/utils"
+)
+
+// MatchDriver runs a match of a server handler without websockets, for
+// replays and tests. Moves are handled synchronously and the match runs on a
+// fake clock, so its timers fire when the clock is advanced
+type MatchDriver struct {
+	Saves   []dtos.MatchStateRequest
+	End     *MatchRecordRequest
+	Aborted bool
+
+	// Hooks called after the match is saved, ended or aborted
+	OnSave  func(req dtos.MatchStateRequest)
+	OnEnd   func(req MatchRecordRequest)
+	OnAbort func()
+
+	match  Match
+	server *DefaultServer
+	clock  *utils.FakeClock
+}
+
+// NewMatchDriver creates the match with the server handler of the config,
+// resuming it from the match state if not nil. The config clock is replaced by
+// the fake clock, which the server handler should also use for its timers
+func NewMatchDriver(
+	cfg Config,
+	activeMatch entities.ActiveMatch,
+	matchState *entities.MatchState,
+	clock *utils.FakeClock,
+) (*MatchDriver, error) {
+	return newMatchDriver(cfg, activeMatch, matchState, nil, clock, false)
+}
+
+// RestoreMatchDriver restores the match from a snapshot taken by its
+// SnapshotHandler, with the RestoreHandler of the server handler
+func RestoreMatchDriver(
+	cfg Config,
+	activeMatch entities.ActiveMatch,
+	snapshot []byte,
+	clock *utils.FakeClock,
+) (*MatchDriver, error) {
+	return newMatchDriver(cfg, activeMatch, nil, &MatchSnapshot{
+		MatchId: activeMatch.MatchId,
+		Data:    snapshot,
+	}, clock, false)
+}
+
+// newMatchDriver creates the driver, the timers of a replaying match are
+// ignored in favour of the recorded ones
+func newMatchDriver(
+	cfg Config,
+	activeMatch entities.ActiveMatch,
+	matchState *entities.MatchState,
+	snapshot *MatchSnapshot,
+	clock *utils.FakeClock,
+	replaying bool,
+) (*MatchDriver, error) {
+	cfg.Clock = clock
+	d := &MatchDriver{
+		server: &DefaultServer{
+			cfg:     cfg,
+			handler: cfg.ServerHandler,
+		},
+		clock: clock,
+	}
+
+	var err error
+	if snapshot != nil {
+		d.match, err = d.server.restoreMatch(activeMatch, *snapshot)
+	} else if matchState != nil {
+		d.match, err = d.server.handler.OnMatchResume(activeMatch, *matchState)
+	} else {
+		d.match, err = d.server.handler.OnMatchCreate(activeMatch)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load match: %w", err)
+	}
+	if err := d.match.drive(clock, replaying); err != nil {
+		return nil, err
+	}
+	if snapshot != nil {
+		d.match.restorePause(snapshot.Pause)
+	} else if matchState != nil {
+		d.match.restorePause(matchState.Pause)
+	}
+	assignTeams(d.match, activeMatch)
+
+	d.match.setStartCallback(func(Match) {})
+	d.match.setSaveCallback(func(match Match) {
+		req := dtos.MatchStateRequest{
+			MatchId:   match.GetId(),
+			Pause:     match.getPauseState(),
+			Timestamp: match.Now(),
+		}
+		d.server.handler.OnHandleMatchSave(&req, match.GetHandler())
+		if !projectSave(match, &req) {
+			return
+		}
+		d.Saves = append(d.Saves, req)
+		if d.OnSave != nil {
+			d.OnSave(req)
+		}
+	})
+	d.match.setEndCallback(func(match Match) {
+		req := MatchRecordRequest{
+			MatchId: match.GetId(),
+			EndedAt: match.Now(),
+			Chat:    match.getChatLog(),
+			Bots:    matchBots(match),
+			Teams:   matchTeamRecords(match),
+		}
+		d.server.handler.OnHandleMatchEnd(&req, match.GetHandler())
+		d.End = &req
+		if d.OnEnd != nil {
+			d.OnEnd(req)
+		}
+	})
+	d.match.setAbortCallback(func(Match) {
+		d.Aborted = true
+		if d.OnAbort != nil {
+			d.OnAbort()
+		}
+	})
+	// Bots join with Join like the other players, as recorded on the server
+	for _, player := range d.match.GetPlayers() {
+		player.attach(d.match)
+	}
+	return d, nil
+}
+
+// Snapshot method    snapshots the match with its SnapshotHandler, the
+// match keeps running
+func (d *MatchDriver) Snapshot() ([]byte, error) {
+	handler, ok := d.match.GetHandler().(SnapshotHandler)
+	if !ok {
+		return nil, ErrSnapshotNotSupported
+	}
+	return handler.OnMatchSnapshot()
+}
+
+// Match method    returns the driven match
+func (d *MatchDriver) Match() Match {
+	return d.match
+}
+
+// Clock method    returns the fake clock of the match
+func (d *MatchDriver) Clock() *utils.FakeClock {
+	return d.clock
+}
+
+// Now method    returns the time of the fake clock
+func (d *MatchDriver) Now() time.Time {
+	return d.clock.Now()
+}
+
+// SetTime method    moves the fake clock, firing the timers due
+func (d *MatchDriver) SetTime(now time.Time) {
+	d.clock.Set(now)
+}
+
+// Advance method    moves the fake clock forward, firing the timers due
+func (d *MatchDriver) Advance(duration time.Duration) {
+	d.clock.Advance(duration)
+}
+
+// Join method    connects the player, the messages written to it are passed
+// to output when not nil
+func (d *MatchDriver) Join(playerId string, output func(data []byte)) error {
+	player, exist := d.match.GetPlayerWithId(playerId)
+	if !exist {
+		return fmt.Errorf("%w: %s", ErrPlayerNotFound, playerId)
+	}
+	player.setOutput(output)
+	d.match.playerJoin(playerId, nil, nil)
+	return nil
+}
+
+// Leave method    disconnects the player
+func (d *MatchDriver) Leave(playerId string) error {
+	if _, exist := d.match.GetPlayerWithId(playerId); !exist {
+		return fmt.Errorf("%w: %s", ErrPlayerNotFound, playerId)
+	}
+	d.match.playerDisconnect(playerId)
+	return nil
+}
+
+// Send method    handles the message of the player like the websocket handler does
+func (d *MatchDriver) Send(playerId string, msg []byte) error {
+	if _, exist := d.match.GetPlayerWithId(playerId); !exist {
+		return fmt.Errorf("%w: %s", ErrPlayerNotFound, playerId)
+	}
+	return d.server.HandleMessage(playerId, d.match, msg)
+}
+
+// ReportRtt method    reports a round trip time sample of the player, like the
+// pongs of its connection do
+func (d *MatchDriver) ReportRtt(playerId string, sample time.Duration) error {
+	if _, exist := d.match.GetPlayerWithId(playerId); !exist {
+		return fmt.Errorf("%w: %s", ErrPlayerNotFound, playerId)
+	}
+	d.match.playerRtt(playerId, sample)
+	return nil
+}
+
+// FireTimer method    fires the timer of the match, even when replaying
+func (d *MatchDriver) FireTimer(name string) {
+	d.match.fireTimer(name)
+}
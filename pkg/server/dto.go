@@ -12,6 +12,9 @@ type MatchRecordRequest struct {
 	StartedAt time.Time      `json:"startedAt"`
 	EndedAt   time.Time      `json:"endedAt"`
 	Result    interface{}    `json:"results"`
+	Chat      []ChatLine     `json:"chat,omitempty"`
+	Bots      []string       `json:"bots,omitempty"`
+	Teams     []TeamRecord   `json:"teams,omitempty"`
 }
 
 func MatchRecordRequestToEntity(req MatchRecordRequest) entities.MatchRecord {
@@ -21,10 +24,25 @@ func MatchRecordRequestToEntity(req MatchRecordRequest) entities.MatchRecord {
 		StartedAt: req.StartedAt,
 		EndedAt:   req.EndedAt,
 		Result:    req.Result,
+		Bots:      req.Bots,
 	}
 	for _, player := range req.Players {
 		matchRecord.Players = append(matchRecord.Players, player)
 	}
+	for _, team := range req.Teams {
+		matchRecord.Teams = append(matchRecord.Teams, entities.TeamRecord{
+			Team:      team.Team,
+			PlayerIds: team.PlayerIds,
+			Placement: team.Placement,
+		})
+	}
+	for _, line := range req.Chat {
+		matchRecord.Chat = append(matchRecord.Chat, entities.ChatLine{
+			PlayerId:  line.PlayerId,
+			Text:      line.Text,
+			CreatedAt: line.CreatedAt,
+		})
+	}
 	return matchRecord
 }
 
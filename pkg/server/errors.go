@@ -7,9 +7,36 @@ var (
 	ErrStatusInvalidPlayerId string = "INVALID_PLAYER_ID"
 	ErrStatusWrongTurn       string = "WRONG_TURN"
 	ErrStatusAbortInvalidPly string = "INVALID_PLY"
+
+	ErrStatusUnknownMessageType string = "UNKNOWN_MESSAGE_TYPE"
+	ErrStatusMalformedPayload   string = "MALFORMED_PAYLOAD"
+	ErrStatusInvalidPayload     string = "INVALID_PAYLOAD"
+	ErrStatusRateLimited        string = "RATE_LIMITED"
+	ErrStatusChatRejected       string = "CHAT_REJECTED"
+	ErrStatusMatchPaused        string = "MATCH_PAUSED"
+	ErrStatusPauseBudgetSpent   string = "PAUSE_BUDGET_SPENT"
+	ErrStatusNoPauseRequest     string = "NO_PAUSE_REQUEST"
 )
 
 var (
-	ErrFailedToLoadMatch = errors.New("failed to load match")
-	ErrInvalidOutcome    = errors.New("invalid outcome")
+	ErrFailedToLoadMatch    = errors.New("failed to load match")
+	ErrInvalidOutcome       = errors.New("invalid outcome")
+	ErrMatchNotFound        = errors.New("match not found")
+	ErrSpectatorsFull       = errors.New("spectator limit reached")
+	ErrSpectatorTooSlow     = errors.New("spectator too slow, disconnected")
+	ErrServerFull           = errors.New("server full")
+	ErrInvalidRecording     = errors.New("invalid recording")
+	ErrReplayDiverged       = errors.New("replay diverged from recording")
+	ErrPlayerNotFound       = errors.New("player not found")
+	ErrTickModeDriven       = errors.New("matches in tick mode can't be driven")
+	ErrMatchEnded           = errors.New("match ended")
+	ErrMigrationDisabled    = errors.New("match migration disabled")
+	ErrSnapshotNotSupported = errors.New("match handler doesn't support snapshots")
+	ErrMatchMigrated        = errors.New("match migrated to another server")
+	ErrSnapshotUnavailable  = errors.New("match snapshot unavailable")
+	ErrSeqFieldReserved     = errors.New("_seq field is reserved for sequenced messages")
+
+	ErrUnknownMessageType = errors.New("unknown message type")
+	errMalformedPayload   = errors.New("malformed payload")
+	errInvalidPayload     = errors.New("invalid payload")
 )
@@ -1,6 +1,8 @@
 package server
 
 import (
+	"time"
+
 	"github.com/yelaco/ludofy/internal/domains/dtos"
 	"github.com/yelaco/ludofy/internal/domains/entities"
 )
@@ -16,6 +18,71 @@ type MatchHandler interface {
 	OnMatchAbort() error
 }
 
+// SpectatorHandler can be implemented by a MatchHandler to control what
+// spectators see. Without it spectators receive every broadcast as is.
+type SpectatorHandler interface {
+	// OnSpectatorJoin syncs the current match state to a new spectator
+	OnSpectatorJoin(spectator Spectator) error
+	// OnSpectatorBroadcast returns the message spectators may see, or false to withhold it
+	OnSpectatorBroadcast(msg interface{}) (interface{}, bool)
+}
+
+// TickHandler can be implemented by a MatchHandler of real-time games. When
+// the match has a tick rate, moves are buffered and applied on every tick
+// instead of being passed to HandleMove
+type TickHandler interface {
+	// OnTick advances the simulation by the fixed timestep dt with the moves received since the last tick
+	OnTick(dt time.Duration, moves []Move) error
+	// TickState returns the state broadcast after each tick, only the top
+	// level keys which changed are sent
+	TickState() map[string]interface{}
+}
+
+// TimerHandler can be implemented by a MatchHandler to receive the timers
+// fired with Match.FireTimer, which are recorded and replayed
+type TimerHandler interface {
+	OnTimer(name string) error
+}
+
+// ChatHandler can be implemented by a MatchHandler to moderate the built-in
+// chat, e.g. to filter profanity or mute players
+type ChatHandler interface {
+	// OnChat returns the text to relay, possibly rewritten, or false to drop
+	// the message. It runs on the match goroutine, like HandleMove
+	OnChat(player Player, text string) (string, bool)
+}
+
+// PauseHandler can be implemented by a MatchHandler to stop and restart the
+// game clocks when the match is paused with its PausePolicy
+type PauseHandler interface {
+	// OnPause stops the clocks, it also runs when a match restored while
+	// paused is loaded
+	OnPause() error
+	// OnResume restarts the clocks after the match was paused for pausedFor
+	OnResume(pausedFor time.Duration) error
+}
+
+// SnapshotHandler can be implemented by a MatchHandler so the match can be
+// handed over to another server with every move, not only the saved ones
+type SnapshotHandler interface {
+	// OnMatchSnapshot serializes the full state of the match, it runs on the
+	// match goroutine while no move is handled
+	OnMatchSnapshot() ([]byte, error)
+}
+
+// DumpHandler can be implemented by a MatchHandler to expose the current state
+// of the match on the admin API. Without it the snapshot of the match is shown
+type DumpHandler interface {
+	// OnMatchDump returns the state to show, it runs on the match goroutine
+	OnMatchDump() (interface{}, error)
+}
+
+// RestoreHandler can be implemented by a ServerHandler to restore the matches
+// handed over by another server. Without it they resume from the latest save
+type RestoreHandler interface {
+	OnMatchRestore(activeMatch entities.ActiveMatch, snapshot []byte) (Match, error)
+}
+
 type ServerHandler interface {
 	OnMatchCreate(activeMatch entities.ActiveMatch) (Match, error)
 	OnMatchResume(activeMatch entities.ActiveMatch, currentState entities.MatchState) (Match, error)
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const writeWait = 5 * time.Second
+
+// keepAlive method    sets the read deadline of the connection and pings it
+// periodically. Pongs extend the deadline and report the round trip time to onRtt.
+// The returned function stops the pings
+func (s *DefaultServer) keepAlive(conn *websocket.Conn, onRtt func(time.Duration)) func() {
+	if s.cfg.pingInterval <= 0 || s.cfg.readTimeout <= 0 {
+		return func() {}
+	}
+	conn.SetReadDeadline(time.Now().Add(s.cfg.readTimeout))
+	conn.SetPongHandler(func(appData string) error {
+		conn.SetReadDeadline(time.Now().Add(s.cfg.readTimeout))
+		sentAt, err := strconv.ParseInt(appData, 10, 64)
+		if err == nil && onRtt != nil {
+			onRtt(time.Since(time.Unix(0, sentAt)))
+		}
+		return nil
+	})
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(s.cfg.pingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				// Ping payload carries the send time to measure round trip time
+				payload := strconv.FormatInt(time.Now().UnixNano(), 10)
+				err := conn.WriteControl(
+					websocket.PingMessage,
+					[]byte(payload),
+					time.Now().Add(writeWait),
+				)
+				if err != nil {
+					return
+				}
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// extendReadDeadline method    keeps the connection alive after any inbound message
+func (s *DefaultServer) extendReadDeadline(conn *websocket.Conn) {
+	if s.cfg.pingInterval <= 0 || s.cfg.readTimeout <= 0 {
+		return
+	}
+	conn.SetReadDeadline(time.Now().Add(s.cfg.readTimeout))
+}
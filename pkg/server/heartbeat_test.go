@@ -0,0 +1,47 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+// blockingHandler holds every move until release is closed
+type blockingHandler struct {
+	tickHandler
+	handling chan struct{}
+	release  chan struct{}
+}
+
+func (h *blockingHandler) HandleMove(player Player, move Move) error {
+	close(h.handling)
+	<-h.release
+	return nil
+}
+
+func TestPlayerRttDoesNotWait(t *testing.T) {
+	player := NewDefaultPlayer("a", "m1")
+	match := NewDefaultMatch("m1", map[string]Player{"a": player}).(*DefaultMatch)
+	handler := &blockingHandler{handling: make(chan struct{}), release: make(chan struct{})}
+	handler.match = match
+	match.SetHandler(handler)
+	go match.start()
+	defer match.markEnded()
+
+	go match.ProcessMove(testMove{playerId: "a"})
+	<-handler.handling
+
+	reported := make(chan struct{})
+	go func() {
+		match.playerRtt("a", 40*time.Millisecond)
+		close(reported)
+	}()
+	select {
+	case <-reported:
+	case <-time.After(time.Second):
+		t.Fatal("round trip time sample waited for the match goroutine")
+	}
+
+	close(handler.release)
+	eventually(t, func() bool { return player.(*DefaultPlayer).GetRtt() == 40*time.Millisecond },
+		"round trip time not updated once the match goroutine was free")
+}
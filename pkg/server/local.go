@@ -0,0 +1,233 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/yelaco/ludofy/internal/aws/storage"
+	"github.com/yelaco/ludofy/internal/domains/dtos"
+	"github.com/yelaco/ludofy/internal/domains/entities"
+	"github.com/yelaco/ludofy/pkg/logging"
+	"github.com/yelaco/ludofy/pkg/utils"
+	"go.uber.org/zap"
+)
+
+const ModeLocal = "local"
+
+// MemoryMatchStore is an in-memory MatchStore used in local mode.
+type MemoryMatchStore struct {
+	activeMatches map[string]entities.ActiveMatch
+	matchStates   map[string][]entities.MatchState
+	mu            *sync.Mutex
+}
+
+func NewMemoryMatchStore() *MemoryMatchStore {
+	return &MemoryMatchStore{
+		activeMatches: make(map[string]entities.ActiveMatch),
+		matchStates:   make(map[string][]entities.MatchState),
+		mu:            new(sync.Mutex),
+	}
+}
+
+func (s *MemoryMatchStore) PutActiveMatch(activeMatch entities.ActiveMatch) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.activeMatches[activeMatch.MatchId] = activeMatch
+}
+
+func (s *MemoryMatchStore) DeleteActiveMatch(matchId string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.activeMatches, matchId)
+	delete(s.matchStates, matchId)
+}
+
+func (s *MemoryMatchStore) PutMatchState(matchState entities.MatchState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.matchStates[matchState.MatchId] = append(s.matchStates[matchState.MatchId], matchState)
+}
+
+func (s *MemoryMatchStore) GetActiveMatch(
+	ctx context.Context,
+	matchId string,
+) (entities.ActiveMatch, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	activeMatch, exist := s.activeMatches[matchId]
+	if !exist {
+		return entities.ActiveMatch{}, storage.ErrActiveMatchNotFound
+	}
+	return activeMatch, nil
+}
+
+func (s *MemoryMatchStore) GetLatestMatchState(
+	ctx context.Context,
+	matchId string,
+) (*entities.MatchState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	matchStates := s.matchStates[matchId]
+	if len(matchStates) == 0 {
+		return nil, nil
+	}
+	matchState := matchStates[len(matchStates)-1]
+	return &matchState, nil
+}
+
+func (s *MemoryMatchStore) UpdateActiveMatch(
+	ctx context.Context,
+	matchId string,
+	update ActiveMatchUpdate,
+) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	activeMatch, exist := s.activeMatches[matchId]
+	if !exist {
+		return storage.ErrActiveMatchNotFound
+	}
+	if update.Server != nil {
+		activeMatch.Server = *update.Server
+	}
+	if update.StartedAt != nil {
+		activeMatch.StartedAt = update.StartedAt
+	}
+	s.activeMatches[matchId] = activeMatch
+	return nil
+}
+
+// localMatchSink writes match lifecycle payloads to disk instead of
+// calling AppSync and Lambda.
+type localMatchSink struct {
+	dataDir string
+	store   *MemoryMatchStore
+}
+
+func newLocalMatchSink(dataDir string, store *MemoryMatchStore) MatchSink {
+	return &localMatchSink{
+		dataDir: dataDir,
+		store:   store,
+	}
+}
+
+func (s *localMatchSink) PublishMatchSave(
+	ctx context.Context,
+	matchState dtos.MatchStateRequest,
+) error {
+	s.store.PutMatchState(dtos.MatchStateRequestToEntity(matchState))
+	return s.write(matchState.MatchId, "save", matchState)
+}
+
+func (s *localMatchSink) PublishMatchEnd(
+	ctx context.Context,
+	record MatchRecordRequest,
+) error {
+	s.store.DeleteActiveMatch(record.MatchId)
+	return s.write(record.MatchId, "end", record)
+}
+
+func (s *localMatchSink) PublishMatchAbort(
+	ctx context.Context,
+	req dtos.MatchAbortRequest,
+) error {
+	s.store.DeleteActiveMatch(req.MatchId)
+	return s.write(req.MatchId, "abort", req)
+}
+
+func (s *localMatchSink) write(matchId, event string, v any) error {
+	payload, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s payload: %w", event, err)
+	}
+	dir := filepath.Join(s.dataDir, matchId)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create data dir: %w", err)
+	}
+	name := fmt.Sprintf("%s-%d.json", event, time.Now().UnixNano())
+	if err := os.WriteFile(filepath.Join(dir, name), payload, 0o644); err != nil {
+		return fmt.Errorf("failed to write %s payload: %w", event, err)
+	}
+	logging.Info("match event written",
+		zap.String("match_id", matchId),
+		zap.String("event", event),
+		zap.String("file", name),
+	)
+	return nil
+}
+
+type noopProtectionController struct{}
+
+func (noopProtectionController) UpdateServerProtection(ctx context.Context, enabled bool) error {
+	return nil
+}
+
+// validateLocalToken validates HS256 dev tokens signed with the local secret
+func validateLocalToken(tokenString string, secret []byte) (*jwt.Token, error) {
+	return jwt.Parse(
+		tokenString,
+		func(token *jwt.Token) (interface{}, error) {
+			return secret, nil
+		},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+	)
+}
+
+// SignLocalToken signs a dev token for the given player which is accepted in local mode.
+func SignLocalToken(playerId string, secret []byte, ttl time.Duration) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": playerId,
+		"exp": time.Now().Add(ttl).Unix(),
+	})
+	return token.SignedString(secret)
+}
+
+// newLocalServer method    creates the listener of the local mode endpoints
+// used to create matches and dev tokens without matchmaking and Cognito. They
+// aren't authenticated, so they are kept off the game port and bound to the
+// loopback interface unless LOCAL_API_ADDR says otherwise
+func (s *DefaultServer) newLocalServer() *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /local/matches", func(w http.ResponseWriter, r *http.Request) {
+		store, ok := s.store.(*MemoryMatchStore)
+		if !ok {
+			w.WriteHeader(http.StatusNotImplemented)
+			return
+		}
+		var activeMatch entities.ActiveMatch
+		if err := json.NewDecoder(r.Body).Decode(&activeMatch); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		if activeMatch.MatchId == "" {
+			activeMatch.MatchId = utils.GenerateUUID()
+		}
+		activeMatch.CreatedAt = time.Now()
+		store.PutActiveMatch(activeMatch)
+		logging.Info("local match created", zap.String("match_id", activeMatch.MatchId))
+		json.NewEncoder(w).Encode(activeMatch)
+	})
+
+	mux.HandleFunc("POST /local/tokens/{playerId}", func(w http.ResponseWriter, r *http.Request) {
+		token, err := SignLocalToken(r.PathValue("playerId"), s.cfg.localTokenSecret, 24*time.Hour)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{
+			"token": token,
+		})
+	})
+	return &http.Server{
+		Addr:    s.cfg.localApiAddr,
+		Handler: mux,
+	}
+}
@@ -1,15 +1,13 @@
 package server
 
 import (
-	"context"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/yelaco/ludofy/internal/aws/storage"
+	"github.com/gorilla/websocket"
 	"github.com/yelaco/ludofy/pkg/logging"
 	"github.com/yelaco/ludofy/pkg/utils"
-	"github.com/gorilla/websocket"
 	"go.uber.org/zap"
 )
 
@@ -26,64 +24,254 @@ type errorResponse struct {
 
 func NewDefaultMatch(id string, players map[string]Player) Match {
 	return &DefaultMatch{
-		Id:      id,
-		Players: players,
-		moveCh:  make(chan Move),
-		mu:      new(sync.Mutex),
+		Id:          id,
+		Players:     players,
+		moveCh:      make(chan Move),
+		saveCh:      make(chan struct{}, 1),
+		execCh:      make(chan func()),
+		endCh:       make(chan struct{}),
+		done:        make(chan struct{}),
+		mu:          new(sync.Mutex),
+		spectators:  make(map[Spectator]struct{}),
+		spectatorMu: new(sync.Mutex),
+		chatMutes:   make(map[string]map[string]struct{}),
+		chatMu:      new(sync.Mutex),
+		pauseMu:     new(sync.Mutex),
 	}
 }
 
 func (m *DefaultMatch) start() {
-	for move := range m.moveCh {
-		player, exist := m.Players[move.GetPlayerId()]
-		if !exist {
-			player.WriteJson(errorResponse{
-				Type:  "error",
-				Error: ErrStatusInvalidPlayerId,
-			})
-			continue
+	defer close(m.done)
+	m.startAutosave()
+	if handler, ok := m.handler.(TickHandler); ok && m.tickRate > 0 {
+		m.runTicks(handler)
+		return
+	}
+	for {
+		select {
+		case move := <-m.moveCh:
+			m.handleMove(move)
+			if m.IsEnded() {
+				return
+			}
+		case <-m.endCh:
+			return
+		case <-m.saveCh:
+			m.Save()
+		case fn := <-m.execCh:
+			fn()
+			if m.IsEnded() {
+				return
+			}
 		}
-		m.handler.HandleMove(player, move)
 	}
 }
 
-func (m *DefaultMatch) Abort() {
+// exec method    runs fn on the match goroutine between moves and waits for
+// it, returns false if the match goroutine has stopped. Driven matches run it
+// right away
+func (m *DefaultMatch) exec(fn func()) bool {
+	if m.driven.Load() {
+		fn()
+		return true
+	}
+	finished := make(chan struct{})
+	select {
+	case m.execCh <- func() {
+		defer close(finished)
+		fn()
+	}:
+		<-finished
+		return true
+	case <-m.done:
+		return false
+	}
+}
+
+// post method    runs fn on the match goroutine without waiting for it, fn is
+// dropped if the match goroutine stops first. Driven matches run it right away
+func (m *DefaultMatch) post(fn func()) {
+	if m.driven.Load() {
+		fn()
+		return
+	}
+	go m.exec(fn)
+}
+
+func (m *DefaultMatch) handleMove(move Move) {
+	m.recordMessage(move.GetPlayerId())
+	player, exist := m.Players[move.GetPlayerId()]
+	if !exist {
+		logging.Info("move from invalid player dropped",
+			zap.String("match_id", m.GetId()),
+			zap.String("player_id", move.GetPlayerId()),
+		)
+		return
+	}
+	if m.IsPaused() {
+		m.rejectPausedMove(move)
+		return
+	}
+	started := time.Now()
+	m.handler.HandleMove(player, move)
+	handleMoveDuration.Observe(time.Since(started).Seconds())
+	m.countMoves(1)
+}
+
+// markEnded method    marks the match as ended and stops its goroutine,
+// returns false if it already ended. The lock is released before the hooks
+// and callbacks run, so they can still call IsEnded and Save
+func (m *DefaultMatch) markEnded() bool {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	if m.ended {
-		return
+		return false
 	}
 	m.ended = true
-	if !utils.IsClosed(m.moveCh) {
-		close(m.moveCh)
+	close(m.endCh)
+	return true
+}
+
+func (m *DefaultMatch) Abort() {
+	if !m.markEnded() {
+		return
 	}
+	m.stopAutosave()
+	m.record(RecordAbort, "", "", nil)
 	m.DisconnectPlayers("match aborted", time.Now().Add(5*time.Second))
+	m.disconnectSpectators("match aborted", time.Now().Add(5*time.Second))
 	m.handler.OnMatchAbort()
+	m.save()
 	m.abortCallback(m)
 }
 
+// Save method    saves the state of the match on demand, the state is
+// published in the background. Ended matches are not saved anymore, End and
+// Abort save the final state after the OnMatchEnd and OnMatchAbort hooks
 func (m *DefaultMatch) Save() {
+	if m.IsEnded() {
+		return
+	}
+	m.save()
+}
+
+func (m *DefaultMatch) save() {
+	m.movesSinceSave.Store(0)
 	m.handler.OnMatchSave()
 	m.saveCallback(m)
 }
 
 func (m *DefaultMatch) End() {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	if m.ended {
+	if !m.markEnded() {
 		return
 	}
-	m.ended = true
-	if !utils.IsClosed(m.moveCh) {
-		close(m.moveCh)
-	}
+	m.stopAutosave()
+	m.record(RecordEnd, "", "", nil)
 	m.handler.OnMatchEnd()
+	m.save()
 	m.DisconnectPlayers("match ended", time.Now().Add(5*time.Second))
+	m.disconnectSpectators("match ended", time.Now().Add(5*time.Second))
 	m.endCallback(m)
 }
 
+// ProcessMove method    passes the move to the match goroutine, driven
+// matches handle it synchronously. Moves are dropped once the match stopped
 func (m *DefaultMatch) ProcessMove(move Move) {
-	m.moveCh <- move
+	if m.IsEnded() {
+		m.dropMove(move)
+		return
+	}
+	if m.driven.Load() {
+		m.handleMove(move)
+		return
+	}
+	select {
+	case m.moveCh <- move:
+	case <-m.endCh:
+		m.dropMove(move)
+	case <-m.done:
+		m.dropMove(move)
+	}
+}
+
+func (m *DefaultMatch) dropMove(move Move) {
+	logging.Info("move to stopped match dropped",
+		zap.String("match_id", m.GetId()),
+		zap.String("player_id", move.GetPlayerId()),
+	)
+}
+
+// Now method    returns the current time on the clock of the match
+func (m *DefaultMatch) Now() time.Time {
+	return m.Clock().Now()
+}
+
+// Clock method    returns the clock of the match, the clock of the server
+// config once loaded, for the timers of the game
+func (m *DefaultMatch) Clock() utils.Clock {
+	if m.clock == nil {
+		return utils.RealClock
+	}
+	return m.clock
+}
+
+func (m *DefaultMatch) setClock(clock utils.Clock) {
+	m.clock = clock
+}
+
+func (m *DefaultMatch) setLoadedAt(loadedAt time.Time) {
+	m.loadedAt = loadedAt
+}
+
+func (m *DefaultMatch) getLoadedAt() time.Time {
+	return m.loadedAt
+}
+
+// FireTimer method    records the timer and passes it to the OnTimer hook of
+// the handler on the match goroutine, so it is meant for timer callbacks and
+// must not be called from the hooks of the handler. Timers of replayed
+// matches are ignored, the replay fires the recorded ones instead
+func (m *DefaultMatch) FireTimer(name string) {
+	if m.replaying.Load() {
+		return
+	}
+	m.exec(func() {
+		if m.IsEnded() {
+			return
+		}
+		m.fireTimer(name)
+	})
+}
+
+func (m *DefaultMatch) fireTimer(name string) {
+	m.record(RecordTimer, "", name, nil)
+	if name == pauseTimer {
+		m.expirePause()
+		return
+	}
+	handler, ok := m.handler.(TimerHandler)
+	if !ok {
+		logging.Info("timer fired without timer handler",
+			zap.String("match_id", m.GetId()),
+			zap.String("timer", name),
+		)
+		return
+	}
+	if err := handler.OnTimer(name); err != nil {
+		logging.Error("on timer", zap.String("timer", name), zap.Error(err))
+	}
+}
+
+// drive method    runs the match synchronously on the clock of a MatchDriver
+func (m *DefaultMatch) drive(clock utils.Clock, replaying bool) error {
+	if _, ok := m.handler.(TickHandler); ok && m.tickRate > 0 {
+		return ErrTickModeDriven
+	}
+	m.clock = clock
+	m.driven.Store(true)
+	m.replaying.Store(replaying)
+	m.startAutosave()
+	return nil
 }
 
 func (m *DefaultMatch) GetPlayerWithId(id string) (Player, bool) {
@@ -97,7 +285,18 @@ func (m *DefaultMatch) IsEnded() bool {
 	return m.ended
 }
 
-func (m *DefaultMatch) playerJoin(playerId string, conn *websocket.Conn) {
+// enableSequencing method    stamps the messages of the players with the
+// sequence number of the match, so players can tell which messages they missed
+func (m *DefaultMatch) enableSequencing(outboxSize int) {
+	sequence := new(atomic.Uint64)
+	for _, player := range m.Players {
+		player.setSequence(sequence, outboxSize)
+	}
+}
+
+// playerJoin method    connects the player. If lastSeq is set and the missed
+// messages are still in the outbox, they are replayed instead of a full sync
+func (m *DefaultMatch) playerJoin(playerId string, conn *websocket.Conn, lastSeq *uint64) {
 	if m == nil {
 		return
 	}
@@ -108,25 +307,29 @@ func (m *DefaultMatch) playerJoin(playerId string, conn *websocket.Conn) {
 		return
 	}
 
+	m.record(RecordJoin, playerId, "", nil)
 	init, err := m.handler.OnPlayerJoin(player)
 	if err != nil {
 		logging.Error("on player join", zap.Error(err))
 	}
 	if init {
-		err := storageClient.UpdateActiveMatch(
-			context.Background(),
-			m.GetId(),
-			storage.ActiveMatchUpdateOptions{
-				StartedAt: aws.Time(time.Now()),
-			},
+		m.startCallback(m)
+	}
+
+	if lastSeq != nil && player.resume(conn, *lastSeq) {
+		logging.Info("player resumed",
+			zap.String("player_id", playerId),
+			zap.Uint64("last_seq", *lastSeq),
 		)
-		if err != nil {
-			logging.Error("failed to update match", zap.Error(err))
+	} else {
+		player.setConn(conn)
+		if m.driven.Load() {
+			player.setStatus(CONNECTED)
 		}
+		m.handler.OnPlayerSync(player)
 	}
 
-	player.setConn(conn)
-	m.handler.OnPlayerSync(player)
+	m.keyframe.Store(true)
 
 	m.notifyAboutPlayerStatus(playerStatusResponse{
 		Type:     "playerStatus",
@@ -145,9 +348,13 @@ func (m *DefaultMatch) playerDisconnect(playerId string) {
 		logging.Fatal("invalid player id", zap.String("player_id", playerId))
 		return
 	}
+	m.record(RecordLeave, playerId, "", nil)
 	player.setConn(nil)
 
 	m.handler.OnPlayerLeave(player)
+	if m.savePolicy.OnDisconnect {
+		m.requestSave()
+	}
 
 	m.notifyAboutPlayerStatus(playerStatusResponse{
 		Type:     "playerStatus",
@@ -169,6 +376,92 @@ func (m *DefaultMatch) notifyAboutPlayerStatus(resp playerStatusResponse) {
 			)
 		}
 	}
+	m.broadcastToSpectators(resp)
+}
+
+// Broadcast method    sends the message to every player and spectator
+func (m *DefaultMatch) Broadcast(msg interface{}) {
+	for _, player := range m.Players {
+		err := player.WriteJson(msg)
+		if err != nil {
+			logging.Error(
+				"couldn't broadcast to player",
+				zap.String("player_id", player.GetId()),
+				zap.Error(err),
+			)
+		}
+	}
+	m.broadcastToSpectators(msg)
+}
+
+// broadcastToSpectators method    projects the message once for every
+// spectator, they all share the same view
+func (m *DefaultMatch) broadcastToSpectators(msg interface{}) {
+	msg, visible := m.project(Viewer{Kind: ViewerSpectator}, msg)
+	if !visible {
+		return
+	}
+	m.writeSpectators(msg)
+}
+
+// writeSpectators method    writes a message already projected for the
+// spectators to all of them
+func (m *DefaultMatch) writeSpectators(msg interface{}) {
+	m.spectatorMu.Lock()
+	defer m.spectatorMu.Unlock()
+	for spectator := range m.spectators {
+		err := spectator.WriteJson(msg)
+		if err != nil {
+			logging.Error(
+				"couldn't broadcast to spectator",
+				zap.String("spectator_id", spectator.GetId()),
+				zap.Error(err),
+			)
+		}
+	}
+}
+
+func (m *DefaultMatch) spectatorJoin(spectator Spectator, maxSpectators int) error {
+	m.spectatorMu.Lock()
+	if maxSpectators > 0 && len(m.spectators) >= maxSpectators {
+		m.spectatorMu.Unlock()
+		return ErrSpectatorsFull
+	}
+	m.spectators[spectator] = struct{}{}
+	m.spectatorMu.Unlock()
+	m.keyframe.Store(true)
+
+	if handler, ok := m.handler.(SpectatorHandler); ok {
+		if err := handler.OnSpectatorJoin(spectatorView{spectator, m}); err != nil {
+			logging.Error("on spectator join", zap.Error(err))
+		}
+	}
+	logging.Info("spectator joined",
+		zap.String("match_id", m.GetId()),
+		zap.String("spectator_id", spectator.GetId()),
+	)
+	return nil
+}
+
+func (m *DefaultMatch) spectatorLeave(spectator Spectator) {
+	m.spectatorMu.Lock()
+	defer m.spectatorMu.Unlock()
+	delete(m.spectators, spectator)
+}
+
+func (m *DefaultMatch) disconnectSpectators(msg string, deadline time.Time) {
+	m.spectatorMu.Lock()
+	defer m.spectatorMu.Unlock()
+	for spectator := range m.spectators {
+		spectator.WriteControl(
+			websocket.CloseMessage,
+			websocket.FormatCloseMessage(
+				websocket.CloseNormalClosure,
+				msg,
+			),
+			deadline,
+		)
+	}
 }
 
 func (m *DefaultMatch) DisconnectPlayers(msg string, deadline time.Time) {
@@ -192,6 +485,10 @@ func (m *DefaultMatch) SetHandler(handler MatchHandler) {
 	m.handler = handler
 }
 
+func (m *DefaultMatch) setStartCallback(callback func(Match)) {
+	m.startCallback = callback
+}
+
 func (m *DefaultMatch) setSaveCallback(callback func(Match)) {
 	m.saveCallback = callback
 }
@@ -211,3 +508,18 @@ func (m *DefaultMatch) GetId() string {
 func (m *DefaultMatch) GetPlayers() map[string]Player {
 	return m.Players
 }
+
+// playerRtt method    records the round trip time sample of the player and
+// updates its round trip time on the match goroutine, so replays see the same
+// round trip time at each move. It doesn't wait for the match goroutine, the
+// connection reader reports the samples
+func (m *DefaultMatch) playerRtt(playerId string, sample time.Duration) {
+	player, exist := m.GetPlayerWithId(playerId)
+	if !exist {
+		return
+	}
+	m.post(func() {
+		m.record(RecordRtt, playerId, "", sample)
+		player.updateRtt(sample)
+	})
+}
@@ -0,0 +1,158 @@
+package server
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/yelaco/ludofy/pkg/logging"
+	"go.uber.org/zap"
+)
+
+// MetricsNamespace prefixes the metrics of the server, custom metrics of
+// games should use it as well
+const MetricsNamespace = "ludofy"
+
+var (
+	messagesReceived = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "messages_received_total",
+		Help:      "Messages received from players.",
+	})
+	messagesSent = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "messages_sent_total",
+		Help:      "Messages sent to players and spectators.",
+	})
+	handleMoveDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: MetricsNamespace,
+		Name:      "handle_move_duration_seconds",
+		Help:      "Duration of HandleMove calls.",
+		Buckets:   prometheus.ExponentialBuckets(0.0001, 4, 9),
+	})
+	tickDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: MetricsNamespace,
+		Name:      "tick_duration_seconds",
+		Help:      "Duration of OnTick calls of matches in tick mode.",
+		Buckets:   prometheus.ExponentialBuckets(0.0001, 4, 9),
+	})
+	matchEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "match_events_total",
+		Help:      "Match starts, saves, ends, aborts and migrations.",
+	}, []string{"event"})
+	backendFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "backend_failures_total",
+		Help:      "Failed calls to the match store and sink, AppSync and Lambda by default.",
+	}, []string{"call"})
+)
+
+// RegisterMetrics registers custom metrics of a game, they are served on
+// /metrics along with the server metrics
+func RegisterMetrics(collectors ...prometheus.Collector) error {
+	for _, collector := range collectors {
+		if err := prometheus.Register(collector); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var (
+	matchesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(MetricsNamespace, "", "matches"),
+		"Loaded matches by state.",
+		[]string{"state"},
+		nil,
+	)
+	connectedPlayersDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(MetricsNamespace, "", "connected_players"),
+		"Players connected to the loaded matches.",
+		nil,
+		nil,
+	)
+	protectionEnabledDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(MetricsNamespace, "", "server_protection_enabled"),
+		"Whether the server is protected from scale in.",
+		nil,
+		nil,
+	)
+	protectionRemainingDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(MetricsNamespace, "", "server_protection_remaining_seconds"),
+		"Time left before the server protection timer expires.",
+		nil,
+		nil,
+	)
+	spooledEventsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(MetricsNamespace, "", "spooled_events"),
+		"Match end and abort events waiting to be published.",
+		nil,
+		nil,
+	)
+)
+
+// serverCollector collects the state of the server on scrape
+type serverCollector struct {
+	server *DefaultServer
+}
+
+func (c serverCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- matchesDesc
+	ch <- connectedPlayersDesc
+	ch <- protectionEnabledDesc
+	ch <- protectionRemainingDesc
+	ch <- spooledEventsDesc
+}
+
+func (c serverCollector) Collect(ch chan<- prometheus.Metric) {
+	states := map[string]int{
+		"waiting": 0,
+		"active":  0,
+		"ended":   0,
+	}
+	connected := 0
+	c.server.matches.Range(func(key, value any) bool {
+		match, ok := value.(Match)
+		if !ok {
+			return true
+		}
+		for _, player := range match.GetPlayers() {
+			if player.GetStatus() == CONNECTED.String() {
+				connected++
+			}
+		}
+		states[matchStatus(match)]++
+		return true
+	})
+	for state, count := range states {
+		ch <- prometheus.MustNewConstMetric(matchesDesc, prometheus.GaugeValue, float64(count), state)
+	}
+	ch <- prometheus.MustNewConstMetric(connectedPlayersDesc, prometheus.GaugeValue, float64(connected))
+
+	protected := 0.0
+	if c.server.protected.Load() {
+		protected = 1
+	}
+	ch <- prometheus.MustNewConstMetric(protectionEnabledDesc, prometheus.GaugeValue, protected)
+	ch <- prometheus.MustNewConstMetric(protectionRemainingDesc, prometheus.GaugeValue, c.server.protectionRemaining().Seconds())
+	ch <- prometheus.MustNewConstMetric(spooledEventsDesc, prometheus.GaugeValue, float64(c.server.spool.pending.Load()))
+}
+
+// matchStatus returns whether the match waits for players, is active or ended
+func matchStatus(match Match) string {
+	if match.IsEnded() {
+		return "ended"
+	}
+	for _, player := range match.GetPlayers() {
+		if player.GetStatus() == INIT.String() {
+			return "waiting"
+		}
+	}
+	return "active"
+}
+
+// registerMetrics method    registers the collector of the server state
+func (s *DefaultServer) registerMetrics() {
+	if err := prometheus.Register(serverCollector{server: s}); err != nil {
+		logging.Error("failed to register server metrics", zap.Error(err))
+	}
+}
@@ -0,0 +1,322 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/gorilla/websocket"
+	"github.com/yelaco/ludofy/internal/domains/entities"
+	"github.com/yelaco/ludofy/pkg/logging"
+	"go.uber.org/zap"
+)
+
+// MatchSnapshot is the full state of a match handed over to another server,
+// serialized by the SnapshotHandler of the match
+type MatchSnapshot struct {
+	MatchId   string               `json:"matchId"`
+	Target    string               `json:"target"`
+	Data      []byte               `json:"data"`
+	Chat      []ChatLine           `json:"chat,omitempty"`
+	Pause     *entities.PauseState `json:"pause,omitempty"`
+	CreatedAt time.Time            `json:"createdAt"`
+}
+
+type serverMigratingResponse struct {
+	Type   string `json:"type"`
+	Server string `json:"server"`
+}
+
+// StaticMigrationTarget hands the matches over to the same server every time
+type StaticMigrationTarget string
+
+func (t StaticMigrationTarget) PickMigrationTarget(ctx context.Context) (string, error) {
+	return string(t), nil
+}
+
+type fileSnapshotStore struct {
+	dir string
+}
+
+// NewFileSnapshotStore keeps snapshots in <dir>/<matchId>/snapshot.json
+func NewFileSnapshotStore(dir string) SnapshotStore {
+	return &fileSnapshotStore{dir: dir}
+}
+
+func (s *fileSnapshotStore) path(matchId string) string {
+	return filepath.Join(s.dir, matchId, "snapshot.json")
+}
+
+func (s *fileSnapshotStore) PutMatchSnapshot(ctx context.Context, snapshot MatchSnapshot) error {
+	payload, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to marshal snapshot: %w", err)
+	}
+	path := s.path(snapshot.MatchId)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create snapshot dir: %w", err)
+	}
+	if err := os.WriteFile(path, payload, 0o644); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	return nil
+}
+
+func (s *fileSnapshotStore) GetMatchSnapshot(ctx context.Context, matchId string) (*MatchSnapshot, error) {
+	payload, err := os.ReadFile(s.path(matchId))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+	var snapshot MatchSnapshot
+	if err := json.Unmarshal(payload, &snapshot); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal snapshot: %w", err)
+	}
+	return &snapshot, nil
+}
+
+func (s *fileSnapshotStore) DeleteMatchSnapshot(ctx context.Context, matchId string) error {
+	err := os.Remove(s.path(matchId))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete snapshot: %w", err)
+	}
+	return nil
+}
+
+type s3SnapshotStore struct {
+	client *s3.Client
+	bucket string
+	prefix string
+}
+
+// NewS3SnapshotStore keeps snapshots in <prefix><matchId>.json
+func NewS3SnapshotStore(client *s3.Client, bucket, prefix string) SnapshotStore {
+	return &s3SnapshotStore{
+		client: client,
+		bucket: bucket,
+		prefix: prefix,
+	}
+}
+
+func (s *s3SnapshotStore) key(matchId string) string {
+	return s.prefix + matchId + ".json"
+}
+
+func (s *s3SnapshotStore) PutMatchSnapshot(ctx context.Context, snapshot MatchSnapshot) error {
+	payload, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to marshal snapshot: %w", err)
+	}
+	_, err = s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(s.key(snapshot.MatchId)),
+		Body:        bytes.NewReader(payload),
+		ContentType: aws.String("application/json"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put object: %w", err)
+	}
+	return nil
+}
+
+func (s *s3SnapshotStore) GetMatchSnapshot(ctx context.Context, matchId string) (*MatchSnapshot, error) {
+	output, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.key(matchId)),
+	})
+	var noSuchKey *types.NoSuchKey
+	if errors.As(err, &noSuchKey) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get object: %w", err)
+	}
+	defer output.Body.Close()
+	payload, err := io.ReadAll(output.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object: %w", err)
+	}
+	var snapshot MatchSnapshot
+	if err := json.Unmarshal(payload, &snapshot); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal snapshot: %w", err)
+	}
+	return &snapshot, nil
+}
+
+func (s *s3SnapshotStore) DeleteMatchSnapshot(ctx context.Context, matchId string) error {
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.key(matchId)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete object: %w", err)
+	}
+	return nil
+}
+
+// handOff method    pauses the match goroutine and runs handOff, which
+// snapshots and stores the match or saves it on drain. On success the match goroutine stops for
+// good without ending the match, otherwise the match carries on
+func (m *DefaultMatch) handOff(handOff func() error) error {
+	err := ErrMatchEnded
+	m.exec(func() {
+		if m.IsEnded() {
+			return
+		}
+		if err = handOff(); err != nil {
+			return
+		}
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if m.ended {
+			err = ErrMatchEnded
+			return
+		}
+		m.ended = true
+		m.stopAutosave()
+	})
+	return err
+}
+
+// MigrateMatch method    hands the match over to the target server. The
+// match is snapshotted through its SnapshotHandler, the active match is
+// pointed to the target and the clients are told to reconnect there, where
+// the match is restored with the RestoreHandler of the server handler
+func (s *DefaultServer) MigrateMatch(ctx context.Context, matchId, target string) error {
+	match, err := s.getMatch(matchId)
+	if err != nil {
+		return err
+	}
+	return s.migrateMatch(ctx, match, target)
+}
+
+func (s *DefaultServer) migrateMatch(ctx context.Context, match Match, target string) error {
+	if s.snapshots == nil {
+		return ErrMigrationDisabled
+	}
+	handler, ok := match.GetHandler().(SnapshotHandler)
+	if !ok {
+		return ErrSnapshotNotSupported
+	}
+	matchId := match.GetId()
+
+	err := match.handOff(func() error {
+		data, err := handler.OnMatchSnapshot()
+		if err != nil {
+			return fmt.Errorf("failed to snapshot match: %w", err)
+		}
+		err = s.snapshots.PutMatchSnapshot(ctx, MatchSnapshot{
+			MatchId:   matchId,
+			Target:    target,
+			Data:      data,
+			Chat:      match.getChatLog(),
+			Pause:     match.getPauseState(),
+			CreatedAt: match.Now(),
+		})
+		if err != nil {
+			backendFailures.WithLabelValues("snapshot").Inc()
+			return fmt.Errorf("failed to store snapshot: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// The match is gone from this server before the clients are told to
+	// reconnect, a reconnect which still lands here finds the snapshot
+	// instead of the stopped match and is turned away. Its saves are still
+	// flushed before the clients leave
+	saver, hasSaver := s.savers.Load(matchId)
+	s.removeMatch(matchId)
+
+	// Clients are told the target directly, so a failed update only affects
+	// clients which look the server up again
+	err = s.store.UpdateActiveMatch(ctx, matchId, ActiveMatchUpdate{
+		Server: &target,
+	})
+	if err != nil {
+		backendFailures.WithLabelValues("migrate").Inc()
+		logging.Error("failed to update server of active match",
+			zap.String("match_id", matchId),
+			zap.Error(err),
+		)
+	}
+
+	if hasSaver {
+		saver.(*matchSaver).flush()
+	}
+	matchEvents.WithLabelValues("migrate").Inc()
+	match.Broadcast(serverMigratingResponse{
+		Type:   "serverMigrating",
+		Server: target,
+	})
+	deadline := time.Now().Add(5 * time.Second)
+	for _, player := range match.GetPlayers() {
+		player.WriteControl(
+			websocket.CloseMessage,
+			websocket.FormatCloseMessage(
+				websocket.CloseServiceRestart,
+				"server migrating",
+			),
+			deadline,
+		)
+	}
+	match.disconnectSpectators("server migrating", deadline)
+
+	s.saveRecording(match)
+	logging.Info("match migrated",
+		zap.String("match_id", matchId),
+		zap.String("target", target),
+	)
+	return nil
+}
+
+// getSnapshot method    returns the snapshot the match was handed over with,
+// nil if there is none. A snapshot which can't be read returns
+// ErrSnapshotUnavailable rather than letting the match resume from an older
+// save, and a snapshot for another server returns ErrMatchMigrated, the match
+// must only be restored on its target
+func (s *DefaultServer) getSnapshot(ctx context.Context, matchId string) (*MatchSnapshot, error) {
+	if s.snapshots == nil {
+		return nil, nil
+	}
+	snapshot, err := s.snapshots.GetMatchSnapshot(ctx, matchId)
+	if err != nil {
+		backendFailures.WithLabelValues("snapshot").Inc()
+		logging.Error("failed to get match snapshot",
+			zap.String("match_id", matchId),
+			zap.Error(err),
+		)
+		return nil, fmt.Errorf("%w: %w", ErrSnapshotUnavailable, err)
+	}
+	if snapshot != nil && snapshot.Target != s.cfg.Address {
+		return nil, fmt.Errorf("%w: %s", ErrMatchMigrated, snapshot.Target)
+	}
+	return snapshot, nil
+}
+
+// restoreMatch method    restores a handed over match with the RestoreHandler
+// of the server handler
+func (s *DefaultServer) restoreMatch(activeMatch entities.ActiveMatch, snapshot MatchSnapshot) (Match, error) {
+	handler, ok := s.handler.(RestoreHandler)
+	if !ok {
+		return nil, ErrSnapshotNotSupported
+	}
+	match, err := handler.OnMatchRestore(activeMatch, snapshot.Data)
+	if err != nil {
+		return nil, err
+	}
+	match.setChatLog(snapshot.Chat)
+	return match, nil
+}
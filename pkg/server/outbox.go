@@ -0,0 +1,77 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// seqField is the key of the sequence number in stamped messages, namespaced
+// so it doesn't clash with the seq fields of the games
+const seqField = "_seq"
+
+type outboxMessage struct {
+	seq   uint64
+	codec codec
+	data  []byte
+}
+
+// outbox keeps the last sequenced messages of a player for replay on reconnect
+type outbox struct {
+	messages []outboxMessage
+	size     int
+	evicted  uint64 // sequence of the latest message dropped from the outbox
+}
+
+func newOutbox(size int) *outbox {
+	return &outbox{
+		messages: make([]outboxMessage, 0, size),
+		size:     size,
+	}
+}
+
+func (o *outbox) push(seq uint64, codec codec, data []byte) {
+	if len(o.messages) >= o.size {
+		o.evicted = o.messages[0].seq
+		o.messages = o.messages[1:]
+	}
+	o.messages = append(o.messages, outboxMessage{seq: seq, codec: codec, data: data})
+}
+
+// since returns the messages after lastSeq, or false if some of them were
+// already dropped from the outbox
+func (o *outbox) since(lastSeq, currentSeq uint64) ([]outboxMessage, bool) {
+	if lastSeq > currentSeq || lastSeq < o.evicted {
+		return nil, false
+	}
+	missed := []outboxMessage{}
+	for _, msg := range o.messages {
+		if msg.seq > lastSeq {
+			missed = append(missed, msg)
+		}
+	}
+	return missed, true
+}
+
+// stampSequence marshals the message and adds the sequence number to JSON
+// objects. Objects which already have a seqField can't be stamped
+func stampSequence(msg interface{}, seq uint64) ([]byte, error) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal message: %w", err)
+	}
+	if len(data) < 2 || data[0] != '{' {
+		return data, nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal message: %w", err)
+	}
+	if _, exist := fields[seqField]; exist {
+		return nil, ErrSeqFieldReserved
+	}
+	stamp := fmt.Sprintf(`{"%s":%d`, seqField, seq)
+	if data[1] != '}' {
+		stamp += ","
+	}
+	return append([]byte(stamp), data[1:]...), nil
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"encoding/json"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPlayerResume(t *testing.T) {
+	player := NewDefaultPlayer("a", "m1").(*DefaultPlayer)
+	player.setSequence(new(atomic.Uint64), 4)
+	for i := range 3 {
+		if err := player.Write(map[string]int{"n": i}); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+
+	conn, client := newTestConn(t)
+	if !player.resume(conn, 1) {
+		t.Fatal("resume failed with the missed messages in the outbox")
+	}
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	for _, want := range []int{1, 2} {
+		_, data, err := client.ReadMessage()
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		var msg map[string]int
+		json.Unmarshal(data, &msg)
+		if msg["n"] != want {
+			t.Fatalf("replayed %s, want n %d", data, want)
+		}
+	}
+}
+
+func TestPlayerResumeEvicted(t *testing.T) {
+	player := NewDefaultPlayer("a", "m1").(*DefaultPlayer)
+	player.setSequence(new(atomic.Uint64), 2)
+	for i := range 4 {
+		player.Write(map[string]int{"n": i})
+	}
+	conn, _ := newTestConn(t)
+	if player.resume(conn, 1) {
+		t.Fatal("resumed although the missed messages were dropped from the outbox")
+	}
+}
+
+func TestPlayerResumeWriteFailure(t *testing.T) {
+	player := NewDefaultPlayer("a", "m1").(*DefaultPlayer)
+	player.setSequence(new(atomic.Uint64), 4)
+	for i := range 3 {
+		player.Write(map[string]int{"n": i})
+	}
+	conn, _ := newTestConn(t)
+	conn.Close()
+	if player.resume(conn, 0) {
+		t.Fatal("resumed although the missed messages couldn't be written")
+	}
+}
+
+func TestMatchSequence(t *testing.T) {
+	players := map[string]Player{
+		"a": NewDefaultPlayer("a", "m1"),
+		"b": NewDefaultPlayer("b", "m1"),
+	}
+	match := NewDefaultMatch("m1", players)
+	match.enableSequencing(4)
+	players["a"].Write(map[string]int{"n": 0})
+	players["b"].Write(map[string]int{"n": 1})
+	players["a"].Write(map[string]int{"n": 2})
+
+	// a missed the message written to b, its sequence number is skipped
+	conn, client := newTestConn(t)
+	if !players["a"].resume(conn, 1) {
+		t.Fatal("resume failed with the missed messages in the outbox")
+	}
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	_, data, err := client.ReadMessage()
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	var msg struct {
+		Seq uint64 `json:"_seq"`
+		N   int    `json:"n"`
+	}
+	json.Unmarshal(data, &msg)
+	if msg.Seq != 3 || msg.N != 2 {
+		t.Fatalf("replayed %s, want n 2 with seq 3", data)
+	}
+}
@@ -0,0 +1,385 @@
+package server
+
+import (
+	"encoding/json"
+	"maps"
+	"time"
+
+	"github.com/yelaco/ludofy/internal/domains/entities"
+	"github.com/yelaco/ludofy/pkg/logging"
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultPauseBudget is the total pause time of each player when the
+	// pause policy doesn't set one
+	defaultPauseBudget = 5 * time.Minute
+	// defaultPauseMaxDuration is the longest pause when the pause policy
+	// doesn't set one
+	defaultPauseMaxDuration = 2 * time.Minute
+)
+
+// pauseTimer is the timer resuming the match when the pause runs out
+const pauseTimer = "pauseExpired"
+
+const (
+	pauseRequested  = "pauseRequested"
+	resumeRequested = "resumeRequested"
+	pauseDeclined   = "declined"
+	pauseStarted    = "paused"
+	pauseEnded      = "resumed"
+)
+
+// PausePolicy enables pausing the match. A player sends
+// {"type":"pause","data":{"action":"request"}} to ask for a pause, or for the
+// match to resume while paused, and the other players answer with the actions
+// "accept" or "decline". Bots never need to accept. Moves are refused while
+// the match is paused
+type PausePolicy struct {
+	// Budget is the total pause time of each player, charged to the player
+	// who requested the pause, 5 minutes when 0
+	Budget time.Duration
+	// MaxDuration is the longest a pause lasts before the match resumes on
+	// its own, 2 minutes when 0
+	MaxDuration time.Duration
+}
+
+func (p PausePolicy) budget() time.Duration {
+	if p.Budget <= 0 {
+		return defaultPauseBudget
+	}
+	return p.Budget
+}
+
+func (p PausePolicy) maxDuration() time.Duration {
+	if p.MaxDuration <= 0 {
+		return defaultPauseMaxDuration
+	}
+	return p.MaxDuration
+}
+
+type pauseRequest struct {
+	Action string `json:"action"`
+}
+
+type pauseResponse struct {
+	Type     string     `json:"type"`
+	Status   string     `json:"status"`
+	PlayerId string     `json:"playerId,omitempty"`
+	ResumeAt *time.Time `json:"resumeAt,omitempty"`
+}
+
+// pendingPause is a pause or resume request waiting for the other players
+type pendingPause struct {
+	resume   bool
+	playerId string
+	accepted map[string]struct{}
+}
+
+// SetPausePolicy method    enables pausing the match. Must be set before the
+// match starts
+func (m *DefaultMatch) SetPausePolicy(policy PausePolicy) {
+	m.pausePolicy = &policy
+}
+
+// IsPaused method    returns true while the match is paused
+func (m *DefaultMatch) IsPaused() bool {
+	m.pauseMu.Lock()
+	defer m.pauseMu.Unlock()
+	return m.pause.Paused
+}
+
+// handlePause method    handles the pause messages of the player, false if
+// the message isn't one or pausing is disabled
+func (m *DefaultMatch) handlePause(playerId string, message []byte) bool {
+	if m.pausePolicy == nil {
+		return false
+	}
+	var envelope struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(message, &envelope); err != nil || envelope.Type != "pause" {
+		return false
+	}
+	player, exist := m.Players[playerId]
+	if !exist {
+		return false
+	}
+	var msg Message[pauseRequest]
+	if err := json.Unmarshal(message, &msg); err != nil {
+		m.rejectPause(player, ErrStatusMalformedPayload)
+		return true
+	}
+	m.exec(func() {
+		if m.IsEnded() {
+			return
+		}
+		m.recordMessage(playerId)
+		switch msg.Data.Action {
+		case "request":
+			m.requestPause(player)
+		case "accept":
+			m.answerPause(player, true)
+		case "decline":
+			m.answerPause(player, false)
+		default:
+			m.rejectPause(player, ErrStatusInvalidPayload)
+		}
+	})
+	return true
+}
+
+// requestPause method    asks the other players to pause the match, or to
+// resume it while paused. Requesting what another player already requested
+// accepts it
+func (m *DefaultMatch) requestPause(player Player) {
+	if pending := m.pausePending; pending != nil {
+		if pending.playerId != player.GetId() {
+			m.answerPause(player, true)
+		}
+		return
+	}
+	resume := m.IsPaused()
+	if !resume && m.pauseLeft(player.GetId()) <= 0 {
+		m.rejectPause(player, ErrStatusPauseBudgetSpent)
+		return
+	}
+
+	m.pausePending = &pendingPause{
+		resume:   resume,
+		playerId: player.GetId(),
+		accepted: make(map[string]struct{}),
+	}
+	status := pauseRequested
+	if resume {
+		status = resumeRequested
+	}
+	m.notifyPause(pauseResponse{
+		Type:     "pause",
+		Status:   status,
+		PlayerId: player.GetId(),
+	}, false)
+	m.settlePause()
+}
+
+// answerPause method    accepts or declines the pending request of another
+// player
+func (m *DefaultMatch) answerPause(player Player, accept bool) {
+	pending := m.pausePending
+	if pending == nil || pending.playerId == player.GetId() {
+		m.rejectPause(player, ErrStatusNoPauseRequest)
+		return
+	}
+	if !accept {
+		m.pausePending = nil
+		m.notifyPause(pauseResponse{
+			Type:     "pause",
+			Status:   pauseDeclined,
+			PlayerId: player.GetId(),
+		}, false)
+		return
+	}
+	pending.accepted[player.GetId()] = struct{}{}
+	m.settlePause()
+}
+
+// settlePause method    pauses or resumes the match once every other player,
+// bots aside, accepted the pending request
+func (m *DefaultMatch) settlePause() {
+	pending := m.pausePending
+	for id, player := range m.Players {
+		if _, accepted := pending.accepted[id]; !accepted && id != pending.playerId && !player.IsBot() {
+			return
+		}
+	}
+	if pending.resume {
+		m.resumeMatch(pending.playerId)
+	} else {
+		m.pauseMatch(pending.playerId)
+	}
+}
+
+// pauseMatch method    pauses the match for the rest of the pause budget of
+// the player, up to the maximum duration of a pause
+func (m *DefaultMatch) pauseMatch(playerId string) {
+	now := m.Now()
+	duration := min(m.pausePolicy.maxDuration(), m.pauseLeft(playerId))
+	resumeAt := now.Add(duration)
+
+	m.pauseMu.Lock()
+	m.pause.Paused = true
+	m.pause.PausedBy = playerId
+	m.pause.PausedAt = now
+	m.pause.ResumeAt = resumeAt
+	m.pauseMu.Unlock()
+	m.pausePending = nil
+	m.armPauseTimer(duration)
+
+	if handler, ok := m.handler.(PauseHandler); ok {
+		if err := handler.OnPause(); err != nil {
+			logging.Error("on pause", zap.Error(err))
+		}
+	}
+	logging.Info("match paused",
+		zap.String("match_id", m.GetId()),
+		zap.String("player_id", playerId),
+		zap.String("duration", duration.String()),
+	)
+	m.notifyPause(pauseResponse{
+		Type:     "pause",
+		Status:   pauseStarted,
+		PlayerId: playerId,
+		ResumeAt: &resumeAt,
+	}, true)
+	m.Save()
+}
+
+// resumeMatch method    resumes the match and charges the pause to the player
+// who requested it. playerId is the player who requested the resume, empty
+// when the pause ran out
+func (m *DefaultMatch) resumeMatch(playerId string) {
+	m.pauseMu.Lock()
+	pausedFor := max(m.Now().Sub(m.pause.PausedAt), 0)
+	if m.pause.Used == nil {
+		m.pause.Used = make(map[string]time.Duration)
+	}
+	m.pause.Used[m.pause.PausedBy] += pausedFor
+	m.pause.Paused = false
+	m.pause.PausedBy = ""
+	m.pause.PausedAt = time.Time{}
+	m.pause.ResumeAt = time.Time{}
+	m.pauseMu.Unlock()
+	m.pausePending = nil
+	if m.pauseTimer != nil {
+		m.pauseTimer.Stop()
+	}
+
+	logging.Info("match resumed",
+		zap.String("match_id", m.GetId()),
+		zap.String("player_id", playerId),
+		zap.String("paused_for", pausedFor.String()),
+	)
+	m.notifyPause(pauseResponse{
+		Type:     "pause",
+		Status:   pauseEnded,
+		PlayerId: playerId,
+	}, true)
+	if handler, ok := m.handler.(PauseHandler); ok {
+		if err := handler.OnResume(pausedFor); err != nil {
+			logging.Error("on resume", zap.Error(err))
+		}
+	}
+	m.Save()
+}
+
+// expirePause method    resumes the match when its pause ran out, timers of
+// earlier pauses are ignored
+func (m *DefaultMatch) expirePause() {
+	if m.IsEnded() {
+		return
+	}
+	m.pauseMu.Lock()
+	expired := m.pause.Paused && !m.Now().Before(m.pause.ResumeAt)
+	m.pauseMu.Unlock()
+	if expired {
+		m.resumeMatch("")
+	}
+}
+
+// armPauseTimer method    fires the pause timer on the match goroutine once
+// the pause runs out
+func (m *DefaultMatch) armPauseTimer(d time.Duration) {
+	if m.pauseTimer != nil {
+		m.pauseTimer.Stop()
+	}
+	m.pauseTimer = m.Clock().AfterFunc(d, func() {
+		m.FireTimer(pauseTimer)
+	})
+}
+
+// pauseLeft method    returns the pause time the player has left
+func (m *DefaultMatch) pauseLeft(playerId string) time.Duration {
+	m.pauseMu.Lock()
+	defer m.pauseMu.Unlock()
+	return m.pausePolicy.budget() - m.pause.Used[playerId]
+}
+
+// notifyPause method    writes the pause response to the players, and to the
+// spectators if spectators is true
+func (m *DefaultMatch) notifyPause(resp pauseResponse, spectators bool) {
+	for _, player := range m.Players {
+		if err := player.WriteJson(resp); err != nil {
+			logging.Error("couldn't notify player about pause",
+				zap.String("player_id", player.GetId()),
+				zap.Error(err),
+			)
+		}
+	}
+	if spectators {
+		m.broadcastToSpectators(resp)
+	}
+}
+
+func (m *DefaultMatch) rejectPause(player Player, status string) {
+	logging.Info("pause message rejected",
+		zap.String("match_id", m.GetId()),
+		zap.String("player_id", player.GetId()),
+		zap.String("status", status),
+	)
+	player.WriteJson(errorResponse{
+		Type:  "error",
+		Error: status,
+	})
+}
+
+// rejectPausedMove method    refuses the move of a player while the match is
+// paused
+func (m *DefaultMatch) rejectPausedMove(move Move) {
+	player, exist := m.Players[move.GetPlayerId()]
+	if !exist {
+		return
+	}
+	logging.Info("move while paused rejected",
+		zap.String("match_id", m.GetId()),
+		zap.String("player_id", player.GetId()),
+	)
+	player.WriteJson(errorResponse{
+		Type:  "error",
+		Error: ErrStatusMatchPaused,
+	})
+}
+
+// getPauseState method    returns the pause state to save, nil if the match
+// was never paused
+func (m *DefaultMatch) getPauseState() *entities.PauseState {
+	m.pauseMu.Lock()
+	defer m.pauseMu.Unlock()
+	if !m.pause.Paused && len(m.pause.Used) == 0 {
+		return nil
+	}
+	state := m.pause
+	state.Used = maps.Clone(m.pause.Used)
+	return &state
+}
+
+// restorePause method    restores the pause state of a resumed or handed over
+// match once it has its clock. A match still paused is paused again through
+// the PauseHandler for the rest of the pause
+func (m *DefaultMatch) restorePause(state *entities.PauseState) {
+	if state == nil {
+		return
+	}
+	m.pauseMu.Lock()
+	m.pause = *state
+	m.pause.Used = maps.Clone(state.Used)
+	m.pauseMu.Unlock()
+	if !state.Paused {
+		return
+	}
+	if handler, ok := m.handler.(PauseHandler); ok {
+		if err := handler.OnPause(); err != nil {
+			logging.Error("on pause", zap.Error(err))
+		}
+	}
+	m.armPauseTimer(max(state.ResumeAt.Sub(m.Now()), 0))
+}
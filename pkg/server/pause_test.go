@@ -0,0 +1,100 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newPauseDriver(t *testing.T, policy PausePolicy) *testDriver {
+	t.Helper()
+	return newTestDriver(t, Config{ServerHandler: &testServerHandler{setup: func(match *DefaultMatch) {
+		match.SetPausePolicy(policy)
+	}}}, "a", "b")
+}
+
+func pauseStatuses(d *testDriver, playerId string) []string {
+	statuses := []string{}
+	for _, msg := range d.ofType(playerId, "pause") {
+		statuses = append(statuses, msg["status"].(string))
+	}
+	return statuses
+}
+
+func TestPauseFlow(t *testing.T) {
+	d := newPauseDriver(t, PausePolicy{Budget: time.Minute, MaxDuration: 20 * time.Second})
+
+	d.send(t, "a", `{"type":"pause","data":{"action":"request"}}`)
+	if d.Match().IsPaused() {
+		t.Fatal("paused before the other player accepted")
+	}
+	d.send(t, "b", `{"type":"pause","data":{"action":"accept"}}`)
+	if !d.Match().IsPaused() {
+		t.Fatal("not paused once accepted")
+	}
+
+	d.send(t, "b", `{"type":"move","data":{"n":1}}`)
+	if d.total() != 0 || !reflect.DeepEqual(d.errors("b"), []string{ErrStatusMatchPaused}) {
+		t.Fatalf("move while paused handled, errors %v", d.errors("b"))
+	}
+
+	// b asks to resume early, a accepts by asking too
+	d.Advance(5 * time.Second)
+	d.send(t, "b", `{"type":"pause","data":{"action":"request"}}`)
+	d.send(t, "a", `{"type":"pause","data":{"action":"request"}}`)
+	if d.Match().IsPaused() {
+		t.Fatal("still paused once the resume was accepted")
+	}
+	want := []string{pauseRequested, pauseStarted, resumeRequested, pauseEnded}
+	if got := pauseStatuses(d, "b"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("pause statuses %v, want %v", got, want)
+	}
+	if left := d.Match().(*DefaultMatch).pauseLeft("a"); left != 55*time.Second {
+		t.Fatalf("a has %v of pause left, want the pause charged to a", left)
+	}
+
+	d.send(t, "b", `{"type":"move","data":{"n":1}}`)
+	if d.total() != 1 {
+		t.Fatal("move after the pause not handled")
+	}
+	if saves := d.Saves; len(saves) != 2 || saves[1].Pause == nil || saves[1].Pause.Used["a"] != 5*time.Second {
+		t.Fatalf("saves %+v, want the pause state saved on pause and resume", saves)
+	}
+}
+
+func TestPauseExpires(t *testing.T) {
+	d := newPauseDriver(t, PausePolicy{Budget: 30 * time.Second, MaxDuration: time.Minute})
+
+	d.send(t, "a", `{"type":"pause","data":{"action":"request"}}`)
+	d.send(t, "b", `{"type":"pause","data":{"action":"accept"}}`)
+	d.Advance(30 * time.Second)
+	if d.Match().IsPaused() {
+		t.Fatal("still paused once the budget ran out")
+	}
+
+	d.send(t, "a", `{"type":"pause","data":{"action":"request"}}`)
+	if got := d.errors("a"); !reflect.DeepEqual(got, []string{ErrStatusPauseBudgetSpent}) {
+		t.Fatalf("errors %v, want the spent budget refused", got)
+	}
+}
+
+func TestPauseDecline(t *testing.T) {
+	d := newPauseDriver(t, PausePolicy{})
+
+	d.send(t, "b", `{"type":"pause","data":{"action":"accept"}}`)
+	d.send(t, "a", `{"type":"pause","data":{"action":"request"}}`)
+	d.send(t, "a", `{"type":"pause","data":{"action":"accept"}}`)
+	d.send(t, "b", `{"type":"pause","data":{"action":"decline"}}`)
+	if d.Match().IsPaused() {
+		t.Fatal("paused although declined")
+	}
+	if got := d.errors("b"); !reflect.DeepEqual(got, []string{ErrStatusNoPauseRequest}) {
+		t.Fatalf("b errors %v, want the answer without request refused", got)
+	}
+	if got := d.errors("a"); !reflect.DeepEqual(got, []string{ErrStatusNoPauseRequest}) {
+		t.Fatalf("a errors %v, want accepting an own request refused", got)
+	}
+	if got := pauseStatuses(d, "a"); !reflect.DeepEqual(got, []string{pauseRequested, pauseDeclined}) {
+		t.Fatalf("pause statuses %v", got)
+	}
+}
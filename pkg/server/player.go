@@ -2,6 +2,7 @@ package server
 
 import (
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -34,6 +35,23 @@ func (p *DefaultPlayer) setConn(conn *websocket.Conn) {
 		p.Status = CONNECTED
 	}
 	p.Conn = conn
+	if conn != nil {
+		p.codec = codecOf(conn)
+	}
+}
+
+// setOutput method    passes the messages written while the player has no
+// connection to output, used by MatchDriver
+func (p *DefaultPlayer) setOutput(output func(data []byte)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.output = output
+}
+
+func (p *DefaultPlayer) setStatus(status Status) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Status = status
 }
 
 func (s Status) String() string {
@@ -57,13 +75,95 @@ func (p *DefaultPlayer) GetStatus() string {
 	return p.Status.String()
 }
 
-func (p *DefaultPlayer) WriteJson(msg interface{}) error {
+// setSequence method    stamps the messages with the sequence of the match and
+// keeps them in an outbox for replay
+func (p *DefaultPlayer) setSequence(sequence *atomic.Uint64, outboxSize int) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	if p == nil || p.Conn == nil {
+	p.sequence = sequence
+	p.outbox = newOutbox(outboxSize)
+}
+
+// resume method    reconnects the player and replays the messages after lastSeq,
+// returns false if they are no longer in the outbox or one of them couldn't be
+// written, then the player needs a full sync
+func (p *DefaultPlayer) resume(conn *websocket.Conn, lastSeq uint64) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.sequence == nil {
+		return false
+	}
+	missed, ok := p.outbox.since(lastSeq, p.sequence.Load())
+	if !ok {
+		return false
+	}
+	p.Status = CONNECTED
+	p.Conn = conn
+	p.codec = codecOf(conn)
+	for _, msg := range missed {
+		data, err := transcode(msg.data, msg.codec, p.codec)
+		if err != nil {
+			return false
+		}
+		if err := p.Conn.WriteMessage(p.codec.messageType(), data); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Write method    projects the message for the player, encodes it with the
+// codec negotiated by the connection and stamps it with the next sequence
+// number of the match when sequencing is enabled. Messages are kept in the outbox
+// while the player is disconnected
+func (p *DefaultPlayer) Write(msg interface{}) error {
+	if p == nil {
+		return nil
+	}
+	msg, visible := p.project(msg)
+	if !visible {
+		return nil
+	}
+	return p.writeView(msg)
+}
+
+// writeView method    writes a message already projected for the player
+func (p *DefaultPlayer) writeView(msg interface{}) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.sequence == nil && p.Conn == nil && p.output == nil {
+		return nil
+	}
+	if p.codec == nil {
+		p.codec = jsonCodec{}
+	}
+	// The sequence is shared by the players of the match, so a player sees
+	// gaps for the messages written to the others
+	var seq uint64
+	if p.sequence != nil {
+		seq = p.sequence.Add(1)
+	}
+	data, err := p.codec.encode(msg, seq)
+	if err != nil {
+		return err
+	}
+	if p.sequence != nil {
+		p.outbox.push(seq, p.codec, data)
+	}
+	if p.Conn == nil {
+		if p.output != nil {
+			p.output(data)
+		}
 		return nil
 	}
-	return p.Conn.WriteJSON(msg)
+	messagesSent.Inc()
+	return p.Conn.WriteMessage(p.codec.messageType(), data)
+}
+
+// WriteJson method    writes the message with the negotiated codec, JSON
+// unless the client requested another one
+func (p *DefaultPlayer) WriteJson(msg interface{}) error {
+	return p.Write(msg)
 }
 
 func (p *DefaultPlayer) WriteControl(messageType int, data []byte, deadline time.Time) error {
@@ -75,6 +175,55 @@ func (p *DefaultPlayer) WriteControl(messageType int, data []byte, deadline time
 	return p.Conn.WriteControl(messageType, data, deadline)
 }
 
+// closeConn method    sends a close frame with the code and closes the
+// connection of the player, false if the player isn't connected
+func (p *DefaultPlayer) closeConn(code int, reason string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.Conn == nil {
+		return false
+	}
+	p.Conn.WriteControl(
+		websocket.CloseMessage,
+		websocket.FormatCloseMessage(code, reason),
+		time.Now().Add(5*time.Second),
+	)
+	p.Conn.Close()
+	return true
+}
+
+func (p *DefaultPlayer) IsBot() bool {
+	return false
+}
+
+// attach method    sets the match projecting the messages written to the player
+func (p *DefaultPlayer) attach(match Match) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.match = match
+}
+
+// project method    returns the view of the message for the player, as is
+// until the player is attached to its match
+func (p *DefaultPlayer) project(msg interface{}) (interface{}, bool) {
+	p.mu.Lock()
+	match := p.match
+	p.mu.Unlock()
+	if match == nil {
+		return msg, true
+	}
+	return match.project(Viewer{Kind: ViewerPlayer, PlayerId: p.Id}, msg)
+}
+
+// GetTeam method    returns the team of the player, empty without teams
+func (p *DefaultPlayer) GetTeam() string {
+	return p.Team
+}
+
+func (p *DefaultPlayer) setTeam(team string) {
+	p.Team = team
+}
+
 func (p *DefaultPlayer) GetResult() float64 {
 	return p.Result
 }
@@ -82,3 +231,18 @@ func (p *DefaultPlayer) GetResult() float64 {
 func (p *DefaultPlayer) SetResult(result float64) {
 	p.Result = result
 }
+
+// updateRtt method    smooths round trip time samples like TCP SRTT (RFC 6298)
+func (p *DefaultPlayer) updateRtt(sample time.Duration) {
+	current := time.Duration(p.rtt.Load())
+	if current == 0 {
+		p.rtt.Store(int64(sample))
+		return
+	}
+	p.rtt.Store(int64(current - current/8 + sample/8))
+}
+
+// GetRtt method    returns the smoothed round trip time, 0 if not measured yet
+func (p *DefaultPlayer) GetRtt() time.Duration {
+	return time.Duration(p.rtt.Load())
+}
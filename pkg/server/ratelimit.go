@@ -0,0 +1,196 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/yelaco/ludofy/pkg/utils"
+)
+
+// violationResetPeriod is how long a player must stay within its limits
+// before its violation count is forgotten
+const violationResetPeriod = time.Minute
+
+type rateLimitConfig struct {
+	maxMessageSize int64
+	playerRate     float64
+	playerBurst    int
+	matchRate      float64
+	matchBurst     int
+	maxWarnings    int
+	maxViolations  int
+}
+
+func newRateLimitConfig() rateLimitConfig {
+	viper.SetDefault("MAX_MESSAGE_SIZE", 4096)
+	viper.SetDefault("PLAYER_RATE_LIMIT", 10)
+	viper.SetDefault("PLAYER_RATE_BURST", 20)
+	viper.SetDefault("MATCH_RATE_LIMIT", 50)
+	viper.SetDefault("MATCH_RATE_BURST", 100)
+	viper.SetDefault("RATE_LIMIT_MAX_WARNINGS", 3)
+	viper.SetDefault("RATE_LIMIT_MAX_VIOLATIONS", 30)
+	return rateLimitConfig{
+		maxMessageSize: viper.GetInt64("MAX_MESSAGE_SIZE"),
+		playerRate:     viper.GetFloat64("PLAYER_RATE_LIMIT"),
+		playerBurst:    viper.GetInt("PLAYER_RATE_BURST"),
+		matchRate:      viper.GetFloat64("MATCH_RATE_LIMIT"),
+		matchBurst:     viper.GetInt("MATCH_RATE_BURST"),
+		maxWarnings:    viper.GetInt("RATE_LIMIT_MAX_WARNINGS"),
+		maxViolations:  viper.GetInt("RATE_LIMIT_MAX_VIOLATIONS"),
+	}
+}
+
+// tokenBucket allows bursts of burst messages refilled at rate messages per
+// second. A nil bucket allows everything
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	mu     sync.Mutex
+}
+
+func newTokenBucket(rate float64, burst int, now time.Time) *tokenBucket {
+	if rate <= 0 || burst <= 0 {
+		return nil
+	}
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   now,
+	}
+}
+
+func (b *tokenBucket) allow(now time.Time) bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// refund method    gives back the token taken by allow
+func (b *tokenBucket) refund() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = min(b.burst, b.tokens+1)
+}
+
+type rateLimitAction int
+
+const (
+	rateLimitAllow rateLimitAction = iota
+	// rateLimitWarn lets the message through but tells the player it is over
+	// its limit
+	rateLimitWarn
+	rateLimitDrop
+	rateLimitDisconnect
+	// rateLimitShed drops the message of a player within its limits because
+	// the match as a whole is over its limit
+	rateLimitShed
+)
+
+func (a rateLimitAction) String() string {
+	switch a {
+	case rateLimitWarn:
+		return "warn"
+	case rateLimitDrop:
+		return "drop"
+	case rateLimitDisconnect:
+		return "disconnect"
+	case rateLimitShed:
+		return "shed"
+	default:
+		return "allow"
+	}
+}
+
+// rateLimiter limits the messages of a player, escalating from warnings to
+// dropped messages and finally a disconnect on repeated violations. It is kept
+// for the whole match, so reconnecting doesn't reset the violations
+type rateLimiter struct {
+	cfg           rateLimitConfig
+	clock         utils.Clock
+	player        *tokenBucket
+	match         *tokenBucket
+	violations    int
+	lastViolation time.Time
+	mu            sync.Mutex
+}
+
+// matchRateLimits holds the bucket shared by the players of a match and the
+// limiters of the players
+type matchRateLimits struct {
+	bucket  *tokenBucket
+	players sync.Map
+}
+
+// rateLimiterFor method    returns the limiter of the player, created on its
+// first connection to the match
+func (s *DefaultServer) rateLimiterFor(matchId, playerId string) *rateLimiter {
+	cfg := s.cfg.rateLimit
+	clock := s.cfg.clock()
+	value, _ := s.matchLimits.LoadOrStore(matchId, &matchRateLimits{
+		bucket: newTokenBucket(cfg.matchRate, cfg.matchBurst, clock.Now()),
+	})
+	limits := value.(*matchRateLimits)
+	limiter, _ := limits.players.LoadOrStore(playerId, &rateLimiter{
+		cfg:    cfg,
+		clock:  clock,
+		player: newTokenBucket(cfg.playerRate, cfg.playerBurst, clock.Now()),
+		match:  limits.bucket,
+	})
+	return limiter.(*rateLimiter)
+}
+
+// check method    takes a token of the player and of the match for a message.
+// Only the player's own bucket counts violations, a message refused by the
+// match bucket is shed and its player token given back. A warned message is
+// still delivered, so it takes a token of the match
+func (l *rateLimiter) check() (rateLimitAction, int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.clock.Now()
+	if !l.player.allow(now) {
+		action := l.violate(now)
+		if action == rateLimitWarn && !l.match.allow(now) {
+			return rateLimitShed, l.violations
+		}
+		return action, l.violations
+	}
+	if !l.match.allow(now) {
+		l.player.refund()
+		return rateLimitShed, l.violations
+	}
+	return rateLimitAllow, l.violations
+}
+
+func (l *rateLimiter) violate(now time.Time) rateLimitAction {
+	if now.Sub(l.lastViolation) > violationResetPeriod {
+		l.violations = 0
+	}
+	l.violations++
+	l.lastViolation = now
+
+	switch {
+	case l.cfg.maxViolations > 0 && l.violations >= l.cfg.maxViolations:
+		return rateLimitDisconnect
+	case l.violations <= l.cfg.maxWarnings:
+		return rateLimitWarn
+	default:
+		return rateLimitDrop
+	}
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/yelaco/ludofy/pkg/utils"
+)
+
+func newRateLimitServer(t *testing.T, rateLimit rateLimitConfig) (*testServer, *utils.FakeClock) {
+	t.Helper()
+	clock := utils.NewFakeClock(time.Now())
+	srv := newTestServer(t, func(cfg *Config) {
+		cfg.Clock = clock
+		cfg.rateLimit = rateLimit
+	})
+	return srv, clock
+}
+
+func checkAll(limiter *rateLimiter, n int) []rateLimitAction {
+	actions := make([]rateLimitAction, 0, n)
+	for range n {
+		action, _ := limiter.check()
+		actions = append(actions, action)
+	}
+	return actions
+}
+
+func TestRateLimitEscalation(t *testing.T) {
+	srv, clock := newRateLimitServer(t, rateLimitConfig{
+		playerRate:    1,
+		playerBurst:   2,
+		maxWarnings:   1,
+		maxViolations: 3,
+	})
+	limiter := srv.rateLimiterFor("m1", "a")
+
+	got := checkAll(limiter, 5)
+	want := []rateLimitAction{rateLimitAllow, rateLimitAllow, rateLimitWarn, rateLimitDrop, rateLimitDisconnect}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("actions %v, want %v", got, want)
+	}
+
+	// a reconnect keeps the violations, a minute within limits forgets them
+	if srv.rateLimiterFor("m1", "a") != limiter {
+		t.Fatal("reconnect got a new limiter")
+	}
+	clock.Advance(violationResetPeriod + time.Second)
+	got = checkAll(limiter, 3)
+	want = []rateLimitAction{rateLimitAllow, rateLimitAllow, rateLimitWarn}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("actions after the reset %v, want %v", got, want)
+	}
+}
+
+func TestRateLimitShed(t *testing.T) {
+	srv, clock := newRateLimitServer(t, rateLimitConfig{
+		playerRate:  10,
+		playerBurst: 10,
+		matchRate:   1,
+		matchBurst:  2,
+		maxWarnings: 5,
+	})
+	a := srv.rateLimiterFor("m1", "a")
+	b := srv.rateLimiterFor("m1", "b")
+
+	got := []rateLimitAction{}
+	for _, limiter := range []*rateLimiter{a, b, a} {
+		action, _ := limiter.check()
+		got = append(got, action)
+	}
+	if want := []rateLimitAction{rateLimitAllow, rateLimitAllow, rateLimitShed}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("actions %v, want the match limit shared by the players", got)
+	}
+	if _, violations := a.check(); violations != 0 {
+		t.Fatal("shed message counted as a violation of the player")
+	}
+
+	clock.Advance(time.Second)
+	if action, _ := b.check(); action != rateLimitAllow {
+		t.Fatalf("action %v once the match bucket refilled, want allow", action)
+	}
+}
+
+func TestRateLimitWarnTakesMatchToken(t *testing.T) {
+	srv, _ := newRateLimitServer(t, rateLimitConfig{
+		playerRate:  1,
+		playerBurst: 1,
+		matchRate:   1,
+		matchBurst:  2,
+		maxWarnings: 5,
+	})
+	a := srv.rateLimiterFor("m1", "a")
+	b := srv.rateLimiterFor("m1", "b")
+
+	// the warned message of a is delivered and leaves nothing for b
+	got := checkAll(a, 2)
+	if want := []rateLimitAction{rateLimitAllow, rateLimitWarn}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("actions %v, want %v", got, want)
+	}
+	if action, _ := b.check(); action != rateLimitShed {
+		t.Fatalf("action %v, want b shed", action)
+	}
+	if action, _ := a.check(); action != rateLimitShed {
+		t.Fatalf("action %v, want the warning of a shed once the match is over its limit", action)
+	}
+}
@@ -0,0 +1,405 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/yelaco/ludofy/internal/domains/entities"
+	"github.com/yelaco/ludofy/pkg/logging"
+	"go.uber.org/zap"
+)
+
+type RecordEventType string
+
+const (
+	RecordLoad    RecordEventType = "load"
+	RecordJoin    RecordEventType = "join"
+	RecordLeave   RecordEventType = "leave"
+	RecordMessage RecordEventType = "message"
+	RecordTimer   RecordEventType = "timer"
+	RecordRtt     RecordEventType = "rtt"
+	RecordEnd     RecordEventType = "end"
+	RecordAbort   RecordEventType = "abort"
+)
+
+// RecordEvent is an input received by a match. Messages which are not valid
+// JSON are kept in Raw
+type RecordEvent struct {
+	Type     RecordEventType `json:"type"`
+	At       time.Time       `json:"at"`
+	PlayerId string          `json:"playerId,omitempty"`
+	Name     string          `json:"name,omitempty"`
+	Data     json.RawMessage `json:"data,omitempty"`
+	Raw      []byte          `json:"raw,omitempty"`
+}
+
+// Recording is the sequence of inputs a match received, starting with the
+// load event holding the active match and the state it was resumed from. Long
+// matches are saved in several parts numbered from 0, which JoinRecordings
+// puts back together
+type Recording struct {
+	MatchId string        `json:"matchId"`
+	Part    int           `json:"part,omitempty"`
+	Events  []RecordEvent `json:"events"`
+}
+
+// ReadRecording decodes a recording saved by a RecordingSink
+func ReadRecording(r io.Reader) (Recording, error) {
+	var recording Recording
+	if err := json.NewDecoder(r).Decode(&recording); err != nil {
+		return Recording{}, fmt.Errorf("failed to decode recording: %w", err)
+	}
+	return recording, nil
+}
+
+// JoinRecordings joins the parts of the recording of a match in any order,
+// they must all be there
+func JoinRecordings(parts ...Recording) (Recording, error) {
+	if len(parts) == 0 {
+		return Recording{}, fmt.Errorf("%w: no parts", ErrInvalidRecording)
+	}
+	sorted := slices.Clone(parts)
+	slices.SortFunc(sorted, func(a, b Recording) int {
+		return a.Part - b.Part
+	})
+	recording := Recording{MatchId: sorted[0].MatchId}
+	for i, part := range sorted {
+		if part.MatchId != recording.MatchId {
+			return Recording{}, fmt.Errorf("%w: parts of matches %s and %s",
+				ErrInvalidRecording, recording.MatchId, part.MatchId)
+		}
+		if part.Part != i {
+			return Recording{}, fmt.Errorf("%w: part %d missing", ErrInvalidRecording, i)
+		}
+		recording.Events = append(recording.Events, part.Events...)
+	}
+	return recording, nil
+}
+
+// RecordingSink saves the recording of a match when it ends, aborts or the
+// server drains
+type RecordingSink interface {
+	SaveRecording(ctx context.Context, recording Recording) error
+}
+
+type fileRecordingSink struct {
+	dir string
+}
+
+// NewFileRecordingSink writes recordings to <dir>/<matchId>/recording-<nanos>.json
+func NewFileRecordingSink(dir string) RecordingSink {
+	return &fileRecordingSink{dir: dir}
+}
+
+func (s *fileRecordingSink) SaveRecording(ctx context.Context, recording Recording) error {
+	payload, err := json.Marshal(recording)
+	if err != nil {
+		return fmt.Errorf("failed to marshal recording: %w", err)
+	}
+	dir := filepath.Join(s.dir, recording.MatchId)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create recording dir: %w", err)
+	}
+	name := fmt.Sprintf("recording-%d.json", time.Now().UnixNano())
+	if err := os.WriteFile(filepath.Join(dir, name), payload, 0o644); err != nil {
+		return fmt.Errorf("failed to write recording: %w", err)
+	}
+	logging.Info("recording written",
+		zap.String("match_id", recording.MatchId),
+		zap.String("file", name),
+	)
+	return nil
+}
+
+type s3RecordingSink struct {
+	client *s3.Client
+	bucket string
+	prefix string
+}
+
+// NewS3RecordingSink uploads recordings to <prefix><matchId>/recording-<nanos>.json
+func NewS3RecordingSink(client *s3.Client, bucket, prefix string) RecordingSink {
+	return &s3RecordingSink{
+		client: client,
+		bucket: bucket,
+		prefix: prefix,
+	}
+}
+
+func (s *s3RecordingSink) SaveRecording(ctx context.Context, recording Recording) error {
+	payload, err := json.Marshal(recording)
+	if err != nil {
+		return fmt.Errorf("failed to marshal recording: %w", err)
+	}
+	key := fmt.Sprintf("%s%s/recording-%d.json", s.prefix, recording.MatchId, time.Now().UnixNano())
+	_, err = s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(payload),
+		ContentType: aws.String("application/json"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put object: %w", err)
+	}
+	return nil
+}
+
+// recordedLoad is the data of the load event, a match handed over by another
+// server holds the snapshot it was restored from and its pause state
+type recordedLoad struct {
+	ActiveMatch entities.ActiveMatch
+	MatchState  *recordedMatchState  `json:",omitempty"`
+	Snapshot    []byte               `json:",omitempty"`
+	Pause       *entities.PauseState `json:",omitempty"`
+}
+
+// recordedMatchState is entities.MatchState with concrete player state and
+// move types, so it can be decoded back
+type recordedMatchState struct {
+	Id           string
+	MatchId      string
+	PlayerStates []entities.PlayeState
+	GameState    interface{}
+	Move         entities.Move
+	Pause        *entities.PauseState
+	Timestamp    time.Time
+}
+
+func newRecordedLoad(
+	activeMatch entities.ActiveMatch,
+	matchState *entities.MatchState,
+	snapshot *MatchSnapshot,
+) (recordedLoad, error) {
+	load := recordedLoad{ActiveMatch: activeMatch}
+	if snapshot != nil {
+		load.Snapshot = snapshot.Data
+		load.Pause = snapshot.Pause
+	}
+	if matchState == nil {
+		return load, nil
+	}
+	data, err := json.Marshal(matchState)
+	if err != nil {
+		return recordedLoad{}, fmt.Errorf("failed to marshal match state: %w", err)
+	}
+	load.MatchState = new(recordedMatchState)
+	if err := json.Unmarshal(data, load.MatchState); err != nil {
+		return recordedLoad{}, fmt.Errorf("failed to unmarshal match state: %w", err)
+	}
+	return load, nil
+}
+
+func (s *recordedMatchState) toEntity() entities.MatchState {
+	matchState := entities.MatchState{
+		Id:           s.Id,
+		MatchId:      s.MatchId,
+		PlayerStates: make([]entities.PlayerStateInterface, 0, len(s.PlayerStates)),
+		GameState:    s.GameState,
+		Pause:        s.Pause,
+		Timestamp:    s.Timestamp,
+	}
+	for _, playerState := range s.PlayerStates {
+		matchState.PlayerStates = append(matchState.PlayerStates, playerState)
+	}
+	if s.Move != nil {
+		matchState.Move = s.Move
+	}
+	return matchState
+}
+
+// recordEventOverhead is roughly the size of an encoded event without its
+// data, counted against the recorder budget
+const recordEventOverhead = 64
+
+// recorder keeps the events of a match in memory until the recording is
+// saved. Once the events exceed the byte budget they are flushed as a part of
+// the recording. Messages wait in pending until the match goroutine handles
+// what they lead to, so they are recorded in the order the match processed them
+type recorder struct {
+	matchId string
+	part    int
+	events  []RecordEvent
+	bytes   int
+	budget  int
+	flush   func(Recording)
+	pending map[string][]byte
+	mu      sync.Mutex
+}
+
+func newRecorder(matchId string, budget int, flush func(Recording)) *recorder {
+	return &recorder{
+		matchId: matchId,
+		events:  []RecordEvent{},
+		budget:  budget,
+		flush:   flush,
+		pending: make(map[string][]byte),
+	}
+}
+
+func (r *recorder) record(event RecordEvent) {
+	r.mu.Lock()
+	r.events = append(r.events, event)
+	r.bytes += recordEventOverhead + len(event.PlayerId) + len(event.Name) + len(event.Data) + len(event.Raw)
+	if r.budget <= 0 || r.bytes < r.budget || r.flush == nil {
+		r.mu.Unlock()
+		return
+	}
+	part := Recording{
+		MatchId: r.matchId,
+		Part:    r.part,
+		Events:  r.events,
+	}
+	r.part++
+	r.events = []RecordEvent{}
+	r.bytes = 0
+	r.mu.Unlock()
+	r.flush(part)
+}
+
+func (r *recorder) recording() Recording {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return Recording{
+		MatchId: r.matchId,
+		Part:    r.part,
+		Events:  append([]RecordEvent{}, r.events...),
+	}
+}
+
+func (r *recorder) setPending(playerId string, msg []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pending[playerId] = msg
+}
+
+func (r *recorder) hasPending(playerId string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.pending[playerId]
+	return ok
+}
+
+func (r *recorder) takePending(playerId string) ([]byte, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	msg, ok := r.pending[playerId]
+	delete(r.pending, playerId)
+	return msg, ok
+}
+
+func (m *DefaultMatch) setRecorder(recorder *recorder) {
+	m.recorder = recorder
+}
+
+// record method    records an input of the match when recording is enabled
+func (m *DefaultMatch) record(eventType RecordEventType, playerId, name string, data any) {
+	if m.recorder == nil {
+		return
+	}
+	event := RecordEvent{
+		Type:     eventType,
+		At:       m.Now(),
+		PlayerId: playerId,
+		Name:     name,
+	}
+	switch data := data.(type) {
+	case nil:
+	case []byte:
+		if json.Valid(data) {
+			event.Data = data
+		} else {
+			event.Raw = data
+		}
+	default:
+		payload, err := json.Marshal(data)
+		if err != nil {
+			logging.Error("failed to record event",
+				zap.String("match_id", m.GetId()),
+				zap.String("type", string(eventType)),
+				zap.Error(err),
+			)
+			return
+		}
+		event.Data = payload
+	}
+	m.recorder.record(event)
+}
+
+// beginMessage method    keeps the message of the player until the match
+// goroutine handles it or the move it leads to
+func (m *DefaultMatch) beginMessage(playerId string, msg []byte) {
+	if m.recorder == nil {
+		return
+	}
+	m.recorder.setPending(playerId, msg)
+}
+
+// recordMessage method    records the pending message of the player, on the
+// match goroutine
+func (m *DefaultMatch) recordMessage(playerId string) {
+	if m.recorder == nil {
+		return
+	}
+	if msg, ok := m.recorder.takePending(playerId); ok {
+		m.record(RecordMessage, playerId, "", msg)
+	}
+}
+
+// endMessage method    records the message of the player if nothing it led
+// to ran on the match goroutine, like messages the handler rejected
+func (m *DefaultMatch) endMessage(playerId string) {
+	if m.recorder == nil || !m.recorder.hasPending(playerId) {
+		return
+	}
+	m.exec(func() {
+		if m.IsEnded() {
+			m.recorder.takePending(playerId)
+			return
+		}
+		m.recordMessage(playerId)
+	})
+}
+
+func (m *DefaultMatch) recording() *Recording {
+	if m.recorder == nil {
+		return nil
+	}
+	recording := m.recorder.recording()
+	return &recording
+}
+
+// saveRecording method    saves the rest of the recording of the match to
+// the recording sink
+func (s *DefaultServer) saveRecording(match Match) {
+	if s.recordings == nil {
+		return
+	}
+	recording := match.recording()
+	if recording == nil {
+		return
+	}
+	s.saveRecordingPart(*recording)
+}
+
+// saveRecordingPart method    saves a part of the recording, the recorder
+// flushes the full parts in the background
+func (s *DefaultServer) saveRecordingPart(recording Recording) {
+	if err := s.recordings.SaveRecording(context.Background(), recording); err != nil {
+		backendFailures.WithLabelValues("recording").Inc()
+		logging.Error("failed to save recording",
+			zap.String("match_id", recording.MatchId),
+			zap.Int("part", recording.Part),
+			zap.Error(err),
+		)
+	}
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/yelaco/ludofy/internal/domains/dtos"
+	"github.com/yelaco/ludofy/internal/domains/entities"
+	"github.com/yelaco/ludofy/pkg/utils"
+)
+
+// ReplayResult is the final state of a replayed match with the saves, end and
+// abort it produced
+type ReplayResult struct {
+	Match   Match
+	Saves   []dtos.MatchStateRequest
+	End     *MatchRecordRequest
+	Aborted bool
+}
+
+// Replay feeds a recording into a fresh match created by the server handler of
+// the config, using its router if set. The match is driven by a MatchDriver
+// whose clock is set to the time of each event. Timers of the match are
+// ignored, only the recorded ones fire. The config clock is used if it is a
+// FakeClock, which the server handler should then also use, otherwise a fake
+// clock starts at the load event. Matches in tick mode can't be replayed
+func Replay(cfg Config, recording Recording) (*ReplayResult, error) {
+	if len(recording.Events) == 0 || recording.Events[0].Type != RecordLoad {
+		return nil, fmt.Errorf("%w: load event missing", ErrInvalidRecording)
+	}
+	var load recordedLoad
+	if err := json.Unmarshal(recording.Events[0].Data, &load); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidRecording, err)
+	}
+	var matchState *entities.MatchState
+	if load.MatchState != nil {
+		state := load.MatchState.toEntity()
+		matchState = &state
+	}
+
+	clock, ok := cfg.Clock.(*utils.FakeClock)
+	if !ok {
+		clock = utils.NewFakeClock(recording.Events[0].At)
+	}
+	clock.Set(recording.Events[0].At)
+	var snapshot *MatchSnapshot
+	if load.Snapshot != nil {
+		snapshot = &MatchSnapshot{
+			MatchId: load.ActiveMatch.MatchId,
+			Data:    load.Snapshot,
+			Pause:   load.Pause,
+		}
+	}
+	driver, err := newMatchDriver(cfg, load.ActiveMatch, matchState, snapshot, clock, true)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, event := range recording.Events[1:] {
+		driver.SetTime(event.At)
+		switch event.Type {
+		case RecordJoin:
+			err = driver.Join(event.PlayerId, nil)
+		case RecordLeave:
+			err = driver.Leave(event.PlayerId)
+		case RecordMessage:
+			msg := []byte(event.Data)
+			if event.Raw != nil {
+				msg = event.Raw
+			}
+			err = driver.Send(event.PlayerId, msg)
+		case RecordTimer:
+			driver.FireTimer(event.Name)
+		case RecordRtt:
+			var sample time.Duration
+			if err = json.Unmarshal(event.Data, &sample); err != nil {
+				err = fmt.Errorf("%w: %w", ErrInvalidRecording, err)
+				break
+			}
+			err = driver.ReportRtt(event.PlayerId, sample)
+		case RecordEnd:
+			if driver.End == nil {
+				err = fmt.Errorf("%w: match not ended", ErrReplayDiverged)
+			}
+		case RecordAbort:
+			if !driver.Aborted {
+				err = fmt.Errorf("%w: match not aborted", ErrReplayDiverged)
+			}
+		default:
+			err = fmt.Errorf("%w: unknown event %s", ErrInvalidRecording, event.Type)
+		}
+		if err != nil {
+			break
+		}
+	}
+	return &ReplayResult{
+		Match:   driver.Match(),
+		Saves:   driver.Saves,
+		End:     driver.End,
+		Aborted: driver.Aborted,
+	}, err
+}
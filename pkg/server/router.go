@@ -0,0 +1,109 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/yelaco/ludofy/pkg/logging"
+	"go.uber.org/zap"
+)
+
+// Message is the envelope of typed messages sent by clients
+type Message[T any] struct {
+	Type      string    `json:"type"`
+	Data      T         `json:"data"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Validator can be implemented by message payloads to reject invalid data
+type Validator interface {
+	Validate() error
+}
+
+type RawMessageHandler func(playerId string, match MatchHandler, message []byte) error
+
+type route func(playerId string, match MatchHandler, message []byte) error
+
+// Router dispatches messages to handlers registered by message type. Messages
+// of unregistered types go to the fallback, or are rejected when there is none
+type Router struct {
+	routes   map[string]route
+	fallback RawMessageHandler
+}
+
+func NewRouter() *Router {
+	return &Router{
+		routes: make(map[string]route),
+	}
+}
+
+// SetFallback method    sets the raw handler for unregistered message types.
+// The fallback can return ErrUnknownMessageType to reject the message
+func (r *Router) SetFallback(fallback RawMessageHandler) {
+	r.fallback = fallback
+}
+
+// Handle registers the handler for the message type, the message data is decoded into T
+func Handle[T any](
+	router *Router,
+	msgType string,
+	handler func(playerId string, match MatchHandler, msg Message[T]) error,
+) {
+	router.routes[msgType] = func(playerId string, match MatchHandler, message []byte) error {
+		var msg Message[T]
+		if err := json.Unmarshal(message, &msg); err != nil {
+			return fmt.Errorf("%w: %w", errMalformedPayload, err)
+		}
+		if validator, ok := any(&msg.Data).(Validator); ok {
+			if err := validator.Validate(); err != nil {
+				return fmt.Errorf("%w: %w", errInvalidPayload, err)
+			}
+		}
+		return handler(playerId, match, msg)
+	}
+}
+
+// Route method    dispatches the message and replies with an error response
+// when it is malformed, invalid or of an unknown type
+func (r *Router) Route(playerId string, match MatchHandler, message []byte) error {
+	var envelope struct {
+		Type string `json:"type"`
+	}
+	var err error
+	if err = json.Unmarshal(message, &envelope); err != nil {
+		err = fmt.Errorf("%w: %w", errMalformedPayload, err)
+	} else if route, exist := r.routes[envelope.Type]; exist {
+		err = route(playerId, match, message)
+	} else if r.fallback != nil {
+		err = r.fallback(playerId, match, message)
+	} else {
+		err = fmt.Errorf("%w: %s", ErrUnknownMessageType, envelope.Type)
+	}
+
+	var status string
+	switch {
+	case errors.Is(err, errMalformedPayload):
+		status = ErrStatusMalformedPayload
+	case errors.Is(err, errInvalidPayload):
+		status = ErrStatusInvalidPayload
+	case errors.Is(err, ErrUnknownMessageType):
+		status = ErrStatusUnknownMessageType
+	default:
+		return err
+	}
+
+	logging.Info("message rejected",
+		zap.String("player_id", playerId),
+		zap.String("status", status),
+		zap.Error(err),
+	)
+	if player, exist := match.GetMatch().GetPlayerWithId(playerId); exist {
+		player.WriteJson(errorResponse{
+			Type:  "error",
+			Error: status,
+		})
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type addRequest struct {
+	N int `json:"n"`
+}
+
+func (r *addRequest) Validate() error {
+	if r.N <= 0 {
+		return errors.New("n must be positive")
+	}
+	return nil
+}
+
+func newTestRouter(fallback RawMessageHandler) *Router {
+	router := NewRouter()
+	Handle(router, "add", func(playerId string, match MatchHandler, msg Message[addRequest]) error {
+		match.GetMatch().ProcessMove(testMove{playerId: playerId, n: msg.Data.N})
+		return nil
+	})
+	if fallback != nil {
+		router.SetFallback(fallback)
+	}
+	return router
+}
+
+func TestRouterDispatch(t *testing.T) {
+	d := newTestDriver(t, Config{Router: newTestRouter(nil)}, "a", "b")
+
+	d.send(t, "a", `{"type":"add","data":{"n":2}}`)
+	if d.total() != 2 {
+		t.Fatalf("total %d, want the add message routed to its handler", d.total())
+	}
+
+	d.send(t, "a", `{"type":"add","data":{"n":-1}}`)
+	d.send(t, "a", `{"type":"add","data":{"n":"two"}}`)
+	d.send(t, "a", `{"type":"jump"}`)
+	d.send(t, "a", `not json`)
+	want := []string{
+		ErrStatusInvalidPayload,
+		ErrStatusMalformedPayload,
+		ErrStatusUnknownMessageType,
+		ErrStatusMalformedPayload,
+	}
+	if got := d.errors("a"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("errors %v, want %v", got, want)
+	}
+	if d.total() != 2 || len(d.errors("b")) != 0 {
+		t.Fatal("rejected messages reached the match or the other player")
+	}
+}
+
+func TestRouterFallback(t *testing.T) {
+	var fallback []string
+	router := newTestRouter(func(playerId string, match MatchHandler, message []byte) error {
+		fallback = append(fallback, string(message))
+		if string(message) == `{"type":"unknown"}` {
+			return ErrUnknownMessageType
+		}
+		return nil
+	})
+	d := newTestDriver(t, Config{Router: router}, "a")
+
+	d.send(t, "a", `{"type":"legacy"}`)
+	d.send(t, "a", `{"type":"unknown"}`)
+	if len(fallback) != 2 {
+		t.Fatalf("fallback got %v, want both unregistered messages", fallback)
+	}
+	if got := d.errors("a"); !reflect.DeepEqual(got, []string{ErrStatusUnknownMessageType}) {
+		t.Fatalf("errors %v, want only the message the fallback rejected", got)
+	}
+}
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/spf13/viper"
+	"github.com/yelaco/ludofy/pkg/logging"
+	"go.uber.org/zap"
+)
+
+// tlsConfig serves the websockets over wss with the certificate of
+// TLS_CERT_FILE and TLS_KEY_FILE, or the one stored in the Secrets Manager
+// secret TLS_CERT_SECRET_ID. With TLS_CLIENT_CA_FILE the admin API requires a
+// client certificate signed by the CA, and so do the status endpoints
+type tlsConfig struct {
+	certFile    string
+	keyFile     string
+	certificate *tls.Certificate
+	clientCAs   *x509.CertPool
+}
+
+// certificateSecret is the Secrets Manager secret holding the certificate
+type certificateSecret struct {
+	Certificate string `json:"certificate"`
+	PrivateKey  string `json:"privateKey"`
+}
+
+func newTlsConfig() tlsConfig {
+	cfg := tlsConfig{
+		certFile: viper.GetString("TLS_CERT_FILE"),
+		keyFile:  viper.GetString("TLS_KEY_FILE"),
+	}
+	if (cfg.certFile == "") != (cfg.keyFile == "") {
+		logging.Fatal("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	if caFile := viper.GetString("TLS_CLIENT_CA_FILE"); caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			logging.Fatal("failed to read client CA", zap.Error(err))
+		}
+		cfg.clientCAs = x509.NewCertPool()
+		if !cfg.clientCAs.AppendCertsFromPEM(pem) {
+			logging.Fatal("no certificate found in client CA", zap.String("file", caFile))
+		}
+	}
+	return cfg
+}
+
+// loadSecretCertificate method    loads the certificate stored in Secrets
+// Manager as {"certificate":"<PEM chain>","privateKey":"<PEM>"}
+func (c *tlsConfig) loadSecretCertificate(awsCfg aws.Config, secretId string) error {
+	output, err := secretsmanager.NewFromConfig(awsCfg).GetSecretValue(
+		context.Background(),
+		&secretsmanager.GetSecretValueInput{
+			SecretId: aws.String(secretId),
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to get certificate secret: %w", err)
+	}
+	var secret certificateSecret
+	if err := json.Unmarshal([]byte(aws.ToString(output.SecretString)), &secret); err != nil {
+		return fmt.Errorf("failed to unmarshal certificate secret: %w", err)
+	}
+	certificate, err := tls.X509KeyPair([]byte(secret.Certificate), []byte(secret.PrivateKey))
+	if err != nil {
+		return fmt.Errorf("invalid certificate secret: %w", err)
+	}
+	c.certificate = &certificate
+	return nil
+}
+
+func (c tlsConfig) enabled() bool {
+	return c.certificate != nil || c.certFile != ""
+}
+
+// serverConfig method    returns the TLS config of a listener, nil to serve
+// plain HTTP. Client certificates are checked with clientAuth when a client
+// CA is configured
+func (c tlsConfig) serverConfig(clientAuth tls.ClientAuthType) *tls.Config {
+	if !c.enabled() {
+		return nil
+	}
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if c.certificate != nil {
+		cfg.Certificates = []tls.Certificate{*c.certificate}
+	}
+	if c.clientCAs != nil {
+		cfg.ClientCAs = c.clientCAs
+		cfg.ClientAuth = clientAuth
+	}
+	return cfg
+}
+
+// listen method    serves the listener over TLS when the server has a
+// certificate
+func (s *DefaultServer) listen(server *http.Server) error {
+	if server.TLSConfig == nil {
+		return server.ListenAndServe()
+	}
+	return server.ListenAndServeTLS(s.cfg.tls.certFile, s.cfg.tls.keyFile)
+}
+
+// requireClientCert method    refuses the requests without a verified client
+// certificate when a client CA is configured
+func (s *DefaultServer) requireClientCert(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.cfg.tls.clientCAs != nil && (r.TLS == nil || len(r.TLS.VerifiedChains) == 0) {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte("client certificate required"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// checkOrigin method    accepts the browsers of ALLOWED_ORIGINS, every origin
+// when it isn't set. Entries like https://*.example.com match the subdomains.
+// Requests without an Origin, from native clients, are accepted
+func (s *DefaultServer) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if len(s.cfg.allowedOrigins) == 0 || origin == "" {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	for _, allowed := range s.cfg.allowedOrigins {
+		if origin == allowed {
+			return true
+		}
+		scheme, domain, wildcard := strings.Cut(allowed, "*.")
+		if wildcard && len(origin) > len(scheme)+len(domain)+1 &&
+			strings.HasPrefix(origin, scheme) &&
+			strings.HasSuffix(origin, "."+domain) {
+			return true
+		}
+	}
+	logging.Info("origin not allowed", zap.String("origin", origin))
+	return false
+}
+
+// allowedOrigins returns the comma separated origins of ALLOWED_ORIGINS in
+// lower case
+func allowedOrigins() []string {
+	var origins []string
+	for _, origin := range strings.Split(viper.GetString("ALLOWED_ORIGINS"), ",") {
+		if origin = strings.ToLower(strings.TrimSpace(origin)); origin != "" {
+			origins = append(origins, strings.TrimSuffix(origin, "/"))
+		}
+	}
+	return origins
+}
@@ -1,28 +1,23 @@
 package server
 
 import (
-	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
-	"log"
+	"net"
 	"net/http"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
-	"github.com/aws/aws-sdk-go-v2/service/ecs"
-	"github.com/aws/aws-sdk-go-v2/service/lambda"
-	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/gorilla/websocket"
-	"github.com/yelaco/ludofy/internal/aws/auth"
-	"github.com/yelaco/ludofy/internal/aws/compute"
-	"github.com/yelaco/ludofy/internal/aws/storage"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/yelaco/ludofy/internal/domains/dtos"
+	"github.com/yelaco/ludofy/internal/domains/entities"
 	"github.com/yelaco/ludofy/pkg/logging"
 	"github.com/yelaco/ludofy/pkg/utils"
 	"go.uber.org/zap"
@@ -34,42 +29,68 @@ func NewFromConfig(cfg Config) Server {
 		upgrader: websocket.Upgrader{
 			ReadBufferSize:  1024,
 			WriteBufferSize: 1024,
-			CheckOrigin: func(r *http.Request) bool {
-				return true
+			Subprotocols: []string{
+				SubprotocolMsgpack,
+				SubprotocolProtobuf,
+				SubprotocolJson,
 			},
 		},
 		mu:      new(sync.Mutex),
 		cfg:     cfg,
 		handler: cfg.ServerHandler,
 	}
-	storageClient = storage.NewClient(
-		dynamodb.NewFromConfig(cfg.awsCfg),
-	)
-	computeClient = compute.NewClient(
-		ecs.NewFromConfig(cfg.awsCfg),
-		nil,
-		nil,
-	)
-	lambdaClient = lambda.NewFromConfig(cfg.awsCfg)
+	srv.upgrader.CheckOrigin = srv.checkOrigin
+	srv.store = cfg.MatchStore
+	if srv.store == nil {
+		srv.store = newAwsMatchStore(cfg)
+	}
+	srv.sink = cfg.MatchSink
+	if srv.sink == nil {
+		srv.sink = newAwsMatchSink(cfg)
+	}
+	srv.protection = cfg.ProtectionController
+	if srv.protection == nil {
+		srv.protection = newAwsProtectionController(cfg)
+	}
+	srv.spool = newEventSpool(cfg.spoolDir, cfg.spoolOwner, srv.sink, cfg.clock(), cfg.spoolRetryBackoff, cfg.spoolMaxAge)
+	srv.recordings = cfg.RecordingSink
+	srv.snapshots = cfg.SnapshotStore
+	if srv.snapshots != nil && cfg.Address == "" {
+		logging.Fatal("a snapshot store requires the server address")
+	}
 
+	srv.registerMetrics()
 	srv.resetProtectionTimer(cfg.protectionTimeout)
 	return srv
 }
 
 // Start method    starts the game server
 func (s *DefaultServer) Start() error {
+	// Events of matches which ended before the last shutdown
+	s.spool.replay()
+
 	// Server status
-	http.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+	http.Handle("/status", s.requireClientCert(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		count := s.totalMatches.Load()
+		draining := s.draining.Load()
 		json.NewEncoder(w).Encode(map[string]any{
 			"activeMatches": count,
 			"maxMatches":    s.cfg.maxMatches,
-			"canAccept":     count < s.cfg.maxMatches,
+			"canAccept":     !s.atCapacity() && !draining,
+			"softLimit":     s.atSoftLimit(),
+			"draining":      draining,
 		})
-	})
+	})))
+
+	http.Handle("/metrics", s.requireClientCert(promhttp.Handler()))
 
 	// Websocket
 	http.HandleFunc("/game/{matchId}", func(w http.ResponseWriter, r *http.Request) {
+		if s.draining.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("server draining"))
+			return
+		}
 		playerId, err := s.auth(r)
 		if err != nil {
 			w.WriteHeader(http.StatusUnauthorized)
@@ -87,27 +108,68 @@ func (s *DefaultServer) Start() error {
 			return
 		}
 		defer conn.Close()
+		s.connections.Add(1)
+		defer s.connections.Done()
 
 		matchId := r.PathValue("matchId")
 		match, err := s.loadMatch(matchId)
 		if err != nil {
 			logging.Info("failed to load match", zap.String("error", err.Error()))
+			closeCode, reason := websocket.CloseNormalClosure, "match failed to load"
+			if errors.Is(err, ErrServerFull) {
+				closeCode, reason = CloseServerFull, "server full, restore the match"
+			}
+			if errors.Is(err, ErrMatchMigrated) {
+				closeCode, reason = websocket.CloseServiceRestart, "server migrating"
+			}
+			if errors.Is(err, ErrSnapshotUnavailable) {
+				closeCode, reason = websocket.CloseTryAgainLater, "match snapshot unavailable, retry"
+			}
 			conn.WriteControl(
 				websocket.CloseMessage,
-				websocket.FormatCloseMessage(
-					websocket.CloseNormalClosure,
-					"match failed to load",
-				),
+				websocket.FormatCloseMessage(closeCode, reason),
 				time.Now().Add(5*time.Second),
 			)
 			return
 		}
-		match.playerJoin(playerId, conn)
+		var lastSeq *uint64
+		if v := r.URL.Query().Get("lastSeq"); v != "" {
+			seq, err := strconv.ParseUint(v, 10, 64)
+			if err == nil {
+				lastSeq = &seq
+			}
+		}
+		match.playerJoin(playerId, conn, lastSeq)
+
+		player, _ := match.GetPlayerWithId(playerId)
+		stopKeepAlive := s.keepAlive(conn, func(sample time.Duration) {
+			match.playerRtt(playerId, sample)
+		})
+		defer stopKeepAlive()
+
+		if s.cfg.rateLimit.maxMessageSize > 0 {
+			conn.SetReadLimit(s.cfg.rateLimit.maxMessageSize)
+		}
+		limiter := s.rateLimiterFor(matchId, playerId)
 
 		for {
 			_, message, err := conn.ReadMessage()
 			if err != nil {
-				if websocket.IsCloseError(
+				var netErr net.Error
+				if errors.Is(err, websocket.ErrReadLimit) {
+					logging.Info(
+						"message size limit exceeded",
+						zap.String("remote_address", conn.RemoteAddr().String()),
+						zap.String("player_id", playerId),
+						zap.Int64("max_message_size", s.cfg.rateLimit.maxMessageSize),
+					)
+				} else if errors.As(err, &netErr) && netErr.Timeout() {
+					logging.Info(
+						"connection timed out",
+						zap.String("remote_address", conn.RemoteAddr().String()),
+						zap.String("player_id", playerId),
+					)
+				} else if websocket.IsCloseError(
 					err,
 					websocket.CloseNormalClosure,
 				) {
@@ -128,27 +190,194 @@ func (s *DefaultServer) Start() error {
 				match.playerDisconnect(playerId)
 				break
 			}
+			s.extendReadDeadline(conn)
+			messagesReceived.Inc()
+
+			if action, violations := limiter.check(); action != rateLimitAllow {
+				logging.Info("rate limit exceeded",
+					zap.String("match_id", matchId),
+					zap.String("player_id", playerId),
+					zap.Int("violations", violations),
+					zap.String("action", action.String()),
+				)
+				if action == rateLimitWarn || action == rateLimitShed {
+					player.WriteJson(errorResponse{
+						Type:  "error",
+						Error: ErrStatusRateLimited,
+					})
+				}
+				if action == rateLimitDisconnect {
+					conn.WriteControl(
+						websocket.CloseMessage,
+						websocket.FormatCloseMessage(
+							websocket.ClosePolicyViolation,
+							"rate limit exceeded",
+						),
+						time.Now().Add(writeWait),
+					)
+					match.playerDisconnect(playerId)
+					break
+				}
+				if action != rateLimitWarn {
+					continue
+				}
+			}
+
+			message, err = codecOf(conn).toJson(message)
+			if err != nil {
+				logging.Info("failed to decode message",
+					zap.String("player_id", playerId),
+					zap.String("subprotocol", conn.Subprotocol()),
+					zap.Error(err),
+				)
+				player.WriteJson(errorResponse{
+					Type:  "error",
+					Error: ErrStatusMalformedPayload,
+				})
+				continue
+			}
 
 			err = s.HandleMessage(playerId, match, message)
 			if err != nil {
 				logging.Error("failed to handle message", zap.Error(err))
 				conn.WriteControl(
-					websocket.CloseNormalClosure,
-					nil,
-					time.Now().Add(5*time.Second),
+					websocket.CloseMessage,
+					websocket.FormatCloseMessage(
+						websocket.CloseNormalClosure,
+						"failed to handle message",
+					),
+					time.Now().Add(writeWait),
 				)
 			}
 		}
 	})
-	logging.Info("websocket server started", zap.String("port", s.cfg.Port))
-	return http.ListenAndServe(s.address, nil)
+
+	// Spectator websocket
+	http.HandleFunc("/spectate/{matchId}", func(w http.ResponseWriter, r *http.Request) {
+		if s.draining.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("server draining"))
+			return
+		}
+		spectatorId, err := s.auth(r)
+		if err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(err.Error()))
+			logging.Error("failed to auth: %w", zap.Error(err))
+			return
+		}
+
+		conn, err := s.upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			logging.Error(
+				"failed to upgrade connection",
+				zap.String("error", err.Error()),
+			)
+			return
+		}
+		defer conn.Close()
+		s.connections.Add(1)
+		defer s.connections.Done()
+
+		if s.cfg.rateLimit.maxMessageSize > 0 {
+			conn.SetReadLimit(s.cfg.rateLimit.maxMessageSize)
+		}
+
+		matchId := r.PathValue("matchId")
+		match, err := s.getMatch(matchId)
+		if err == nil {
+			spectator := newDefaultSpectator(spectatorId, conn)
+			err = match.spectatorJoin(spectator, s.cfg.maxSpectators)
+			if err == nil {
+				stopKeepAlive := s.keepAlive(conn, nil)
+				// Spectators are read-only, incoming messages are discarded
+				for {
+					if _, _, err := conn.ReadMessage(); err != nil {
+						break
+					}
+					s.extendReadDeadline(conn)
+				}
+				stopKeepAlive()
+				match.spectatorLeave(spectator)
+				spectator.stop()
+				return
+			}
+		}
+		logging.Info("failed to spectate match",
+			zap.String("match_id", matchId),
+			zap.Error(err),
+		)
+		closeCode := websocket.CloseNormalClosure
+		if errors.Is(err, ErrSpectatorsFull) {
+			closeCode = websocket.CloseTryAgainLater
+		}
+		conn.WriteControl(
+			websocket.CloseMessage,
+			websocket.FormatCloseMessage(closeCode, err.Error()),
+			time.Now().Add(5*time.Second),
+		)
+	})
+
+	// Players have no client certificate, only the status endpoints check it
+	httpServer := &http.Server{
+		Addr:      s.address,
+		TLSConfig: s.cfg.tls.serverConfig(tls.VerifyClientCertIfGiven),
+	}
+	servers := []*http.Server{httpServer}
+	if s.cfg.adminPort != "" {
+		adminServer := s.newAdminServer()
+		servers = append(servers, adminServer)
+		go func() {
+			logging.Info("admin server started", zap.String("port", s.cfg.adminPort))
+			err := s.listen(adminServer)
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logging.Error("admin server stopped", zap.Error(err))
+			}
+		}()
+	}
+	if s.cfg.mode == ModeLocal {
+		localServer := s.newLocalServer()
+		servers = append(servers, localServer)
+		go func() {
+			logging.Info("local api started", zap.String("address", s.cfg.localApiAddr))
+			err := localServer.ListenAndServe()
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logging.Error("local api stopped", zap.Error(err))
+			}
+		}()
+	}
+	shutdownDone := make(chan struct{})
+	go s.handleShutdown(servers, shutdownDone)
+
+	logging.Info("websocket server started",
+		zap.String("port", s.cfg.Port),
+		zap.Bool("tls", httpServer.TLSConfig != nil),
+	)
+	err := s.listen(httpServer)
+	if errors.Is(err, http.ErrServerClosed) {
+		<-shutdownDone
+		logging.Info("websocket server stopped")
+		return nil
+	}
+	return err
 }
 
 func (s *DefaultServer) HandleMessage(playerId string, match Match, msg []byte) error {
 	if match == nil {
 		return fmt.Errorf("match not loaded")
 	}
-	err := s.handler.OnHandleMessage(playerId, match.GetHandler(), msg)
+	// The message is recorded once the match goroutine handles it
+	match.beginMessage(playerId, msg)
+	defer match.endMessage(playerId)
+	if match.handleChat(playerId, msg) || match.handlePause(playerId, msg) {
+		return nil
+	}
+	var err error
+	if s.cfg.Router != nil {
+		err = s.cfg.Router.Route(playerId, match.GetHandler(), msg)
+	} else {
+		err = s.handler.OnHandleMessage(playerId, match.GetHandler(), msg)
+	}
 	if err != nil {
 		return fmt.Errorf("on handle message: %w", err)
 	}
@@ -161,97 +390,67 @@ func (s *DefaultServer) HandleMatchEnd(match Match) {
 	}
 	matchRecordReq := MatchRecordRequest{
 		MatchId: match.GetId(),
-		EndedAt: time.Now(),
+		EndedAt: match.Now(),
+		Chat:    match.getChatLog(),
+		Bots:    matchBots(match),
+		Teams:   matchTeamRecords(match),
 	}
 
+	// The record is published even when the handler fails, so that the
+	// players aren't left in the match
 	if err := s.handler.OnHandleMatchEnd(&matchRecordReq, match.GetHandler()); err != nil {
-		logging.Fatal("failed to hanlde match end", zap.Error(err))
-	}
-
-	payload, err := json.Marshal(matchRecordReq)
-	if err != nil {
-		logging.Fatal("failed to marshal match record request", zap.Error(err))
+		logging.Error("failed to handle match end",
+			zap.String("match_id", match.GetId()),
+			zap.Error(err),
+		)
 	}
 
-	// Invoke Lambda function
-	_, err = lambdaClient.Invoke(context.TODO(), &lambda.InvokeInput{
-		FunctionName:   aws.String(s.cfg.endGameFunctionArn),
-		Payload:        payload,
-		InvocationType: types.InvocationTypeEvent,
-	})
-	if err != nil {
-		logging.Error("failed to invoke end game", zap.Error(err))
-	}
+	// The final save keeps retrying in the background, the event is only
+	// published after it so it can't be overwritten by the save
+	matchEvents.WithLabelValues("end").Inc()
+	s.spool.publish(spoolEvent{
+		Type:    spoolEnd,
+		MatchId: match.GetId(),
+		Record:  &matchRecordReq,
+	}, s.savesDone(match.GetId()))
 
+	s.saveRecording(match)
 	s.removeMatch(match.GetId())
 	logging.Info("match ended", zap.String("match_id", match.GetId()))
 }
 
 func (s *DefaultServer) HandleMatchSave(match Match) {
-	ctx := context.Background()
 	matchStateReq := dtos.MatchStateRequest{
 		Id:        utils.GenerateUUID(),
 		MatchId:   match.GetId(),
-		Timestamp: time.Now(),
+		Pause:     match.getPauseState(),
+		Timestamp: match.Now(),
 	}
 	s.handler.OnHandleMatchSave(&matchStateReq, match.GetHandler())
-
-	matchStateAppSyncReq := dtos.NewMatchStateAppSyncRequest(matchStateReq)
-	payload, err := json.Marshal(matchStateAppSyncReq)
-	if err != nil {
-		logging.Error("Failed to save game", zap.Error(err))
+	if !projectSave(match, &matchStateReq) {
+		logging.Info("match save withheld", zap.String("match_id", match.GetId()))
 		return
 	}
 
-	req, err := http.NewRequest(
-		"POST",
-		s.cfg.appSyncHttpUrl,
-		bytes.NewReader(payload),
-	)
-	if err != nil {
-		logging.Error("Failed to save game", zap.Error(err))
-		return
-	}
-	req.Header.Set("Content-Type", "application/json")
+	matchEvents.WithLabelValues("save").Inc()
+	s.saverFor(match.GetId()).enqueue(matchStateReq)
+}
 
-	// Sign the request
-	signer := v4.NewSigner()
-	credentials, err := s.cfg.appsyncCfg.Credentials.Retrieve(ctx)
-	if err != nil {
-		logging.Error("Failed to save game", zap.Error(err))
+func (s *DefaultServer) HandleMatchStart(match Match) {
+	if match == nil {
 		return
 	}
-	err = signer.SignHTTP(
-		ctx,
-		credentials,
-		req,
-		sha256Hash(payload),
-		"appsync",
-		s.cfg.awsCfg.Region,
-		time.Now(),
+	matchEvents.WithLabelValues("start").Inc()
+	err := s.store.UpdateActiveMatch(
+		context.Background(),
+		match.GetId(),
+		ActiveMatchUpdate{
+			StartedAt: aws.Time(match.Now()),
+		},
 	)
 	if err != nil {
-		logging.Error("Failed to save game", zap.Error(err))
-		return
-	}
-
-	client := new(http.Client)
-	response, err := client.Do(req)
-	if err != nil {
-		logging.Error("Failed to save game", zap.Error(err))
-		return
-	}
-
-	if response.StatusCode != http.StatusOK {
-		body, err := io.ReadAll(response.Body)
-		if err != nil {
-			logging.Error("Failed to read response body", zap.Error(err))
-			return
-		}
-		logging.Error("Failed to save game",
-			zap.String("body", string(body)),
-			zap.Error(fmt.Errorf("200 expected")),
-		)
+		backendFailures.WithLabelValues("start").Inc()
+		logging.Error("failed to update match", zap.Error(err))
 	}
 }
 
@@ -259,30 +458,24 @@ func (s *DefaultServer) HandleMatchAbort(match Match) {
 	if match == nil {
 		return
 	}
-	ctx := context.TODO()
-
 	matchAbortReq := dtos.MatchAbortRequest{
 		MatchId:   match.GetId(),
 		PlayerIds: make([]string, 0, len(match.GetPlayers())),
 	}
-
-	payload, err := json.Marshal(matchAbortReq)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	// Invoke Lambda function
-	input := &lambda.InvokeInput{
-		FunctionName:   aws.String(s.cfg.abortGameFunctionArn),
-		Payload:        payload,
-		InvocationType: types.InvocationTypeEvent,
+	for playerId := range match.GetPlayers() {
+		matchAbortReq.PlayerIds = append(matchAbortReq.PlayerIds, playerId)
 	}
 
-	_, err = lambdaClient.Invoke(ctx, input)
-	if err != nil {
-		logging.Fatal("failed to invoke abort game", zap.Error(err))
-	}
+	// The final save keeps retrying in the background, the event is only
+	// published after it so it can't be overwritten by the save
+	matchEvents.WithLabelValues("abort").Inc()
+	s.spool.publish(spoolEvent{
+		Type:    spoolAbort,
+		MatchId: match.GetId(),
+		Abort:   &matchAbortReq,
+	}, s.savesDone(match.GetId()))
 
+	s.saveRecording(match)
 	s.removeMatch(match.GetId())
 	logging.Info("match aborted", zap.String("match_id", match.GetId()))
 }
@@ -293,7 +486,7 @@ func (s *DefaultServer) auth(r *http.Request) (string, error) {
 	if token == "" {
 		return "", fmt.Errorf("no authorization")
 	}
-	validToken, err := auth.ValidateJwt(token, s.cfg.cognitoPublicKeys)
+	validToken, err := s.cfg.validateToken(token)
 	if err != nil || !validToken.Valid {
 		return "", fmt.Errorf("invalid token: %w", err)
 	}
@@ -315,7 +508,7 @@ func (s *DefaultServer) auth(r *http.Request) (string, error) {
 func (s *DefaultServer) loadMatch(matchId string) (Match, error) {
 	ctx := context.Background()
 
-	activeMatch, err := storageClient.GetActiveMatch(ctx, matchId)
+	activeMatch, err := s.store.GetActiveMatch(ctx, matchId)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get active match: %w", err)
 	}
@@ -332,30 +525,71 @@ func (s *DefaultServer) loadMatch(matchId string) (Match, error) {
 		}
 		return nil, ErrFailedToLoadMatch
 	} else {
-		matchStates, _, err := storageClient.FetchMatchStates(
-			ctx,
-			matchId,
-			nil,
-			1,
-			false,
-		)
+		// Matches handed over by another server restore from their snapshot,
+		// it is checked first so a match on its way to another server doesn't
+		// get its server cleared by a full one
+		snapshot, err := s.getSnapshot(ctx, matchId)
 		if err != nil {
-			return nil, fmt.Errorf("failed to fetch match states: %w", err)
+			return nil, err
+		}
+		if s.atCapacity() {
+			s.rejectMatch(ctx, matchId)
+			return nil, ErrServerFull
 		}
 
 		var match Match
-		if len(matchStates) > 0 {
-			match, err = s.handler.OnMatchResume(activeMatch, matchStates[0])
+		var matchState *entities.MatchState
+		if snapshot != nil {
+			match, err = s.restoreMatch(activeMatch, *snapshot)
 			if err != nil {
-				return nil, fmt.Errorf("failed to resume match: %w", err)
+				logging.Error("failed to restore match, resuming from latest state",
+					zap.String("match_id", matchId),
+					zap.Error(err),
+				)
+				match, snapshot = nil, nil
 			}
-		} else {
-			match, err = s.handler.OnMatchCreate(activeMatch)
+		}
+
+		if match == nil {
+			matchState, err = s.store.GetLatestMatchState(ctx, matchId)
 			if err != nil {
-				return nil, fmt.Errorf("failed to create match: %w", err)
+				return nil, fmt.Errorf("failed to fetch match states: %w", err)
+			}
+			if matchState != nil {
+				match, err = s.handler.OnMatchResume(activeMatch, *matchState)
+				if err != nil {
+					return nil, fmt.Errorf("failed to resume match: %w", err)
+				}
+			} else {
+				match, err = s.handler.OnMatchCreate(activeMatch)
+				if err != nil {
+					return nil, fmt.Errorf("failed to create match: %w", err)
+				}
 			}
 		}
 
+		match.setClock(s.cfg.clock())
+		match.setLoadedAt(match.Now())
+		if snapshot != nil {
+			match.restorePause(snapshot.Pause)
+		} else if matchState != nil {
+			match.restorePause(matchState.Pause)
+		}
+		assignTeams(match, activeMatch)
+		if s.cfg.outboxSize > 0 {
+			match.enableSequencing(s.cfg.outboxSize)
+		}
+		if s.recordings != nil {
+			load, err := newRecordedLoad(activeMatch, matchState, snapshot)
+			if err != nil {
+				return nil, fmt.Errorf("failed to record match: %w", err)
+			}
+			match.setRecorder(newRecorder(matchId, s.cfg.recordingMaxBytes, func(part Recording) {
+				go s.saveRecordingPart(part)
+			}))
+			match.record(RecordLoad, "", "", load)
+		}
+		match.setStartCallback(s.HandleMatchStart)
 		match.setSaveCallback(s.HandleMatchSave)
 		match.setEndCallback(s.HandleMatchEnd)
 		match.setAbortCallback(s.HandleMatchAbort)
@@ -363,14 +597,41 @@ func (s *DefaultServer) loadMatch(matchId string) (Match, error) {
 		s.totalMatches.Add(1)
 		s.resetProtectionTimer(45 * time.Minute)
 
+		if snapshot != nil {
+			if err := s.snapshots.DeleteMatchSnapshot(ctx, matchId); err != nil {
+				backendFailures.WithLabelValues("snapshot").Inc()
+				logging.Error("failed to delete match snapshot",
+					zap.String("match_id", matchId),
+					zap.Error(err),
+				)
+			}
+			logging.Info("match restored from snapshot", zap.String("match_id", matchId))
+		}
+
 		go match.start()
+		s.joinBots(match)
 		logging.Info("match loaded", zap.String("match_id", matchId))
 		return match, nil
 	}
 }
 
+// getMatch method    returns a match already loaded on this server
+func (s *DefaultServer) getMatch(matchId string) (Match, error) {
+	value, loaded := s.matches.Load(matchId)
+	if !loaded {
+		return nil, ErrMatchNotFound
+	}
+	match, ok := value.(Match)
+	if !ok {
+		return nil, ErrFailedToLoadMatch
+	}
+	return match, nil
+}
+
 func (s *DefaultServer) removeMatch(matchId string) {
 	s.matches.Delete(matchId)
+	s.matchLimits.Delete(matchId)
+	s.savers.Delete(matchId)
 	total := s.totalMatches.Add(-1)
 	if total <= 0 {
 		s.skipProtectionTimer()
@@ -379,6 +640,8 @@ func (s *DefaultServer) removeMatch(matchId string) {
 }
 
 func (s *DefaultServer) skipProtectionTimer() {
+	s.protectionMu.Lock()
+	defer s.protectionMu.Unlock()
 	if s.protectionTimer == nil {
 		return
 	}
@@ -386,25 +649,48 @@ func (s *DefaultServer) skipProtectionTimer() {
 	logging.Info("server protection timer skipped")
 }
 
+// protectionRemaining method    returns the time left on the protection
+// timer, 0 when it isn't running
+func (s *DefaultServer) protectionRemaining() time.Duration {
+	s.protectionMu.Lock()
+	defer s.protectionMu.Unlock()
+	if s.protectionTimer == nil {
+		return 0
+	}
+	return s.protectionTimer.TimeRemaining()
+}
+
 func (s *DefaultServer) enableProtection() {
-	err := computeClient.UpdateServerProtection(context.TODO(), true)
-	if err != nil {
+	if err := s.setProtection(true); err != nil {
 		logging.Info("failed to enable server protection", zap.Error(err))
-		return
 	}
-	logging.Info("server protection enabled")
 }
 
 func (s *DefaultServer) disableProtection() {
-	err := computeClient.UpdateServerProtection(context.TODO(), false)
-	if err != nil {
+	if err := s.setProtection(false); err != nil {
 		logging.Info("failed to disable server protection", zap.Error(err))
-		return
 	}
-	logging.Info("server protection disabled")
+}
+
+// setProtection method    updates the task protection of the server
+func (s *DefaultServer) setProtection(enabled bool) error {
+	err := s.protection.UpdateServerProtection(context.TODO(), enabled)
+	if err != nil {
+		backendFailures.WithLabelValues("protection").Inc()
+		return err
+	}
+	s.protected.Store(enabled)
+	if enabled {
+		logging.Info("server protection enabled")
+	} else {
+		logging.Info("server protection disabled")
+	}
+	return nil
 }
 
 func (s *DefaultServer) resetProtectionTimer(duration time.Duration) {
+	s.protectionMu.Lock()
+	defer s.protectionMu.Unlock()
 	if s.protectionTimer != nil {
 		if s.protectionTimer.TimeRemaining() < duration {
 			s.protectionTimer.Reset(duration)
@@ -414,12 +700,17 @@ func (s *DefaultServer) resetProtectionTimer(duration time.Duration) {
 		)
 		return
 	}
-	s.protectionTimer = utils.NewTimer(duration)
+	timer := utils.NewTimerWithClock(s.cfg.clock(), duration)
+	s.protectionTimer = timer
 	go func() {
 		s.enableProtection()
-		<-s.protectionTimer.C()
+		<-timer.C()
+		s.protectionMu.Lock()
+		if s.protectionTimer == timer {
+			s.protectionTimer = nil
+		}
+		s.protectionMu.Unlock()
 		s.disableProtection()
-		s.protectionTimer = nil
 	}()
 	logging.Info("server protection timer set",
 		zap.String("duration", duration.String()),
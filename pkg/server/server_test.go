@@ -0,0 +1,420 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/yelaco/ludofy/internal/domains/dtos"
+	"github.com/yelaco/ludofy/internal/domains/entities"
+	"github.com/yelaco/ludofy/pkg/utils"
+)
+
+// testMove adds n to the total of the match
+type testMove struct {
+	playerId string
+	n        int
+}
+
+func (m testMove) GetPlayerId() string {
+	return m.playerId
+}
+
+// testMatchHandler sums the moves of the players, its snapshot is the total
+type testMatchHandler struct {
+	match Match
+	total int
+}
+
+func (h *testMatchHandler) GetMatch() Match                          { return h.match }
+func (h *testMatchHandler) OnPlayerJoin(player Player) (bool, error) { return true, nil }
+func (h *testMatchHandler) OnPlayerLeave(player Player) error        { return nil }
+func (h *testMatchHandler) OnMatchSave() error                       { return nil }
+func (h *testMatchHandler) OnMatchEnd() error                        { return nil }
+func (h *testMatchHandler) OnMatchAbort() error                      { return nil }
+
+func (h *testMatchHandler) OnPlayerSync(player Player) error {
+	return player.WriteJson(map[string]interface{}{"type": "sync", "total": h.total})
+}
+
+func (h *testMatchHandler) HandleMove(player Player, move Move) error {
+	h.total += move.(testMove).n
+	h.match.Broadcast(map[string]interface{}{"type": "total", "total": h.total})
+	return nil
+}
+
+func (h *testMatchHandler) OnMatchSnapshot() ([]byte, error) {
+	return []byte(strconv.Itoa(h.total)), nil
+}
+
+// testServerHandler creates testMatchHandler matches and counts how they
+// were loaded, setup can set the policies of the matches
+type testServerHandler struct {
+	mu       sync.Mutex
+	setup    func(match *DefaultMatch)
+	created  int
+	resumed  int
+	restored int
+}
+
+func (s *testServerHandler) newMatch(activeMatch entities.ActiveMatch, total int) Match {
+	players := make(map[string]Player, len(activeMatch.Players))
+	for _, player := range activeMatch.Players {
+		players[player.Id] = NewDefaultPlayer(player.Id, activeMatch.MatchId)
+	}
+	match := NewDefaultMatch(activeMatch.MatchId, players)
+	match.SetHandler(&testMatchHandler{match: match, total: total})
+	if s.setup != nil {
+		s.setup(match.(*DefaultMatch))
+	}
+	return match
+}
+
+func (s *testServerHandler) OnMatchCreate(activeMatch entities.ActiveMatch) (Match, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.created++
+	return s.newMatch(activeMatch, 0), nil
+}
+
+func (s *testServerHandler) OnMatchResume(activeMatch entities.ActiveMatch, currentState entities.MatchState) (Match, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.resumed++
+	return s.newMatch(activeMatch, 0), nil
+}
+
+func (s *testServerHandler) OnMatchRestore(activeMatch entities.ActiveMatch, snapshot []byte) (Match, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.restored++
+	total, err := strconv.Atoi(string(snapshot))
+	if err != nil {
+		return nil, err
+	}
+	return s.newMatch(activeMatch, total), nil
+}
+
+func (s *testServerHandler) OnHandleMessage(playerId string, match MatchHandler, message []byte) error {
+	var msg Message[struct {
+		N int `json:"n"`
+	}]
+	if err := json.Unmarshal(message, &msg); err != nil {
+		return err
+	}
+	match.GetMatch().ProcessMove(testMove{playerId: playerId, n: msg.Data.N})
+	return nil
+}
+
+func (s *testServerHandler) OnHandleMatchEnd(record *MatchRecordRequest, match MatchHandler) error {
+	return nil
+}
+
+func (s *testServerHandler) OnHandleMatchSave(matchState *dtos.MatchStateRequest, match MatchHandler) error {
+	return nil
+}
+
+// testSink keeps the published events. The first failSaves saves fail and,
+// when saveGate is set, saves wait until it is closed
+type testSink struct {
+	mu           sync.Mutex
+	failSaves    int
+	saveGate     chan struct{}
+	saveAttempts int
+	saves        []dtos.MatchStateRequest
+	ends         []MatchRecordRequest
+	aborts       []dtos.MatchAbortRequest
+}
+
+func (s *testSink) PublishMatchSave(ctx context.Context, matchState dtos.MatchStateRequest) error {
+	if s.saveGate != nil {
+		<-s.saveGate
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.saveAttempts++
+	if s.failSaves > 0 {
+		s.failSaves--
+		return errors.New("sink down")
+	}
+	s.saves = append(s.saves, matchState)
+	return nil
+}
+
+func (s *testSink) PublishMatchEnd(ctx context.Context, record MatchRecordRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ends = append(s.ends, record)
+	return nil
+}
+
+func (s *testSink) PublishMatchAbort(ctx context.Context, req dtos.MatchAbortRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.aborts = append(s.aborts, req)
+	return nil
+}
+
+func (s *testSink) saveCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.saves)
+}
+
+func (s *testSink) endCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.ends)
+}
+
+// eventually fails the test unless cond holds within a second
+func eventually(t *testing.T, cond func() bool, msg string) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal(msg)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// failingSnapshotStore fails every read of a snapshot
+type failingSnapshotStore struct {
+	SnapshotStore
+}
+
+func (s failingSnapshotStore) GetMatchSnapshot(ctx context.Context, matchId string) (*MatchSnapshot, error) {
+	return nil, errors.New("snapshot store down")
+}
+
+// newTestConn returns the server side of a websocket connection and the
+// client side reading from it
+func newTestConn(t *testing.T) (*websocket.Conn, *websocket.Conn) {
+	t.Helper()
+	conns := make(chan *websocket.Conn, 1)
+	upgrader := websocket.Upgrader{}
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade: %v", err)
+			return
+		}
+		conns <- conn
+	}))
+	t.Cleanup(httpServer.Close)
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(httpServer.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	conn := <-conns
+	t.Cleanup(func() { conn.Close() })
+	return conn, client
+}
+
+type testServer struct {
+	*DefaultServer
+	handler *testServerHandler
+	store   *MemoryMatchStore
+	sink    *testSink
+}
+
+// newTestServer creates a server backed by memory, cfg can change the
+// config before the server is created
+func newTestServer(t *testing.T, cfg func(*Config)) *testServer {
+	t.Helper()
+	handler := &testServerHandler{}
+	store := NewMemoryMatchStore()
+	sink := &testSink{}
+	config := Config{
+		ServerHandler:        handler,
+		MatchStore:           store,
+		MatchSink:            sink,
+		ProtectionController: noopProtectionController{},
+		maxMatches:           10,
+		protectionTimeout:    time.Hour,
+		saveRetryBackoff:     time.Millisecond,
+		spoolDir:             t.TempDir(),
+		spoolOwner:           "test",
+		spoolRetryBackoff:    time.Millisecond,
+		spoolMaxAge:          time.Hour,
+		rateLimit:            rateLimitConfig{},
+	}
+	if cfg != nil {
+		cfg(&config)
+	}
+	return &testServer{
+		DefaultServer: NewFromConfig(config).(*DefaultServer),
+		handler:       handler,
+		store:         store,
+		sink:          sink,
+	}
+}
+
+// testDriver drives a match of the config on a fake clock and keeps the
+// messages written to each player
+type testDriver struct {
+	*MatchDriver
+	messages map[string][]map[string]interface{}
+	mu       sync.Mutex
+}
+
+// newTestDriver creates and joins the players to a match of the server
+// handler of cfg, a testServerHandler when not set
+func newTestDriver(t *testing.T, cfg Config, playerIds ...string) *testDriver {
+	t.Helper()
+	if cfg.ServerHandler == nil {
+		cfg.ServerHandler = &testServerHandler{}
+	}
+	activeMatch := entities.ActiveMatch{MatchId: "m1"}
+	for _, playerId := range playerIds {
+		activeMatch.Players = append(activeMatch.Players, entities.Player{Id: playerId})
+	}
+	driver, err := NewMatchDriver(cfg, activeMatch, nil, utils.NewFakeClock(time.Now()))
+	if err != nil {
+		t.Fatalf("new match driver: %v", err)
+	}
+	d := &testDriver{
+		MatchDriver: driver,
+		messages:    make(map[string][]map[string]interface{}),
+	}
+	for _, playerId := range playerIds {
+		err := driver.Join(playerId, func(data []byte) {
+			var msg map[string]interface{}
+			if err := json.Unmarshal(data, &msg); err != nil {
+				t.Errorf("unmarshal %s: %v", data, err)
+			}
+			d.mu.Lock()
+			defer d.mu.Unlock()
+			d.messages[playerId] = append(d.messages[playerId], msg)
+		})
+		if err != nil {
+			t.Fatalf("join %s: %v", playerId, err)
+		}
+	}
+	return d
+}
+
+func (d *testDriver) send(t *testing.T, playerId, msg string) {
+	t.Helper()
+	if err := d.Send(playerId, []byte(msg)); err != nil {
+		t.Fatalf("send %s: %v", msg, err)
+	}
+}
+
+// ofType returns the messages of the type written to the player
+func (d *testDriver) ofType(playerId, msgType string) []map[string]interface{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	messages := []map[string]interface{}{}
+	for _, msg := range d.messages[playerId] {
+		if msg["type"] == msgType {
+			messages = append(messages, msg)
+		}
+	}
+	return messages
+}
+
+// errors returns the error statuses written to the player
+func (d *testDriver) errors(playerId string) []string {
+	statuses := []string{}
+	for _, msg := range d.ofType(playerId, "error") {
+		statuses = append(statuses, msg["error"].(string))
+	}
+	return statuses
+}
+
+func (d *testDriver) total() int {
+	return d.Match().GetHandler().(*testMatchHandler).total
+}
+
+func (s *testServer) putActiveMatch(matchId string, playerIds ...string) {
+	activeMatch := entities.ActiveMatch{MatchId: matchId}
+	for _, playerId := range playerIds {
+		activeMatch.Players = append(activeMatch.Players, entities.Player{Id: playerId})
+	}
+	s.store.PutActiveMatch(activeMatch)
+}
+
+func TestLoadMatchSnapshotUnavailable(t *testing.T) {
+	srv := newTestServer(t, func(cfg *Config) {
+		cfg.SnapshotStore = failingSnapshotStore{NewFileSnapshotStore(t.TempDir())}
+		cfg.Address = "here"
+	})
+	srv.putActiveMatch("m1", "a", "b")
+
+	if _, err := srv.loadMatch("m1"); !errors.Is(err, ErrSnapshotUnavailable) {
+		t.Fatalf("load error %v, want ErrSnapshotUnavailable", err)
+	}
+	if srv.handler.created+srv.handler.resumed != 0 {
+		t.Fatal("match was loaded from its saves while its snapshot couldn't be read")
+	}
+}
+
+func TestLoadMatchSnapshotTarget(t *testing.T) {
+	snapshots := NewFileSnapshotStore(t.TempDir())
+	srv := newTestServer(t, func(cfg *Config) {
+		cfg.SnapshotStore = snapshots
+		cfg.Address = "here"
+	})
+	srv.putActiveMatch("m1", "a", "b")
+	snapshots.PutMatchSnapshot(context.Background(), MatchSnapshot{MatchId: "m1", Target: "there", Data: []byte("3")})
+
+	if _, err := srv.loadMatch("m1"); !errors.Is(err, ErrMatchMigrated) {
+		t.Fatalf("load error %v, want ErrMatchMigrated", err)
+	}
+
+	snapshots.PutMatchSnapshot(context.Background(), MatchSnapshot{MatchId: "m1", Target: "here", Data: []byte("3")})
+	match, err := srv.loadMatch("m1")
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if srv.handler.restored != 1 || match.GetHandler().(*testMatchHandler).total != 3 {
+		t.Fatal("match wasn't restored from its snapshot")
+	}
+	if snapshot, _ := snapshots.GetMatchSnapshot(context.Background(), "m1"); snapshot != nil {
+		t.Fatal("snapshot kept after the restore")
+	}
+}
+
+func TestMigrateMatch(t *testing.T) {
+	snapshots := NewFileSnapshotStore(t.TempDir())
+	srv := newTestServer(t, func(cfg *Config) {
+		cfg.SnapshotStore = snapshots
+		cfg.Address = "here"
+	})
+	srv.putActiveMatch("m1", "a", "b")
+	match, err := srv.loadMatch("m1")
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	match.ProcessMove(testMove{playerId: "a", n: 2})
+
+	if err := srv.MigrateMatch(context.Background(), "m1", "there"); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if _, err := srv.getMatch("m1"); !errors.Is(err, ErrMatchNotFound) {
+		t.Fatalf("migrated match still on the server: %v", err)
+	}
+	snapshot, err := snapshots.GetMatchSnapshot(context.Background(), "m1")
+	if err != nil || snapshot == nil || snapshot.Target != "there" || string(snapshot.Data) != "2" {
+		t.Fatalf("snapshot %+v, %v", snapshot, err)
+	}
+	// a client which reconnects to the source is turned away
+	if _, err := srv.loadMatch("m1"); !errors.Is(err, ErrMatchMigrated) {
+		t.Fatalf("reconnect error %v, want ErrMatchMigrated", err)
+	}
+	activeMatch, _ := srv.store.GetActiveMatch(context.Background(), "m1")
+	if activeMatch.Server != "there" {
+		t.Fatalf("active match server %q, want there", activeMatch.Server)
+	}
+}
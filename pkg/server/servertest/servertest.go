@@ -0,0 +1,201 @@
+// Package servertest drives matches of a server handler without websockets
+// or AWS, for testing games.
+package servertest
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/yelaco/ludofy/internal/domains/entities"
+	"github.com/yelaco/ludofy/pkg/server"
+	"github.com/yelaco/ludofy/pkg/utils"
+)
+
+// Player captures the messages written to a player of the match
+type Player struct {
+	Id string
+
+	messages [][]byte
+	mu       sync.Mutex
+}
+
+func (p *Player) write(data []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.messages = append(p.messages, append([]byte{}, data...))
+}
+
+// Messages method    returns the raw JSON messages written to the player
+func (p *Player) Messages() [][]byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([][]byte{}, p.messages...)
+}
+
+// Decoded method    returns the messages written to the player decoded as JSON objects
+func (p *Player) Decoded() []map[string]interface{} {
+	decoded := []map[string]interface{}{}
+	for _, data := range p.Messages() {
+		var msg map[string]interface{}
+		if err := json.Unmarshal(data, &msg); err != nil {
+			continue
+		}
+		decoded = append(decoded, msg)
+	}
+	return decoded
+}
+
+// OfType method    returns the decoded messages with the given type field
+func (p *Player) OfType(msgType string) []map[string]interface{} {
+	messages := []map[string]interface{}{}
+	for _, msg := range p.Decoded() {
+		if msg["type"] == msgType {
+			messages = append(messages, msg)
+		}
+	}
+	return messages
+}
+
+// Last method    decodes the last message written to the player into v,
+// returns false if there is none
+func (p *Player) Last(v interface{}) bool {
+	messages := p.Messages()
+	if len(messages) == 0 {
+		return false
+	}
+	return json.Unmarshal(messages[len(messages)-1], v) == nil
+}
+
+// Clear method    drops the captured messages
+func (p *Player) Clear() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.messages = nil
+}
+
+// Match drives a match created by the server handler of the config. Moves are
+// handled synchronously and the match runs on a fake clock which only moves
+// with Advance. The clock of the config is used if it is a *utils.FakeClock,
+// so the server handler can share it for its timers, otherwise a fake clock
+// starting now is created
+type Match struct {
+	*server.MatchDriver
+
+	players map[string]*Player
+}
+
+// NewMatch creates the match with OnMatchCreate
+func NewMatch(cfg server.Config, activeMatch entities.ActiveMatch) (*Match, error) {
+	driver, err := server.NewMatchDriver(cfg, activeMatch, nil, fakeClock(cfg))
+	if err != nil {
+		return nil, err
+	}
+	return newMatch(driver), nil
+}
+
+// ResumeMatch creates the match with OnMatchResume from the match state
+func ResumeMatch(
+	cfg server.Config,
+	activeMatch entities.ActiveMatch,
+	matchState entities.MatchState,
+) (*Match, error) {
+	driver, err := server.NewMatchDriver(cfg, activeMatch, &matchState, fakeClock(cfg))
+	if err != nil {
+		return nil, err
+	}
+	return newMatch(driver), nil
+}
+
+// RestoreMatch restores the match with OnMatchRestore from a snapshot, e.g.
+// one taken with Snapshot
+func RestoreMatch(
+	cfg server.Config,
+	activeMatch entities.ActiveMatch,
+	snapshot []byte,
+) (*Match, error) {
+	driver, err := server.RestoreMatchDriver(cfg, activeMatch, snapshot, fakeClock(cfg))
+	if err != nil {
+		return nil, err
+	}
+	return newMatch(driver), nil
+}
+
+func fakeClock(cfg server.Config) *utils.FakeClock {
+	clock, ok := cfg.Clock.(*utils.FakeClock)
+	if !ok {
+		clock = utils.NewFakeClock(time.Now())
+	}
+	return clock
+}
+
+func newMatch(driver *server.MatchDriver) *Match {
+	return &Match{
+		MatchDriver: driver,
+		players:     make(map[string]*Player),
+	}
+}
+
+// NewActiveMatch returns an active match with the given players
+func NewActiveMatch(matchId, gameMode string, playerIds ...string) entities.ActiveMatch {
+	activeMatch := entities.ActiveMatch{
+		MatchId:   matchId,
+		GameMode:  gameMode,
+		Players:   make([]entities.Player, 0, len(playerIds)),
+		CreatedAt: time.Now(),
+	}
+	for _, playerId := range playerIds {
+		activeMatch.Players = append(activeMatch.Players, entities.Player{Id: playerId})
+	}
+	return activeMatch
+}
+
+// Join method    connects the player and returns it to inspect its messages.
+// A player joining again keeps its captured messages
+func (m *Match) Join(playerId string) (*Player, error) {
+	player, exist := m.players[playerId]
+	if !exist {
+		player = &Player{Id: playerId}
+	}
+	if err := m.MatchDriver.Join(playerId, player.write); err != nil {
+		return nil, err
+	}
+	m.players[playerId] = player
+	return player, nil
+}
+
+// Leave method    disconnects the player
+func (m *Match) Leave(playerId string) error {
+	return m.MatchDriver.Leave(playerId)
+}
+
+// Send method    sends the message of the player, msg is marshalled to JSON
+// unless it is already a []byte or a string
+func (m *Match) Send(playerId string, msg interface{}) error {
+	var data []byte
+	switch msg := msg.(type) {
+	case []byte:
+		data = msg
+	case string:
+		data = []byte(msg)
+	default:
+		var err error
+		data, err = json.Marshal(msg)
+		if err != nil {
+			return fmt.Errorf("failed to marshal message: %w", err)
+		}
+	}
+	return m.MatchDriver.Send(playerId, data)
+}
+
+// Player method    returns a joined player
+func (m *Match) Player(playerId string) (*Player, bool) {
+	player, exist := m.players[playerId]
+	return player, exist
+}
+
+// Ended method    reports whether the match ended
+func (m *Match) Ended() bool {
+	return m.End != nil
+}
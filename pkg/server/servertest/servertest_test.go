@@ -0,0 +1,305 @@
+package servertest_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/yelaco/ludofy/internal/domains/dtos"
+	"github.com/yelaco/ludofy/internal/domains/entities"
+	"github.com/yelaco/ludofy/pkg/server"
+	"github.com/yelaco/ludofy/pkg/server/servertest"
+	"github.com/yelaco/ludofy/pkg/utils"
+)
+
+const (
+	counterTarget = 3
+	idleTimeout   = 10 * time.Second
+	idleTimer     = "idle"
+)
+
+// counterServer creates matches where players add to a shared total, the
+// match ends once the total reaches counterTarget and aborts when nobody
+// moves for idleTimeout
+type counterServer struct {
+	clock utils.Clock
+}
+
+type counterMove struct {
+	playerId string
+	n        int
+}
+
+func (m counterMove) GetPlayerId() string {
+	return m.playerId
+}
+
+type counterMatch struct {
+	server.Match
+	total  int
+	joined map[string]struct{}
+	timer  utils.ClockTimer
+	clock  utils.Clock
+}
+
+type counterState struct {
+	Type  string `json:"type"`
+	Total int    `json:"total"`
+}
+
+type counterHandler struct {
+	match *counterMatch
+}
+
+func (s *counterServer) OnMatchCreate(activeMatch entities.ActiveMatch) (server.Match, error) {
+	players := make(map[string]server.Player, len(activeMatch.Players))
+	for _, player := range activeMatch.Players {
+		players[player.Id] = server.NewDefaultPlayer(player.Id, activeMatch.MatchId)
+	}
+	match := &counterMatch{
+		Match:  server.NewDefaultMatch(activeMatch.MatchId, players),
+		joined: make(map[string]struct{}),
+		clock:  s.clock,
+	}
+	match.SetHandler(&counterHandler{match: match})
+	return match, nil
+}
+
+func (s *counterServer) OnMatchResume(
+	activeMatch entities.ActiveMatch,
+	currentState entities.MatchState,
+) (server.Match, error) {
+	return s.OnMatchCreate(activeMatch)
+}
+
+func (s *counterServer) OnHandleMessage(playerId string, matchHandler server.MatchHandler, message []byte) error {
+	var msg server.Message[struct {
+		N int `json:"n"`
+	}]
+	if err := json.Unmarshal(message, &msg); err != nil {
+		return err
+	}
+	matchHandler.GetMatch().ProcessMove(counterMove{playerId: playerId, n: msg.Data.N})
+	return nil
+}
+
+func (s *counterServer) OnHandleMatchEnd(record *server.MatchRecordRequest, matchHandler server.MatchHandler) error {
+	match := matchHandler.GetMatch().(*counterMatch)
+	record.Players = []server.PlayerRecord{{"Total": match.total}}
+	return nil
+}
+
+func (s *counterServer) OnHandleMatchSave(matchState *dtos.MatchStateRequest, matchHandler server.MatchHandler) error {
+	return nil
+}
+
+func (h *counterHandler) GetMatch() server.Match {
+	return h.match
+}
+
+func (h *counterHandler) OnPlayerJoin(player server.Player) (bool, error) {
+	h.match.joined[player.GetId()] = struct{}{}
+	if h.match.timer != nil || len(h.match.joined) < len(h.match.GetPlayers()) {
+		return false, nil
+	}
+	h.match.timer = h.match.clock.AfterFunc(idleTimeout, func() {
+		h.match.FireTimer(idleTimer)
+	})
+	return true, nil
+}
+
+func (h *counterHandler) OnPlayerLeave(player server.Player) error {
+	return nil
+}
+
+func (h *counterHandler) OnPlayerSync(player server.Player) error {
+	return player.WriteJson(counterState{Type: "state", Total: h.match.total})
+}
+
+func (h *counterHandler) HandleMove(player server.Player, move server.Move) error {
+	h.match.total += move.(counterMove).n
+	h.match.Broadcast(counterState{Type: "state", Total: h.match.total})
+	if h.match.total >= counterTarget {
+		h.match.timer.Stop()
+		h.match.End()
+		return nil
+	}
+	h.match.timer.Reset(idleTimeout)
+	return nil
+}
+
+func (h *counterHandler) OnTimer(name string) error {
+	if name == idleTimer {
+		h.match.Abort()
+	}
+	return nil
+}
+
+func (h *counterHandler) OnMatchSave() error {
+	return nil
+}
+
+// OnMatchEnd method    saves the final total, which must not block while the
+// match is ending
+func (h *counterHandler) OnMatchEnd() error {
+	h.match.Save()
+	return nil
+}
+
+func (h *counterHandler) OnMatchAbort() error {
+	return nil
+}
+
+func newCounterMatch(t *testing.T) *servertest.Match {
+	t.Helper()
+	clock := utils.NewFakeClock(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	match, err := servertest.NewMatch(server.Config{
+		ServerHandler: &counterServer{clock: clock},
+		Clock:         clock,
+	}, servertest.NewActiveMatch("m1", "counter", "alice", "bob"))
+	if err != nil {
+		t.Fatalf("NewMatch: %v", err)
+	}
+	return match
+}
+
+func add(n int) map[string]interface{} {
+	return map[string]interface{}{"type": "add", "data": map[string]int{"n": n}}
+}
+
+func lastTotal(t *testing.T, player *servertest.Player) int {
+	t.Helper()
+	var state counterState
+	if !player.Last(&state) || state.Type != "state" {
+		t.Fatalf("last message of %s isn't a state", player.Id)
+	}
+	return state.Total
+}
+
+func TestMatchEnds(t *testing.T) {
+	match := newCounterMatch(t)
+	alice, err := match.Join("alice")
+	if err != nil {
+		t.Fatalf("Join alice: %v", err)
+	}
+	bob, err := match.Join("bob")
+	if err != nil {
+		t.Fatalf("Join bob: %v", err)
+	}
+
+	if err := match.Send("alice", add(1)); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if got := lastTotal(t, bob); got != 1 {
+		t.Fatalf("bob saw total %d, want 1", got)
+	}
+	if match.Ended() {
+		t.Fatal("match ended before reaching the target")
+	}
+
+	if err := match.Send("bob", add(2)); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if !match.Ended() {
+		t.Fatal("match didn't end at the target")
+	}
+	if got := match.End.Players[0]["Total"]; got != counterTarget {
+		t.Fatalf("recorded total %v, want %d", got, counterTarget)
+	}
+	if states := alice.OfType("state"); len(states) != 3 {
+		t.Fatalf("alice got %d states, want the sync and one per move", len(states))
+	}
+}
+
+func TestMatchTimers(t *testing.T) {
+	tests := []struct {
+		name        string
+		moveAfter   time.Duration
+		advance     time.Duration
+		wantAborted bool
+	}{
+		{name: "idle match aborts", advance: idleTimeout, wantAborted: true},
+		{name: "timer waits for its deadline", advance: idleTimeout - time.Second},
+		{name: "move resets the timer", moveAfter: 9 * time.Second, advance: 9 * time.Second},
+		{name: "timer fires after the reset", moveAfter: 9 * time.Second, advance: idleTimeout, wantAborted: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match := newCounterMatch(t)
+			match.Join("alice")
+			match.Join("bob")
+			if tt.moveAfter > 0 {
+				match.Advance(tt.moveAfter)
+				if err := match.Send("alice", add(1)); err != nil {
+					t.Fatalf("Send: %v", err)
+				}
+			}
+			match.Advance(tt.advance)
+			if match.Aborted != tt.wantAborted {
+				t.Fatalf("aborted %t, want %t", match.Aborted, tt.wantAborted)
+			}
+		})
+	}
+}
+
+func TestJoinAgainKeepsMessages(t *testing.T) {
+	match := newCounterMatch(t)
+	alice, _ := match.Join("alice")
+	match.Join("bob")
+	if err := match.Leave("alice"); err != nil {
+		t.Fatalf("Leave: %v", err)
+	}
+	match.Send("bob", add(1))
+
+	rejoined, err := match.Join("alice")
+	if err != nil {
+		t.Fatalf("Join: %v", err)
+	}
+	if rejoined != alice {
+		t.Fatal("joining again returned another player")
+	}
+	if got := lastTotal(t, alice); got != 1 {
+		t.Fatalf("alice synced total %d, want 1", got)
+	}
+	states := alice.OfType("state")
+	if len(states) < 2 || states[0]["total"] != 0.0 {
+		t.Fatalf("alice has states %v, want the first sync kept", states)
+	}
+
+	alice.Clear()
+	if len(alice.Messages()) != 0 {
+		t.Fatal("Clear kept messages")
+	}
+	if player, ok := match.Player("alice"); !ok || player != alice {
+		t.Fatal("Player didn't return the joined player")
+	}
+}
+
+func TestUnknownPlayer(t *testing.T) {
+	match := newCounterMatch(t)
+	if _, err := match.Join("carol"); !errors.Is(err, server.ErrPlayerNotFound) {
+		t.Fatalf("Join error %v, want ErrPlayerNotFound", err)
+	}
+	if err := match.Send("carol", add(1)); !errors.Is(err, server.ErrPlayerNotFound) {
+		t.Fatalf("Send error %v, want ErrPlayerNotFound", err)
+	}
+	if err := match.Leave("carol"); !errors.Is(err, server.ErrPlayerNotFound) {
+		t.Fatalf("Leave error %v, want ErrPlayerNotFound", err)
+	}
+	if _, ok := match.Player("carol"); ok {
+		t.Fatal("Player returned a player who never joined")
+	}
+}
+
+func TestNewActiveMatch(t *testing.T) {
+	activeMatch := servertest.NewActiveMatch("m1", "counter", "alice", "bob")
+	if activeMatch.MatchId != "m1" || activeMatch.GameMode != "counter" {
+		t.Fatalf("unexpected active match %+v", activeMatch)
+	}
+	if len(activeMatch.Players) != 2 ||
+		activeMatch.Players[0].Id != "alice" ||
+		activeMatch.Players[1].Id != "bob" {
+		t.Fatalf("unexpected players %+v", activeMatch.Players)
+	}
+}
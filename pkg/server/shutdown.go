@@ -0,0 +1,141 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/yelaco/ludofy/pkg/logging"
+	"go.uber.org/zap"
+)
+
+// spoolFlushTimeout bounds the wait for the end and abort events still
+// pending on shutdown, the rest is published on the next start
+const spoolFlushTimeout = 5 * time.Second
+
+// migrationPickTimeout bounds picking the server to hand matches over to
+const migrationPickTimeout = 10 * time.Second
+
+type serverDrainingResponse struct {
+	Type      string `json:"type"`
+	Reconnect bool   `json:"reconnect"`
+}
+
+// handleShutdown method    waits for a termination signal, then drains the
+// server and shuts down the http servers once connections are closed or the
+// grace period is over and the spooled events are published
+func (s *DefaultServer) handleShutdown(httpServers []*http.Server, done chan<- struct{}) {
+	defer close(done)
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGTERM, os.Interrupt)
+	sig := <-sigCh
+	logging.Info("shutdown signal received", zap.String("signal", sig.String()))
+
+	s.drain()
+	s.waitForConnections(s.cfg.shutdownGracePeriod)
+	s.spool.flush(spoolFlushTimeout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, httpServer := range httpServers {
+		if err := httpServer.Shutdown(ctx); err != nil {
+			logging.Error("failed to shutdown http server", zap.Error(err))
+		}
+	}
+}
+
+// drain method    stops accepting new matches and hands every loaded match
+// over to the migration target picked now. Other matches are saved and their
+// players asked to reconnect to another server. Then it waits for the saves
+// to be published
+func (s *DefaultServer) drain() {
+	s.draining.Store(true)
+	logging.Info("server draining")
+
+	target := s.pickMigrationTarget()
+	s.matches.Range(func(key, value any) bool {
+		match, ok := value.(Match)
+		if !ok || match.IsEnded() {
+			return true
+		}
+		if target != "" {
+			err := s.migrateMatch(context.Background(), match, target)
+			if err == nil {
+				return true
+			}
+			logging.Error("failed to migrate match, saving it instead",
+				zap.String("match_id", match.GetId()),
+				zap.Error(err),
+			)
+		}
+		// Saved on the match goroutine, between moves. The match stops there,
+		// the moves sent after the final save are dropped
+		err := match.handOff(func() error {
+			match.Save()
+			return nil
+		})
+		if err != nil {
+			return true
+		}
+		s.saveRecording(match)
+		match.Broadcast(serverDrainingResponse{
+			Type:      "serverDraining",
+			Reconnect: true,
+		})
+		deadline := time.Now().Add(5 * time.Second)
+		for _, player := range match.GetPlayers() {
+			player.WriteControl(
+				websocket.CloseMessage,
+				websocket.FormatCloseMessage(
+					websocket.CloseServiceRestart,
+					"server draining",
+				),
+				deadline,
+			)
+		}
+		match.disconnectSpectators("server draining", deadline)
+		logging.Info("match drained", zap.String("match_id", match.GetId()))
+		return true
+	})
+	s.flushAllSaves()
+	logging.Info("match saves flushed")
+}
+
+// pickMigrationTarget method    returns the server to hand the matches over
+// to, empty when migration is disabled or no server can take them
+func (s *DefaultServer) pickMigrationTarget() string {
+	if s.cfg.MigrationTargetPicker == nil || s.snapshots == nil {
+		return ""
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), migrationPickTimeout)
+	defer cancel()
+	target, err := s.cfg.MigrationTargetPicker.PickMigrationTarget(ctx)
+	if err != nil {
+		backendFailures.WithLabelValues("migrate").Inc()
+		logging.Error("failed to pick migration target", zap.Error(err))
+		return ""
+	}
+	logging.Info("migration target picked", zap.String("target", target))
+	return target
+}
+
+func (s *DefaultServer) waitForConnections(gracePeriod time.Duration) {
+	closed := make(chan struct{})
+	go func() {
+		s.connections.Wait()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+		logging.Info("all connections closed")
+	case <-time.After(gracePeriod):
+		logging.Info("shutdown grace period exceeded",
+			zap.String("grace_period", gracePeriod.String()),
+		)
+	}
+}
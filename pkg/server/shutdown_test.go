@@ -0,0 +1,22 @@
+package server
+
+import "testing"
+
+func TestDrainStopsMatch(t *testing.T) {
+	srv := newTestServer(t, nil)
+	srv.putActiveMatch("m1", "a", "b")
+	match, err := srv.loadMatch("m1")
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	match.ProcessMove(testMove{playerId: "a", n: 2})
+
+	srv.drain()
+	if srv.sink.saveCount() != 1 {
+		t.Fatalf("%d saves, want the final save of the drain", srv.sink.saveCount())
+	}
+	match.ProcessMove(testMove{playerId: "b", n: 5})
+	if total := match.GetHandler().(*testMatchHandler).total; total != 2 {
+		t.Fatalf("total %d, want the move after the final save dropped", total)
+	}
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// spectatorQueueSize is the number of messages a spectator may fall behind
+// before it is dropped
+const spectatorQueueSize = 64
+
+// spectatorFrame is a message queued for a spectator
+type spectatorFrame struct {
+	messageType int
+	data        []byte
+	deadline    time.Time
+}
+
+func NewDefaultSpectator(spectatorId string, conn *websocket.Conn) Spectator {
+	return newDefaultSpectator(spectatorId, conn)
+}
+
+// newDefaultSpectator creates the spectator and starts writing its messages,
+// the writes must be stopped with stop once the spectator leaves
+func newDefaultSpectator(spectatorId string, conn *websocket.Conn) *DefaultSpectator {
+	s := &DefaultSpectator{
+		Id:     spectatorId,
+		Conn:   conn,
+		codec:  codecOf(conn),
+		queue:  make(chan spectatorFrame, spectatorQueueSize),
+		closed: make(chan struct{}),
+	}
+	if conn != nil {
+		go s.writeLoop()
+	}
+	return s
+}
+
+func (s *DefaultSpectator) GetId() string {
+	return s.Id
+}
+
+// Write method    encodes the message with the codec negotiated by the
+// connection and queues it, it never blocks. A spectator too slow to keep up
+// with its queue is disconnected
+func (s *DefaultSpectator) Write(msg interface{}) error {
+	if s.Conn == nil {
+		return nil
+	}
+	data, err := s.codec.encode(msg, 0)
+	if err != nil {
+		return err
+	}
+	return s.enqueue(spectatorFrame{
+		messageType: s.codec.messageType(),
+		data:        data,
+	})
+}
+
+func (s *DefaultSpectator) WriteJson(msg interface{}) error {
+	return s.Write(msg)
+}
+
+// WriteControl method    queues the control message behind the messages, so
+// a close message doesn't overtake the last state of the match
+func (s *DefaultSpectator) WriteControl(messageType int, data []byte, deadline time.Time) error {
+	if s.Conn == nil {
+		return nil
+	}
+	return s.enqueue(spectatorFrame{
+		messageType: messageType,
+		data:        data,
+		deadline:    deadline,
+	})
+}
+
+// enqueue method    queues the frame without blocking, the spectator is
+// disconnected when its queue is full
+func (s *DefaultSpectator) enqueue(frame spectatorFrame) error {
+	select {
+	case <-s.closed:
+		return nil
+	default:
+	}
+	select {
+	case s.queue <- frame:
+		return nil
+	default:
+		s.stop()
+		return ErrSpectatorTooSlow
+	}
+}
+
+// writeLoop method    writes the queued frames in order
+func (s *DefaultSpectator) writeLoop() {
+	for {
+		select {
+		case frame := <-s.queue:
+			var err error
+			if frame.deadline.IsZero() {
+				err = s.Conn.WriteMessage(frame.messageType, frame.data)
+				messagesSent.Inc()
+			} else {
+				err = s.Conn.WriteControl(frame.messageType, frame.data, frame.deadline)
+			}
+			if err != nil {
+				s.stop()
+				return
+			}
+		case <-s.closed:
+			return
+		}
+	}
+}
+
+// stop method    stops the writes and closes the connection, which ends the
+// read loop of the spectator
+func (s *DefaultSpectator) stop() {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+		if s.Conn != nil {
+			s.Conn.Close()
+		}
+	})
+}
@@ -0,0 +1,409 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/yelaco/ludofy/internal/domains/dtos"
+	"github.com/yelaco/ludofy/pkg/logging"
+	"github.com/yelaco/ludofy/pkg/utils"
+	"go.uber.org/zap"
+)
+
+type spoolEventType string
+
+const (
+	spoolEnd   spoolEventType = "end"
+	spoolAbort spoolEventType = "abort"
+)
+
+// spoolEvent is a match end or abort waiting to be published
+type spoolEvent struct {
+	Id        string                  `json:"id"`
+	Type      spoolEventType          `json:"type"`
+	MatchId   string                  `json:"matchId"`
+	CreatedAt time.Time               `json:"createdAt"`
+	Record    *MatchRecordRequest     `json:"record,omitempty"`
+	Abort     *dtos.MatchAbortRequest `json:"abort,omitempty"`
+}
+
+func (e spoolEvent) valid() bool {
+	switch e.Type {
+	case spoolEnd:
+		return e.Id != "" && e.Record != nil
+	case spoolAbort:
+		return e.Id != "" && e.Abort != nil
+	}
+	return false
+}
+
+// spoolDeadLetterDir is the directory of the spool holding the events which
+// couldn't be published within the max age
+const spoolDeadLetterDir = "dead"
+
+const (
+	// spoolLeaseFile holds the last time the owner of a spool directory was
+	// seen alive
+	spoolLeaseFile = "lease"
+	// spoolLeaseInterval is how often the lease is renewed and the directories
+	// of stopped servers are looked for
+	spoolLeaseInterval = 10 * time.Second
+	// spoolLeaseTimeout is how long a lease goes without renewal before the
+	// directory is adopted by another server
+	spoolLeaseTimeout = time.Minute
+)
+
+// eventSpool persists the end and abort events of matches to disk before
+// publishing them, so they survive failed publishes and restarts. Events are
+// retried with backoff until published, the ones still pending on shutdown
+// are published when the server starts again. Events still failing once
+// older than maxAge are moved to the dead letter directory of the spool for
+// an operator to look at. Events are delivered at least once.
+//
+// Servers sharing the spool, like the tasks mounting the same EFS volume,
+// each keep their events in <root>/<owner> and renew a lease there. The
+// events of a directory whose lease expired are claimed one by one with a
+// rename into the own directory, so each event has a single publisher
+type eventSpool struct {
+	root    string
+	owner   string
+	dir     string
+	sink    MatchSink
+	clock   utils.Clock
+	backoff time.Duration
+	maxAge  time.Duration
+
+	pending  atomic.Int32
+	inFlight sync.WaitGroup
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func newEventSpool(root, owner string, sink MatchSink, clock utils.Clock, backoff, maxAge time.Duration) *eventSpool {
+	return &eventSpool{
+		root:    root,
+		owner:   owner,
+		dir:     filepath.Join(root, owner),
+		sink:    sink,
+		clock:   clock,
+		backoff: backoff,
+		maxAge:  maxAge,
+		stop:    make(chan struct{}),
+	}
+}
+
+// publish method    writes the event to the spool and publishes it in the
+// background once after is closed. An event which can't be written is still
+// published, it is lost if the server stops before
+func (s *eventSpool) publish(event spoolEvent, after <-chan struct{}) {
+	event.Id = utils.GenerateUUID()
+	event.CreatedAt = s.clock.Now()
+	if err := s.write(s.dir, event); err != nil {
+		backendFailures.WithLabelValues("spool").Inc()
+		logging.Error("failed to spool match event",
+			zap.String("match_id", event.MatchId),
+			zap.String("event", string(event.Type)),
+			zap.Error(err),
+		)
+	}
+	s.deliver(event, after)
+}
+
+// replay method    takes the lease of the own directory, publishes the events
+// left there by a previous run and keeps adopting the directories of servers
+// which stopped
+func (s *eventSpool) replay() {
+	s.renewLease()
+	s.deliverDir(s.dir)
+	s.adopt()
+	go func() {
+		ticker := s.clock.NewTicker(spoolLeaseInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C():
+				s.renewLease()
+				s.adopt()
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// deliverDir method    publishes the events of the own directory in order
+func (s *eventSpool) deliverDir(dir string) {
+	for _, name := range s.eventNames(dir) {
+		event, ok := s.read(dir, name)
+		if !ok {
+			continue
+		}
+		logging.Info("replaying spooled event",
+			zap.String("match_id", event.MatchId),
+			zap.String("event", string(event.Type)),
+		)
+		s.deliver(event, closedCh)
+	}
+}
+
+func (s *eventSpool) read(dir, name string) (spoolEvent, bool) {
+	payload, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		logging.Error("failed to read spooled event", zap.String("file", name), zap.Error(err))
+		return spoolEvent{}, false
+	}
+	var event spoolEvent
+	if err := json.Unmarshal(payload, &event); err != nil || !event.valid() {
+		logging.Error("invalid spooled event", zap.String("file", name), zap.Error(err))
+		return spoolEvent{}, false
+	}
+	return event, true
+}
+
+// adopt method    claims the events of the spool directories whose lease
+// expired, including the events left in the root by older servers. An event
+// is claimed by renaming it into the own directory, which only one server
+// can do, then it is published like an own one
+func (s *eventSpool) adopt() {
+	entries, err := os.ReadDir(s.root)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logging.Error("failed to read spool", zap.Error(err))
+		}
+		return
+	}
+	dirs := []string{s.root}
+	for _, entry := range entries {
+		if entry.IsDir() && entry.Name() != s.owner && entry.Name() != spoolDeadLetterDir {
+			dirs = append(dirs, filepath.Join(s.root, entry.Name()))
+		}
+	}
+	for _, dir := range dirs {
+		if dir != s.root && !s.leaseExpired(dir) {
+			continue
+		}
+		for _, name := range s.eventNames(dir) {
+			err := os.Rename(filepath.Join(dir, name), filepath.Join(s.dir, name))
+			if err != nil {
+				if !os.IsNotExist(err) {
+					logging.Error("failed to claim spooled event", zap.String("file", name), zap.Error(err))
+				}
+				continue
+			}
+			event, ok := s.read(s.dir, name)
+			if !ok {
+				continue
+			}
+			logging.Info("adopted spooled event",
+				zap.String("match_id", event.MatchId),
+				zap.String("event", string(event.Type)),
+				zap.String("dir", dir),
+			)
+			s.deliver(event, closedCh)
+		}
+		if dir != s.root {
+			// The dead letters of the directory stay for an operator
+			os.Remove(filepath.Join(dir, spoolLeaseFile))
+			os.Remove(dir)
+		}
+	}
+}
+
+// eventNames method    returns the names of the events in the directory,
+// oldest first
+func (s *eventSpool) eventNames(dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logging.Error("failed to read spool", zap.String("dir", dir), zap.Error(err))
+		}
+		return nil
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".json") {
+			names = append(names, entry.Name())
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// renewLease method    writes the current time to the lease of the own
+// directory
+func (s *eventSpool) renewLease() {
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		logging.Error("failed to create spool dir", zap.Error(err))
+		return
+	}
+	now := []byte(s.clock.Now().Format(time.RFC3339Nano))
+	if err := os.WriteFile(filepath.Join(s.dir, spoolLeaseFile), now, 0o644); err != nil {
+		logging.Error("failed to renew spool lease", zap.Error(err))
+	}
+}
+
+// leaseExpired method    reports whether the owner of the directory stopped
+// renewing its lease. Directories without a lease are left alone, their owner
+// may be starting
+func (s *eventSpool) leaseExpired(dir string) bool {
+	payload, err := os.ReadFile(filepath.Join(dir, spoolLeaseFile))
+	if err != nil {
+		return false
+	}
+	renewedAt, err := time.Parse(time.RFC3339Nano, string(payload))
+	if err != nil {
+		return false
+	}
+	return s.clock.Since(renewedAt) >= spoolLeaseTimeout
+}
+
+// flush method    waits up to timeout for the pending events to be
+// published, then stops retrying. The events left stay in the spool for the
+// next start or for another server once the lease expires
+func (s *eventSpool) flush(timeout time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		s.inFlight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		logging.Info("spooled events left for next start", zap.Int32("pending", s.pending.Load()))
+	}
+	s.stopOnce.Do(func() { close(s.stop) })
+}
+
+// deliver method    sends the event once after is closed, the event stays
+// in the spool if it stops first
+func (s *eventSpool) deliver(event spoolEvent, after <-chan struct{}) {
+	s.pending.Add(1)
+	s.inFlight.Add(1)
+	go func() {
+		defer s.inFlight.Done()
+		select {
+		case <-after:
+		case <-s.stop:
+			return
+		}
+		if s.send(event) {
+			s.pending.Add(-1)
+			s.remove(event)
+		}
+	}()
+}
+
+// send method    publishes the event until it succeeds or is dead lettered,
+// false if the spool stopped first
+func (s *eventSpool) send(event spoolEvent) bool {
+	backoff := s.backoff
+	for attempt := 0; ; attempt++ {
+		err := s.publishEvent(event)
+		if err == nil {
+			if attempt > 0 {
+				logging.Info("spooled event published",
+					zap.String("match_id", event.MatchId),
+					zap.String("event", string(event.Type)),
+					zap.Int("attempts", attempt+1),
+				)
+			}
+			return true
+		}
+		backendFailures.WithLabelValues(string(event.Type)).Inc()
+		logging.Error("failed to publish match event",
+			zap.String("match_id", event.MatchId),
+			zap.String("event", string(event.Type)),
+			zap.Int("attempt", attempt+1),
+			zap.Error(err),
+		)
+		if s.maxAge > 0 && s.clock.Since(event.CreatedAt) >= s.maxAge {
+			s.deadLetter(event)
+			return true
+		}
+		timer := s.clock.NewTimer(backoff)
+		select {
+		case <-timer.C():
+		case <-s.stop:
+			timer.Stop()
+			return false
+		}
+		backoff = min(2*backoff, maxSaveBackoff)
+	}
+}
+
+func (s *eventSpool) publishEvent(event spoolEvent) error {
+	ctx := context.Background()
+	if event.Type == spoolEnd {
+		return s.sink.PublishMatchEnd(ctx, *event.Record)
+	}
+	return s.sink.PublishMatchAbort(ctx, *event.Abort)
+}
+
+// deadLetter method    keeps the event in the dead letter directory, where it
+// isn't replayed anymore
+func (s *eventSpool) deadLetter(event spoolEvent) {
+	backendFailures.WithLabelValues("dead_letter").Inc()
+	logging.Error("match event dead lettered",
+		zap.String("match_id", event.MatchId),
+		zap.String("event", string(event.Type)),
+		zap.Time("created_at", event.CreatedAt),
+	)
+	if err := s.write(filepath.Join(s.dir, spoolDeadLetterDir), event); err != nil {
+		logging.Error("failed to dead letter match event",
+			zap.String("match_id", event.MatchId),
+			zap.Error(err),
+		)
+	}
+}
+
+// write method    persists the event in the directory, it is renamed into
+// place once synced so a crash never leaves a partial event behind
+func (s *eventSpool) write(dir string, event spoolEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create spool dir: %w", err)
+	}
+	file, err := os.CreateTemp(dir, "event-*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create event file: %w", err)
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.Write(payload); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write event: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to sync event: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to close event file: %w", err)
+	}
+	return os.Rename(file.Name(), filepath.Join(dir, s.name(event)))
+}
+
+func (s *eventSpool) remove(event spoolEvent) {
+	err := os.Remove(filepath.Join(s.dir, s.name(event)))
+	if err != nil && !os.IsNotExist(err) {
+		logging.Error("failed to remove spooled event",
+			zap.String("match_id", event.MatchId),
+			zap.Error(err),
+		)
+	}
+}
+
+// name method    names the events by creation time so they replay in order
+func (s *eventSpool) name(event spoolEvent) string {
+	return fmt.Sprintf("%d-%s-%s.json", event.CreatedAt.UnixNano(), event.Type, event.Id)
+}
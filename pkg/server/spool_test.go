@@ -0,0 +1,127 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/yelaco/ludofy/internal/domains/dtos"
+	"github.com/yelaco/ludofy/pkg/utils"
+)
+
+// failingSink is a sink which is always down
+type failingSink struct{}
+
+func (failingSink) PublishMatchSave(ctx context.Context, matchState dtos.MatchStateRequest) error {
+	return errors.New("sink down")
+}
+
+func (failingSink) PublishMatchEnd(ctx context.Context, record MatchRecordRequest) error {
+	return errors.New("sink down")
+}
+
+func (failingSink) PublishMatchAbort(ctx context.Context, req dtos.MatchAbortRequest) error {
+	return errors.New("sink down")
+}
+
+func spoolAbortEvent(clock utils.Clock, matchId string) spoolEvent {
+	return spoolEvent{
+		Id:        utils.GenerateUUID(),
+		Type:      spoolAbort,
+		MatchId:   matchId,
+		CreatedAt: clock.Now(),
+		Abort:     &dtos.MatchAbortRequest{MatchId: matchId},
+	}
+}
+
+func TestSpoolReplay(t *testing.T) {
+	root := t.TempDir()
+	clock := utils.NewFakeClock(time.Now())
+	sink := &testSink{}
+
+	// events left by a previous run of the same server
+	previous := newEventSpool(root, "a", sink, clock, time.Millisecond, time.Hour)
+	if err := previous.write(previous.dir, spoolAbortEvent(clock, "m1")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := previous.write(previous.dir, spoolEvent{
+		Id:        utils.GenerateUUID(),
+		Type:      spoolEnd,
+		MatchId:   "m2",
+		CreatedAt: clock.Now(),
+		Record:    &MatchRecordRequest{},
+	}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	spool := newEventSpool(root, "a", sink, clock, time.Millisecond, time.Hour)
+	spool.replay()
+	spool.flush(time.Second)
+
+	sink.mu.Lock()
+	aborts, ends := len(sink.aborts), len(sink.ends)
+	sink.mu.Unlock()
+	if aborts != 1 || ends != 1 {
+		t.Fatalf("replayed %d aborts and %d ends, want 1 of each", aborts, ends)
+	}
+	if names := spool.eventNames(spool.dir); len(names) != 0 {
+		t.Fatalf("published events %v still in the spool", names)
+	}
+}
+
+func TestSpoolAdoptExpiredLease(t *testing.T) {
+	root := t.TempDir()
+	clock := utils.NewFakeClock(time.Now())
+	sink := &testSink{}
+
+	stopped := newEventSpool(root, "b", &testSink{}, clock, time.Millisecond, time.Hour)
+	stopped.renewLease()
+	if err := stopped.write(stopped.dir, spoolAbortEvent(clock, "m1")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	clock.Advance(spoolLeaseTimeout)
+
+	alive := newEventSpool(root, "c", &testSink{}, clock, time.Millisecond, time.Hour)
+	alive.renewLease()
+	if err := alive.write(alive.dir, spoolAbortEvent(clock, "m2")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	spool := newEventSpool(root, "a", sink, clock, time.Millisecond, time.Hour)
+	spool.replay()
+	spool.flush(time.Second)
+
+	sink.mu.Lock()
+	aborts := sink.aborts
+	sink.mu.Unlock()
+	if len(aborts) != 1 || aborts[0].MatchId != "m1" {
+		t.Fatalf("published %v, want only the event of the expired lease", aborts)
+	}
+	if _, err := os.Stat(stopped.dir); !os.IsNotExist(err) {
+		t.Fatalf("adopted directory still exists: %v", err)
+	}
+	if names := alive.eventNames(alive.dir); len(names) != 1 {
+		t.Fatalf("directory with a fresh lease has events %v, want its event left alone", names)
+	}
+	if _, err := os.Stat(filepath.Join(alive.dir, spoolLeaseFile)); err != nil {
+		t.Fatalf("lease of the live directory: %v", err)
+	}
+}
+
+func TestSpoolDeadLetter(t *testing.T) {
+	root := t.TempDir()
+	clock := utils.NewFakeClock(time.Now())
+	spool := newEventSpool(root, "a", failingSink{}, clock, time.Millisecond, time.Minute)
+
+	event := spoolAbortEvent(clock, "m1")
+	clock.Advance(time.Minute)
+	spool.deliver(event, closedCh)
+	spool.flush(time.Second)
+
+	if names := spool.eventNames(filepath.Join(spool.dir, spoolDeadLetterDir)); len(names) != 1 {
+		t.Fatalf("dead letters %v, want the expired event", names)
+	}
+}
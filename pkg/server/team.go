@@ -0,0 +1,120 @@
+package server
+
+import (
+	"cmp"
+	"slices"
+
+	"github.com/yelaco/ludofy/internal/domains/entities"
+	"github.com/yelaco/ludofy/pkg/logging"
+	"go.uber.org/zap"
+)
+
+// TeamRecord is the placement of a team in the match record, 1 for the
+// winners. Teams with the same placement drew. The server ranks the teams by
+// the mean result of their players, handlers which rank teams differently
+// overwrite the placements in OnHandleMatchEnd
+type TeamRecord struct {
+	Team      string   `json:"team"`
+	PlayerIds []string `json:"playerIds"`
+	Placement int      `json:"placement"`
+}
+
+// GetTeams method    returns the players of the match by team, players
+// without a team are left out
+func (m *DefaultMatch) GetTeams() map[string][]Player {
+	teams := make(map[string][]Player)
+	for _, player := range m.Players {
+		if team := player.GetTeam(); team != "" {
+			teams[team] = append(teams[team], player)
+		}
+	}
+	return teams
+}
+
+// GetTeamPlayers method    returns the players of the team
+func (m *DefaultMatch) GetTeamPlayers(team string) []Player {
+	var players []Player
+	for _, player := range m.Players {
+		if player.GetTeam() == team {
+			players = append(players, player)
+		}
+	}
+	return players
+}
+
+// BroadcastToTeam method    sends the message to the players of the team
+// only, spectators don't receive it
+func (m *DefaultMatch) BroadcastToTeam(team string, msg interface{}) {
+	for _, player := range m.GetTeamPlayers(team) {
+		err := player.WriteJson(msg)
+		if err != nil {
+			logging.Error(
+				"couldn't broadcast to team player",
+				zap.String("player_id", player.GetId()),
+				zap.String("team", team),
+				zap.Error(err),
+			)
+		}
+	}
+}
+
+// BroadcastToOpponents method    sends the message to the players of every
+// other team
+func (m *DefaultMatch) BroadcastToOpponents(team string, msg interface{}) {
+	for opponents := range m.GetTeams() {
+		if opponents != team {
+			m.BroadcastToTeam(opponents, msg)
+		}
+	}
+}
+
+// assignTeams sets the teams of the active match on the players of the match
+func assignTeams(match Match, activeMatch entities.ActiveMatch) {
+	for _, seat := range activeMatch.Players {
+		if player, exist := match.GetPlayerWithId(seat.Id); exist {
+			player.setTeam(seat.Team)
+		}
+	}
+}
+
+// matchTeamRecords ranks the teams of the match by the mean result of their
+// players, so teams of different sizes compare fairly. It is nil when the
+// match has no teams
+func matchTeamRecords(match Match) []TeamRecord {
+	teams := make(map[string]*TeamRecord)
+	results := make(map[string]float64)
+	for _, player := range match.GetPlayers() {
+		team := player.GetTeam()
+		if team == "" {
+			continue
+		}
+		if _, exist := teams[team]; !exist {
+			teams[team] = &TeamRecord{Team: team}
+		}
+		teams[team].PlayerIds = append(teams[team].PlayerIds, player.GetId())
+		results[team] += player.GetResult()
+	}
+	if len(teams) == 0 {
+		return nil
+	}
+
+	records := make([]TeamRecord, 0, len(teams))
+	for team, record := range teams {
+		slices.Sort(record.PlayerIds)
+		records = append(records, *record)
+		results[team] /= float64(len(record.PlayerIds))
+	}
+	slices.SortFunc(records, func(a, b TeamRecord) int {
+		if c := cmp.Compare(results[b.Team], results[a.Team]); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Team, b.Team)
+	})
+	for i := range records {
+		records[i].Placement = i + 1
+		if i > 0 && results[records[i].Team] == results[records[i-1].Team] {
+			records[i].Placement = records[i-1].Placement
+		}
+	}
+	return records
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMatchTeamRecords(t *testing.T) {
+	tests := []struct {
+		name    string
+		results map[string]float64
+		teams   map[string]string
+		want    []TeamRecord
+	}{
+		{
+			name:    "no teams",
+			results: map[string]float64{"a": 1, "b": 0},
+			teams:   map[string]string{},
+		},
+		{
+			name:    "larger team doesn't win on its size",
+			results: map[string]float64{"a": 1, "b": 0.5, "c": 0.5, "d": 0.5},
+			teams:   map[string]string{"a": "red", "b": "blue", "c": "blue", "d": "blue"},
+			want: []TeamRecord{
+				{Team: "red", PlayerIds: []string{"a"}, Placement: 1},
+				{Team: "blue", PlayerIds: []string{"b", "c", "d"}, Placement: 2},
+			},
+		},
+		{
+			name:    "same mean result draws",
+			results: map[string]float64{"a": 0.5, "b": 1, "c": 0},
+			teams:   map[string]string{"a": "red", "b": "blue", "c": "blue"},
+			want: []TeamRecord{
+				{Team: "blue", PlayerIds: []string{"b", "c"}, Placement: 1},
+				{Team: "red", PlayerIds: []string{"a"}, Placement: 1},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			players := make(map[string]Player)
+			for playerId, result := range tt.results {
+				player := NewDefaultPlayer(playerId, "m1")
+				player.SetResult(result)
+				player.setTeam(tt.teams[playerId])
+				players[playerId] = player
+			}
+			match := NewDefaultMatch("m1", players)
+			if got := matchTeamRecords(match); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	"github.com/yelaco/ludofy/pkg/logging"
+	"go.uber.org/zap"
+)
+
+type tickStateResponse struct {
+	Type    string                 `json:"type"`
+	Tick    uint64                 `json:"tick"`
+	Full    bool                   `json:"full,omitempty"`
+	State   map[string]interface{} `json:"state,omitempty"`
+	Removed []string               `json:"removed,omitempty"`
+}
+
+// deltaEncoder keeps the last broadcast state to only send the top level keys
+// which changed since the previous tick
+type deltaEncoder struct {
+	last map[string][]byte
+}
+
+func newDeltaEncoder() *deltaEncoder {
+	return &deltaEncoder{
+		last: make(map[string][]byte),
+	}
+}
+
+func (e *deltaEncoder) encode(tick uint64, state map[string]interface{}, full bool) (tickStateResponse, bool) {
+	resp := tickStateResponse{
+		Type:  "tickState",
+		Tick:  tick,
+		Full:  full,
+		State: make(map[string]interface{}),
+	}
+	current := make(map[string][]byte, len(state))
+	for key, value := range state {
+		data, err := json.Marshal(value)
+		if err != nil {
+			logging.Error("failed to marshal tick state",
+				zap.String("key", key),
+				zap.Error(err),
+			)
+			continue
+		}
+		current[key] = data
+		if full || !bytes.Equal(e.last[key], data) {
+			resp.State[key] = value
+		}
+	}
+	if !full {
+		for key := range e.last {
+			if _, exist := current[key]; !exist {
+				resp.Removed = append(resp.Removed, key)
+			}
+		}
+	}
+	e.last = current
+	return resp, full || len(resp.State) > 0 || len(resp.Removed) > 0
+}
+
+// TickState is the state of a tick passed to the ProjectView hook of matches in
+// tick mode. The projected state, a TickState or a map, is delta encoded for
+// each viewer, so a key a viewer couldn't see is sent once it becomes visible
+type TickState map[string]interface{}
+
+// tickBroadcaster sends the delta of each tick. Matches with a ViewHandler
+// project the state before it is encoded and keep an encoder per viewer,
+// the others share one encoder
+type tickBroadcaster struct {
+	match      *DefaultMatch
+	shared     *deltaEncoder
+	players    map[string]*deltaEncoder
+	spectators *deltaEncoder
+}
+
+func newTickBroadcaster(match *DefaultMatch) *tickBroadcaster {
+	return &tickBroadcaster{
+		match:      match,
+		shared:     newDeltaEncoder(),
+		players:    make(map[string]*deltaEncoder),
+		spectators: newDeltaEncoder(),
+	}
+}
+
+func (b *tickBroadcaster) broadcast(tick uint64, state map[string]interface{}, full bool) {
+	if _, ok := b.match.handler.(ViewHandler); !ok {
+		resp, changed := b.shared.encode(tick, state, full)
+		if changed {
+			b.match.Broadcast(resp)
+		}
+		return
+	}
+	for playerId, player := range b.match.Players {
+		encoder, exist := b.players[playerId]
+		if !exist {
+			encoder = newDeltaEncoder()
+			b.players[playerId] = encoder
+		}
+		view, visible := b.project(Viewer{Kind: ViewerPlayer, PlayerId: playerId}, state)
+		if !visible {
+			continue
+		}
+		resp, changed := encoder.encode(tick, view, full)
+		if !changed {
+			continue
+		}
+		if err := player.writeView(resp); err != nil {
+			logging.Error("couldn't broadcast to player",
+				zap.String("player_id", playerId),
+				zap.Error(err),
+			)
+		}
+	}
+	view, visible := b.project(Viewer{Kind: ViewerSpectator}, state)
+	if !visible {
+		return
+	}
+	resp, changed := b.spectators.encode(tick, view, full)
+	if changed {
+		b.match.writeSpectators(resp)
+	}
+}
+
+// project method    returns the state of the tick the viewer may see, false
+// if the tick is withheld from the viewer
+func (b *tickBroadcaster) project(viewer Viewer, state map[string]interface{}) (map[string]interface{}, bool) {
+	view, visible := b.match.project(viewer, TickState(state))
+	if !visible {
+		return nil, false
+	}
+	switch view := view.(type) {
+	case TickState:
+		return view, true
+	case map[string]interface{}:
+		return view, true
+	}
+	logging.Error("tick state projected to another type",
+		zap.String("match_id", b.match.GetId()),
+	)
+	return nil, false
+}
+
+// SetTickRate method    runs the match in tick mode at the given ticks per
+// second when its handler implements TickHandler. Must be set before the match starts
+func (m *DefaultMatch) SetTickRate(tickRate int) {
+	m.tickRate = tickRate
+}
+
+// runTicks method    buffers moves and advances the simulation with a fixed
+// timestep, then broadcasts the state delta of the tick
+func (m *DefaultMatch) runTicks(handler TickHandler) {
+	dt := time.Second / time.Duration(m.tickRate)
+	ticker := m.Clock().NewTicker(dt)
+	defer ticker.Stop()
+
+	broadcaster := newTickBroadcaster(m)
+	moves := []Move{}
+	var tick uint64
+	for {
+		select {
+		case move := <-m.moveCh:
+			m.recordMessage(move.GetPlayerId())
+			if _, exist := m.Players[move.GetPlayerId()]; !exist {
+				logging.Info("move from invalid player dropped",
+					zap.String("match_id", m.GetId()),
+					zap.String("player_id", move.GetPlayerId()),
+				)
+				continue
+			}
+			if m.IsPaused() {
+				m.rejectPausedMove(move)
+				continue
+			}
+			moves = append(moves, move)
+		case <-m.endCh:
+			return
+		case <-m.saveCh:
+			m.Save()
+		case fn := <-m.execCh:
+			fn()
+			if m.IsEnded() {
+				return
+			}
+		case <-ticker.C():
+			if m.IsEnded() {
+				return
+			}
+			// The simulation stands still while paused
+			if m.IsPaused() {
+				continue
+			}
+			tick++
+			started := time.Now()
+			if err := handler.OnTick(dt, moves); err != nil {
+				logging.Error("on tick", zap.Error(err))
+			}
+			tickDuration.Observe(time.Since(started).Seconds())
+			m.countMoves(len(moves))
+			moves = []Move{}
+			if m.IsEnded() {
+				return
+			}
+			broadcaster.broadcast(tick, handler.TickState(), m.keyframe.Swap(false))
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// tickHandler is a match handler which does nothing, the broadcaster is
+// driven directly by the tests
+type tickHandler struct {
+	match Match
+}
+
+func (h *tickHandler) GetMatch() Match                           { return h.match }
+func (h *tickHandler) OnPlayerJoin(player Player) (bool, error)  { return false, nil }
+func (h *tickHandler) OnPlayerLeave(player Player) error         { return nil }
+func (h *tickHandler) OnPlayerSync(player Player) error          { return nil }
+func (h *tickHandler) HandleMove(player Player, move Move) error { return nil }
+func (h *tickHandler) OnMatchSave() error                        { return nil }
+func (h *tickHandler) OnMatchEnd() error                         { return nil }
+func (h *tickHandler) OnMatchAbort() error                       { return nil }
+
+// fogHandler hides the position of the other player until it is in sight
+type fogHandler struct {
+	tickHandler
+	inSight bool
+}
+
+func (h *fogHandler) ProjectView(viewer Viewer, msg interface{}) (interface{}, bool) {
+	state, ok := msg.(TickState)
+	if !ok {
+		return msg, true
+	}
+	view := TickState{}
+	for key, value := range state {
+		if key == viewer.PlayerId || h.inSight || viewer.Kind == ViewerSpectator {
+			view[key] = value
+		}
+	}
+	return view, true
+}
+
+func newTickTestMatch(t *testing.T, handler *fogHandler) (*DefaultMatch, map[string]*[]tickStateResponse) {
+	t.Helper()
+	received := map[string]*[]tickStateResponse{}
+	players := map[string]Player{}
+	for _, playerId := range []string{"alice", "bob"} {
+		messages := &[]tickStateResponse{}
+		received[playerId] = messages
+		player := NewDefaultPlayer(playerId, "m1")
+		player.setOutput(func(data []byte) {
+			var resp tickStateResponse
+			if err := json.Unmarshal(data, &resp); err != nil {
+				t.Fatalf("unmarshal %s: %v", data, err)
+			}
+			*messages = append(*messages, resp)
+		})
+		players[playerId] = player
+	}
+	match := NewDefaultMatch("m1", players).(*DefaultMatch)
+	handler.match = match
+	match.SetHandler(handler)
+	for _, player := range players {
+		player.attach(match)
+	}
+	return match, received
+}
+
+func TestTickViewPerViewer(t *testing.T) {
+	handler := &fogHandler{}
+	match, received := newTickTestMatch(t, handler)
+	broadcaster := newTickBroadcaster(match)
+	state := map[string]interface{}{"alice": 1.0, "bob": 2.0}
+
+	broadcaster.broadcast(1, state, false)
+	if got := (*received["alice"])[0].State; !reflect.DeepEqual(got, map[string]interface{}{"alice": 1.0}) {
+		t.Fatalf("alice saw %v on tick 1, want only her position", got)
+	}
+
+	// bob comes into sight without moving
+	handler.inSight = true
+	broadcaster.broadcast(2, state, false)
+	alice := *received["alice"]
+	if len(alice) != 2 || !reflect.DeepEqual(alice[1].State, map[string]interface{}{"bob": 2.0}) {
+		t.Fatalf("alice got %v, want bob's position on tick 2", alice)
+	}
+	if bob := *received["bob"]; len(bob) != 2 || !reflect.DeepEqual(bob[1].State, map[string]interface{}{"alice": 1.0}) {
+		t.Fatalf("bob got %v, want alice's position on tick 2", bob)
+	}
+
+	// nothing changed for anyone
+	broadcaster.broadcast(3, state, false)
+	if len(*received["alice"]) != 2 || len(*received["bob"]) != 2 {
+		t.Fatal("unchanged tick was sent")
+	}
+
+	// bob goes out of sight again
+	handler.inSight = false
+	broadcaster.broadcast(4, state, false)
+	alice = *received["alice"]
+	if len(alice) != 3 || !reflect.DeepEqual(alice[2].Removed, []string{"bob"}) {
+		t.Fatalf("alice got %v, want bob removed on tick 4", alice)
+	}
+}
+
+func TestTickViewKeyframe(t *testing.T) {
+	handler := &fogHandler{}
+	match, received := newTickTestMatch(t, handler)
+	broadcaster := newTickBroadcaster(match)
+	state := map[string]interface{}{"alice": 1.0, "bob": 2.0}
+
+	broadcaster.broadcast(1, state, false)
+	broadcaster.broadcast(2, state, true)
+	alice := *received["alice"]
+	if len(alice) != 2 || !alice[1].Full || !reflect.DeepEqual(alice[1].State, map[string]interface{}{"alice": 1.0}) {
+		t.Fatalf("alice got %v, want a full projected state on the keyframe", alice)
+	}
+}
+
+func TestTickWithoutView(t *testing.T) {
+	var messages []tickStateResponse
+	player := NewDefaultPlayer("alice", "m1")
+	player.setOutput(func(data []byte) {
+		var resp tickStateResponse
+		if err := json.Unmarshal(data, &resp); err != nil {
+			t.Fatalf("unmarshal %s: %v", data, err)
+		}
+		messages = append(messages, resp)
+	})
+	match := NewDefaultMatch("m1", map[string]Player{"alice": player}).(*DefaultMatch)
+	match.SetHandler(&tickHandler{match: match})
+	broadcaster := newTickBroadcaster(match)
+
+	broadcaster.broadcast(1, map[string]interface{}{"a": 1.0, "b": 2.0}, false)
+	broadcaster.broadcast(2, map[string]interface{}{"a": 1.0, "b": 3.0}, false)
+	if len(messages) != 2 || !reflect.DeepEqual(messages[1].State, map[string]interface{}{"b": 3.0}) {
+		t.Fatalf("got %v, want only the changed key on tick 2", messages)
+	}
+}
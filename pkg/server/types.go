@@ -1,11 +1,13 @@
 package server
 
 import (
+	"context"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/yelaco/ludofy/internal/domains/entities"
 	"github.com/yelaco/ludofy/pkg/utils"
 )
 
@@ -13,20 +15,38 @@ import (
 type Server interface {
 	Start() error
 	HandleMessage(playerId string, match Match, msg []byte) error
+	HandleMatchStart(match Match)
 	HandleMatchEnd(match Match)
 	HandleMatchSave(match Match)
 	HandleMatchAbort(match Match)
+	MigrateMatch(ctx context.Context, matchId, target string) error
 }
 
 type Match interface {
 	start()
 	GetHandler() MatchHandler
 	SetHandler(MatchHandler)
+	setStartCallback(func(Match))
 	setSaveCallback(func(Match))
 	setEndCallback(func(Match))
 	setAbortCallback(func(Match))
-	playerJoin(playerId string, conn *websocket.Conn)
+	playerJoin(playerId string, conn *websocket.Conn, lastSeq *uint64)
+	enableSequencing(outboxSize int)
 	playerDisconnect(playerId string)
+	playerRtt(playerId string, sample time.Duration)
+	setRecorder(recorder *recorder)
+	record(eventType RecordEventType, playerId, name string, data any)
+	beginMessage(playerId string, msg []byte)
+	recordMessage(playerId string)
+	endMessage(playerId string)
+	recording() *Recording
+	setClock(clock utils.Clock)
+	setLoadedAt(loadedAt time.Time)
+	getLoadedAt() time.Time
+	exec(fn func()) bool
+	handOff(handOff func() error) error
+	drive(clock utils.Clock, replaying bool) error
+	fireTimer(name string)
 	GetId() string
 	GetPlayers() map[string]Player
 	Abort()
@@ -34,18 +54,61 @@ type Match interface {
 	End()
 	IsEnded() bool
 	ProcessMove(move Move)
+	Now() time.Time
+	Clock() utils.Clock
+	FireTimer(name string)
 	GetPlayerWithId(id string) (Player, bool)
+	GetTeams() map[string][]Player
+	GetTeamPlayers(team string) []Player
 	DisconnectPlayers(msg string, deadline time.Time)
+	Broadcast(msg interface{})
+	BroadcastToTeam(team string, msg interface{})
+	BroadcastToOpponents(team string, msg interface{})
+	SetTickRate(tickRate int)
+	SetSavePolicy(policy SavePolicy)
+	SetChatPolicy(policy ChatPolicy)
+	SetPausePolicy(policy PausePolicy)
+	IsPaused() bool
+	handlePause(playerId string, message []byte) bool
+	getPauseState() *entities.PauseState
+	restorePause(state *entities.PauseState)
+	handleChat(playerId string, message []byte) bool
+	getChatLog() []ChatLine
+	setChatLog(lines []ChatLine)
+	project(viewer Viewer, msg interface{}) (interface{}, bool)
+	spectatorJoin(spectator Spectator, maxSpectators int) error
+	spectatorLeave(spectator Spectator)
+	disconnectSpectators(msg string, deadline time.Time)
 }
 
 type Player interface {
 	setConn(conn *websocket.Conn)
+	setStatus(status Status)
+	setOutput(output func(data []byte))
+	setSequence(sequence *atomic.Uint64, outboxSize int)
+	resume(conn *websocket.Conn, lastSeq uint64) bool
+	updateRtt(sample time.Duration)
+	closeConn(code int, reason string) bool
+	attach(match Match)
+	writeView(msg interface{}) error
+	setTeam(team string)
+	IsBot() bool
+	GetTeam() string
 	GetId() string
 	GetStatus() string
+	Write(msg interface{}) error
 	WriteJson(msg interface{}) error
 	WriteControl(messageType int, data []byte, deadline time.Time) error
 	GetResult() float64
 	SetResult(result float64)
+	GetRtt() time.Duration
+}
+
+type Spectator interface {
+	GetId() string
+	Write(msg interface{}) error
+	WriteJson(msg interface{}) error
+	WriteControl(messageType int, data []byte, deadline time.Time) error
 }
 
 type Move interface {
@@ -59,11 +122,24 @@ type DefaultServer struct {
 
 	cfg          Config
 	matches      sync.Map
+	matchLimits  sync.Map
+	savers       sync.Map
 	totalMatches atomic.Int32
+	draining     atomic.Bool
+	protected    atomic.Bool
+	connections  sync.WaitGroup
 	mu           *sync.Mutex
 
 	protectionTimer *utils.Timer
+	protectionMu    sync.Mutex
 	handler         ServerHandler
+
+	store      MatchStore
+	sink       MatchSink
+	protection ProtectionController
+	recordings RecordingSink
+	snapshots  SnapshotStore
+	spool      *eventSpool
 }
 
 type DefaultPlayer struct {
@@ -72,25 +148,74 @@ type DefaultPlayer struct {
 	MatchId string
 	Status  Status
 	Result  float64
-
-	mu *sync.Mutex
+	Team    string
+
+	match    Match
+	sequence *atomic.Uint64
+	outbox   *outbox
+	codec    codec
+	output   func(data []byte)
+	rtt      atomic.Int64
+	mu       *sync.Mutex
 }
 
 type DefaultMatch struct {
 	Id      string
 	Players map[string]Player
 	moveCh  chan Move
+	execCh  chan func()
+	endCh   chan struct{}
+	done    chan struct{}
 
+	startCallback func(Match)
 	endCallback   func(Match)
 	saveCallback  func(Match)
 	abortCallback func(Match)
 
-	ended bool
-	mu    *sync.Mutex
+	ended    bool
+	tickRate int
+	keyframe atomic.Bool
+	mu       *sync.Mutex
+
+	savePolicy     SavePolicy
+	saveCh         chan struct{}
+	saveTimer      utils.ClockTimer
+	movesSinceSave atomic.Int64
+
+	recorder  *recorder
+	clock     utils.Clock
+	loadedAt  time.Time
+	driven    atomic.Bool
+	replaying atomic.Bool
+
+	spectators  map[Spectator]struct{}
+	spectatorMu *sync.Mutex
+
+	chatPolicy   *ChatPolicy
+	chatLog      []ChatLine
+	chatLogBytes int
+	chatMutes    map[string]map[string]struct{}
+	chatMu       *sync.Mutex
+
+	pausePolicy  *PausePolicy
+	pause        entities.PauseState
+	pausePending *pendingPause
+	pauseTimer   utils.ClockTimer
+	pauseMu      *sync.Mutex
 
 	handler MatchHandler
 }
 
+type DefaultSpectator struct {
+	Id   string
+	Conn *websocket.Conn
+
+	codec     codec
+	queue     chan spectatorFrame
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
 type DefaultMove struct {
 	PlayerId string `json:"playerId"`
 }
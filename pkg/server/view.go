@@ -0,0 +1,94 @@
+package server
+
+import (
+	"github.com/yelaco/ludofy/internal/domains/dtos"
+	"github.com/yelaco/ludofy/pkg/logging"
+	"go.uber.org/zap"
+)
+
+type ViewerKind string
+
+const (
+	ViewerPlayer      ViewerKind = "player"
+	ViewerSpectator   ViewerKind = "spectator"
+	ViewerPersistence ViewerKind = "persistence"
+)
+
+// Viewer is the recipient of a message projected by a ViewHandler
+type Viewer struct {
+	Kind ViewerKind
+	// PlayerId is the player receiving the message, empty unless Kind is
+	// ViewerPlayer
+	PlayerId string
+}
+
+// ViewHandler can be implemented by a MatchHandler of hidden-information games
+// to turn the authoritative state into the view of each recipient. Every
+// message written to a player or a spectator goes through it, including the
+// broadcasts, and so do the saves published with dtos.MatchStateRequest
+// values. Saves are what matches resume from after a crash, the persistence
+// view must keep what OnMatchResume needs. Snapshots handed over to other
+// servers and recordings are never projected. In tick mode the TickState of
+// each tick is projected instead of its delta. The spectator view still goes
+// through OnSpectatorBroadcast when the handler is also a SpectatorHandler
+type ViewHandler interface {
+	// ProjectView returns the message as the viewer may see it, or false to
+	// withhold it. It runs on the goroutine writing the message, the match
+	// goroutine for the built-in chat and the connection of the sender for
+	// errors
+	ProjectView(viewer Viewer, msg interface{}) (interface{}, bool)
+}
+
+// project method    projects the message for the viewer with the ViewHandler of
+// the match, then spectators only get what the SpectatorHandler allows of the
+// spectator view. Without either handler messages go out as is
+func (m *DefaultMatch) project(viewer Viewer, msg interface{}) (interface{}, bool) {
+	if handler, ok := m.handler.(ViewHandler); ok {
+		view, visible := handler.ProjectView(viewer, msg)
+		if !visible {
+			return nil, false
+		}
+		msg = view
+	}
+	if handler, ok := m.handler.(SpectatorHandler); ok && viewer.Kind == ViewerSpectator {
+		return handler.OnSpectatorBroadcast(msg)
+	}
+	return msg, true
+}
+
+// projectSave projects the save of the match for persistence, false if it is
+// withheld and must not be published
+func projectSave(match Match, req *dtos.MatchStateRequest) bool {
+	view, visible := match.project(Viewer{Kind: ViewerPersistence}, *req)
+	if !visible {
+		return false
+	}
+	projected, ok := view.(dtos.MatchStateRequest)
+	if !ok {
+		logging.Error("match save projected to another type",
+			zap.String("match_id", match.GetId()),
+		)
+		return false
+	}
+	*req = projected
+	return true
+}
+
+// spectatorView is the spectator passed to OnSpectatorJoin, the messages the
+// handler writes to it are projected like the broadcasts
+type spectatorView struct {
+	Spectator
+	match Match
+}
+
+func (s spectatorView) Write(msg interface{}) error {
+	msg, visible := s.match.project(Viewer{Kind: ViewerSpectator}, msg)
+	if !visible {
+		return nil
+	}
+	return s.Spectator.Write(msg)
+}
+
+func (s spectatorView) WriteJson(msg interface{}) error {
+	return s.Write(msg)
+}
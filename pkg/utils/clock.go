@@ -0,0 +1,254 @@
+package utils
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock tells the time and creates timers and tickers, so code depending on
+// time can run on a FakeClock
+type Clock interface {
+	Now() time.Time
+	Since(t time.Time) time.Duration
+	NewTimer(d time.Duration) ClockTimer
+	NewTicker(d time.Duration) ClockTicker
+	// AfterFunc calls f once the duration elapsed. The returned timer has a nil channel
+	AfterFunc(d time.Duration, f func()) ClockTimer
+}
+
+// ClockTimer is a timer created by a Clock
+type ClockTimer interface {
+	C() <-chan time.Time
+	Reset(d time.Duration) bool
+	Stop() bool
+}
+
+// ClockTicker is a ticker created by a Clock
+type ClockTicker interface {
+	C() <-chan time.Time
+	Reset(d time.Duration)
+	Stop()
+}
+
+// RealClock is the wall clock backed by the time package
+var RealClock Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) Since(t time.Time) time.Duration {
+	return time.Since(t)
+}
+
+func (realClock) NewTimer(d time.Duration) ClockTimer {
+	return &realTimer{timer: time.NewTimer(d)}
+}
+
+func (realClock) NewTicker(d time.Duration) ClockTicker {
+	return &realTicker{ticker: time.NewTicker(d)}
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) ClockTimer {
+	return &realTimer{timer: time.AfterFunc(d, f)}
+}
+
+type realTimer struct {
+	timer *time.Timer
+}
+
+func (t *realTimer) C() <-chan time.Time {
+	return t.timer.C
+}
+
+func (t *realTimer) Reset(d time.Duration) bool {
+	return t.timer.Reset(d)
+}
+
+func (t *realTimer) Stop() bool {
+	return t.timer.Stop()
+}
+
+type realTicker struct {
+	ticker *time.Ticker
+}
+
+func (t *realTicker) C() <-chan time.Time {
+	return t.ticker.C
+}
+
+func (t *realTicker) Reset(d time.Duration) {
+	t.ticker.Reset(d)
+}
+
+func (t *realTicker) Stop() {
+	t.ticker.Stop()
+}
+
+// FakeClock is a Clock which only moves when advanced. Timers and tickers
+// fire in order of their deadline while the clock moves past it, with the
+// clock set to the deadline. Functions of AfterFunc run synchronously in
+// Advance and Set, so they must not block on the caller.
+// Timers due at the current time fire on the next Advance or Set
+type FakeClock struct {
+	now    time.Time
+	timers []*fakeTimer
+	mu     sync.Mutex
+}
+
+// NewFakeClock creates a fake clock starting at now
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *FakeClock) Since(t time.Time) time.Duration {
+	return c.Now().Sub(t)
+}
+
+func (c *FakeClock) NewTimer(d time.Duration) ClockTimer {
+	t := &fakeTimer{clock: c, c: make(chan time.Time, 1)}
+	t.Reset(d)
+	return t
+}
+
+func (c *FakeClock) NewTicker(d time.Duration) ClockTicker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+	t := &fakeTimer{clock: c, c: make(chan time.Time, 1), period: d}
+	t.Reset(d)
+	return &fakeTicker{timer: t}
+}
+
+func (c *FakeClock) AfterFunc(d time.Duration, f func()) ClockTimer {
+	t := &fakeTimer{clock: c, f: f}
+	t.Reset(d)
+	return t
+}
+
+// Advance method    moves the clock forward, firing the timers due
+func (c *FakeClock) Advance(d time.Duration) {
+	c.Set(c.Now().Add(d))
+}
+
+// Set method    moves the clock to the given time, firing the timers due.
+// The clock never moves backwards
+func (c *FakeClock) Set(now time.Time) {
+	for {
+		c.mu.Lock()
+		if len(c.timers) == 0 || c.timers[0].when.After(now) {
+			if now.After(c.now) {
+				c.now = now
+			}
+			c.mu.Unlock()
+			return
+		}
+		t := c.timers[0]
+		c.timers = c.timers[1:]
+		if t.when.After(c.now) {
+			c.now = t.when
+		}
+		fired := c.now
+		if t.period > 0 {
+			t.when = t.when.Add(t.period)
+			c.schedule(t)
+		} else {
+			t.active = false
+		}
+		c.mu.Unlock()
+
+		if t.f != nil {
+			t.f()
+			continue
+		}
+		select {
+		case t.c <- fired:
+		default:
+		}
+	}
+}
+
+// schedule method    inserts the timer by deadline, c.mu must be held
+func (c *FakeClock) schedule(t *fakeTimer) {
+	i := sort.Search(len(c.timers), func(i int) bool {
+		return c.timers[i].when.After(t.when)
+	})
+	c.timers = append(c.timers, nil)
+	copy(c.timers[i+1:], c.timers[i:])
+	c.timers[i] = t
+	t.active = true
+}
+
+// unschedule method    removes the timer, c.mu must be held
+func (c *FakeClock) unschedule(t *fakeTimer) bool {
+	if !t.active {
+		return false
+	}
+	for i, timer := range c.timers {
+		if timer == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			break
+		}
+	}
+	t.active = false
+	return true
+}
+
+type fakeTimer struct {
+	clock  *FakeClock
+	when   time.Time
+	period time.Duration
+	c      chan time.Time
+	f      func()
+	active bool
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	active := t.clock.unschedule(t)
+	t.when = t.clock.now.Add(d)
+	t.clock.schedule(t)
+	return active
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	return t.clock.unschedule(t)
+}
+
+type fakeTicker struct {
+	timer *fakeTimer
+}
+
+func (t *fakeTicker) C() <-chan time.Time {
+	return t.timer.c
+}
+
+func (t *fakeTicker) Reset(d time.Duration) {
+	if d <= 0 {
+		panic("non-positive interval for Ticker.Reset")
+	}
+	t.timer.clock.mu.Lock()
+	t.timer.period = d
+	t.timer.clock.mu.Unlock()
+	t.timer.Reset(d)
+}
+
+func (t *fakeTicker) Stop() {
+	t.timer.Stop()
+}
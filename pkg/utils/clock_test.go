@@ -0,0 +1,204 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+var epoch = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestFakeClockAdvance(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	clock.Advance(time.Minute)
+	if got := clock.Now(); !got.Equal(epoch.Add(time.Minute)) {
+		t.Fatalf("Now() = %v, want %v", got, epoch.Add(time.Minute))
+	}
+	if got := clock.Since(epoch); got != time.Minute {
+		t.Fatalf("Since() = %v, want 1m", got)
+	}
+
+	clock.Set(epoch)
+	if got := clock.Now(); !got.Equal(epoch.Add(time.Minute)) {
+		t.Fatalf("clock moved backwards to %v", got)
+	}
+}
+
+func TestFakeClockAfterFunc(t *testing.T) {
+	tests := []struct {
+		name    string
+		advance []time.Duration
+		// fired are the offsets from epoch the functions see, in order
+		fired []time.Duration
+	}{
+		{name: "before any deadline", advance: []time.Duration{time.Second}},
+		{
+			name:    "past every deadline",
+			advance: []time.Duration{time.Minute},
+			fired:   []time.Duration{2 * time.Second, 3 * time.Second, 5 * time.Second},
+		},
+		{
+			name:    "step by step",
+			advance: []time.Duration{2 * time.Second, 2 * time.Second},
+			fired:   []time.Duration{2 * time.Second, 3 * time.Second},
+		},
+		{
+			name:    "at the deadline",
+			advance: []time.Duration{5 * time.Second},
+			fired:   []time.Duration{2 * time.Second, 3 * time.Second, 5 * time.Second},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := NewFakeClock(epoch)
+			var fired []time.Duration
+			for _, d := range []time.Duration{5 * time.Second, 2 * time.Second, 3 * time.Second} {
+				clock.AfterFunc(d, func() {
+					fired = append(fired, clock.Now().Sub(epoch))
+				})
+			}
+			for _, d := range tt.advance {
+				clock.Advance(d)
+			}
+			if len(fired) != len(tt.fired) {
+				t.Fatalf("fired at %v, want %v", fired, tt.fired)
+			}
+			for i := range fired {
+				if fired[i] != tt.fired[i] {
+					t.Fatalf("fired at %v, want %v", fired, tt.fired)
+				}
+			}
+		})
+	}
+}
+
+func TestFakeClockTimerStopAndReset(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	fired := 0
+	timer := clock.AfterFunc(time.Second, func() { fired++ })
+
+	if !timer.Stop() {
+		t.Fatal("Stop() = false for an active timer")
+	}
+	if timer.Stop() {
+		t.Fatal("Stop() = true for a stopped timer")
+	}
+	clock.Advance(time.Minute)
+	if fired != 0 {
+		t.Fatal("stopped timer fired")
+	}
+
+	if timer.Reset(time.Second) {
+		t.Fatal("Reset() = true for a stopped timer")
+	}
+	if !timer.Reset(2 * time.Second) {
+		t.Fatal("Reset() = false for an active timer")
+	}
+	clock.Advance(time.Second)
+	if fired != 0 {
+		t.Fatal("timer fired at its old deadline")
+	}
+	clock.Advance(time.Second)
+	if fired != 1 {
+		t.Fatalf("timer fired %d times, want 1", fired)
+	}
+}
+
+func TestFakeClockDueTimerFiresOnNextMove(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	fired := false
+	clock.AfterFunc(0, func() { fired = true })
+	if fired {
+		t.Fatal("timer fired when created")
+	}
+	clock.Advance(0)
+	if !fired {
+		t.Fatal("due timer didn't fire on Advance(0)")
+	}
+}
+
+func TestFakeClockTimerChannel(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	timer := clock.NewTimer(time.Second)
+	select {
+	case <-timer.C():
+		t.Fatal("timer fired early")
+	default:
+	}
+	clock.Advance(time.Hour)
+	select {
+	case at := <-timer.C():
+		if !at.Equal(epoch.Add(time.Second)) {
+			t.Fatalf("timer fired at %v, want its deadline", at)
+		}
+	default:
+		t.Fatal("timer didn't fire")
+	}
+}
+
+func TestFakeClockTicker(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	ticker := clock.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	ticks := 0
+	for i := 0; i < 3; i++ {
+		clock.Advance(time.Second)
+		select {
+		case <-ticker.C():
+			ticks++
+		default:
+		}
+	}
+	if ticks != 3 {
+		t.Fatalf("got %d ticks, want 3", ticks)
+	}
+
+	// The channel holds a single tick, like time.Ticker
+	clock.Advance(5 * time.Second)
+	<-ticker.C()
+	select {
+	case <-ticker.C():
+		t.Fatal("ticker buffered more than one tick")
+	default:
+	}
+
+	ticker.Reset(time.Minute)
+	clock.Advance(time.Second)
+	select {
+	case <-ticker.C():
+		t.Fatal("ticker ticked at its old period")
+	default:
+	}
+	clock.Advance(time.Minute)
+	select {
+	case <-ticker.C():
+	default:
+		t.Fatal("ticker didn't tick at its new period")
+	}
+
+	ticker.Stop()
+	clock.Advance(time.Hour)
+	select {
+	case <-ticker.C():
+		t.Fatal("stopped ticker ticked")
+	default:
+	}
+}
+
+func TestFakeClockNestedTimers(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	var fired []time.Duration
+	clock.AfterFunc(time.Second, func() {
+		fired = append(fired, clock.Now().Sub(epoch))
+		clock.AfterFunc(time.Second, func() {
+			fired = append(fired, clock.Now().Sub(epoch))
+		})
+	})
+	clock.Advance(5 * time.Second)
+	if len(fired) != 2 || fired[0] != time.Second || fired[1] != 2*time.Second {
+		t.Fatalf("fired at %v, want [1s 2s]", fired)
+	}
+	if got := clock.Now(); !got.Equal(epoch.Add(5 * time.Second)) {
+		t.Fatalf("Now() = %v after Advance, want %v", got, epoch.Add(5*time.Second))
+	}
+}
@@ -2,28 +2,35 @@ package utils
 
 import "time"
 
-// Timer wraps time.Timer with an explicit end time tracking.
+// Timer wraps a ClockTimer with an explicit end time tracking.
 type Timer struct {
-	timer *time.Timer
+	clock Clock
+	timer ClockTimer
 	end   time.Time
 }
 
-// NewTimer creates a new Timer instance.
+// NewTimer creates a new Timer instance on the wall clock.
 func NewTimer(duration time.Duration) *Timer {
+	return NewTimerWithClock(RealClock, duration)
+}
+
+// NewTimerWithClock creates a new Timer instance on the given clock.
+func NewTimerWithClock(clock Clock, duration time.Duration) *Timer {
 	return &Timer{
-		timer: time.NewTimer(duration),
-		end:   time.Now().Add(duration),
+		clock: clock,
+		timer: clock.NewTimer(duration),
+		end:   clock.Now().Add(duration),
 	}
 }
 
 func (s *Timer) C() <-chan time.Time {
-	return s.timer.C
+	return s.timer.C()
 }
 
 // Reset restarts the timer with a new duration.
 func (s *Timer) Reset(duration time.Duration) {
 	s.timer.Reset(duration)
-	s.end = time.Now().Add(duration)
+	s.end = s.clock.Now().Add(duration)
 }
 
 // Stop stops the timer.
@@ -35,7 +42,7 @@ func (s *Timer) Stop() {
 
 // TimeRemaining returns the remaining duration.
 func (s *Timer) TimeRemaining() time.Duration {
-	remaining := time.Until(s.end)
+	remaining := s.end.Sub(s.clock.Now())
 	if remaining < 0 {
 		return 0
 	}